@@ -0,0 +1,164 @@
+package client
+
+import (
+	"bytes"
+	"dhcp/protocol"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+const (
+	serverPort = 67
+	clientPort = 68
+)
+
+func createDHCPPacket(mac net.HardwareAddr, messageType byte, requestIP net.IP, serverIP net.IP) *protocol.Packet {
+	packet := &protocol.Packet{
+		Op:     1,
+		HType:  1,
+		HLen:   6,
+		Hops:   0,
+		XId:    rand.Uint32(),
+		Secs:   0,
+		Flags:  0,
+		CHAddr: mac,
+	}
+
+	packet.AddOption(protocol.OptionDHCPMessageType, protocol.EncodeUint8(messageType))
+	packet.AddOption(protocol.OptionClientIdentifier, append([]byte{1}, mac...))
+	if requestIP != nil {
+		packet.AddOption(protocol.OptionRequestedIPAddress, protocol.EncodeIP(requestIP))
+	}
+	if serverIP != nil {
+		packet.AddOption(protocol.OptionServerIdentifier, protocol.EncodeIP(serverIP))
+	}
+	packet.AddOption(protocol.OptionParameterRequestList, []byte{
+		protocol.OptionSubnetMask,
+		protocol.OptionRouter,
+		protocol.OptionDomainName,
+		protocol.OptionDomainNameServer,
+	})
+	return packet
+}
+
+// defaultTimeout is how long a Client waits for replies.
+const defaultTimeout = 5 * time.Second
+
+// Client runs DHCP conversations for one hardware address over conn,
+// normally a UDP socket on the client port.
+type Client struct {
+	conn   net.PacketConn
+	mac    net.HardwareAddr
+	server net.Addr
+	// Timeout is how long to wait for replies.
+	Timeout time.Duration
+}
+
+// New returns a client sending to the broadcast address over conn.
+func New(conn net.PacketConn, mac net.HardwareAddr) *Client {
+	return &Client{
+		conn:    conn,
+		mac:     mac,
+		server:  &net.UDPAddr{IP: net.IPv4bcast, Port: serverPort},
+		Timeout: defaultTimeout,
+	}
+}
+
+// Listen returns a client on a UDP socket bound to the client port.
+func Listen(mac net.HardwareAddr) (*Client, error) {
+	conn, err := net.ListenPacket("udp4", fmt.Sprintf("0.0.0.0:%d", clientPort))
+	if err != nil {
+		return nil, err
+	}
+	return New(conn, mac), nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Acquire obtains a lease: it discovers the servers, requests the lowest
+// address offered and returns the ACK.
+func (c *Client) Acquire() (*protocol.Packet, error) {
+	discover := createDHCPPacket(c.mac, protocol.DHCPDISCOVER, nil, nil)
+	offers, err := c.exchange(discover, 1)
+	if err != nil {
+		return nil, err
+	}
+	offer := chooseOffer(offers)
+	if offer == nil {
+		return nil, errors.New("no offer received")
+	}
+
+	request := createDHCPPacket(c.mac, protocol.DHCPREQUEST, offer.YIAddr, getServerIP(offer))
+	request.XId = discover.XId
+	replies, err := c.exchange(request, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(replies) == 0 {
+		return nil, errors.New("no reply to request")
+	}
+	if replies[0].DHCPMessageType() != protocol.DHCPACK {
+		return nil, fmt.Errorf("request for %s was refused", offer.YIAddr)
+	}
+	return replies[0], nil
+}
+
+// exchange sends packet and returns up to count replies to it that arrive
+// within the timeout.
+func (c *Client) exchange(packet *protocol.Packet, count int) ([]*protocol.Packet, error) {
+	_, err := c.conn.WriteTo(packet.Encode(), c.server)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]*protocol.Packet, 0, count)
+	deadline := time.Now().Add(c.Timeout)
+	buf := make([]byte, 1500)
+	for len(responses) < count {
+		c.conn.SetReadDeadline(deadline)
+
+		n, _, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+
+		response, err := protocol.Decode(buf[:n])
+		if err != nil || response.Op != protocol.BOOTREPLY || response.XId != packet.XId {
+			continue
+		}
+
+		responses = append(responses, response)
+	}
+
+	return responses, nil
+}
+
+func chooseOffer(offers []*protocol.Packet) *protocol.Packet {
+	if len(offers) == 0 {
+		return nil
+	}
+
+	chosenOffer := offers[0]
+	for _, offer := range offers[1:] {
+		if bytes.Compare(offer.YIAddr[:], chosenOffer.YIAddr[:]) < 0 {
+			chosenOffer = offer
+		}
+	}
+	return chosenOffer
+}
+
+func getServerIP(packet *protocol.Packet) net.IP {
+	ip, err := packet.GetIPOption(protocol.OptionServerIdentifier)
+	if err != nil {
+		return nil
+	}
+	return ip
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"dhcp/lease"
+	"dhcp/protocol"
+	"dhcp/server"
+	"dhcp/transport"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T, network *transport.MemoryNetwork) {
+	t.Helper()
+	cfg := &server.Config{
+		Start:         net.ParseIP("192.168.1.100"),
+		End:           net.ParseIP("192.168.1.200"),
+		Subnet:        net.IPNet{IP: net.ParseIP("192.168.1.0"), Mask: net.IPv4Mask(255, 255, 255, 0)},
+		Lease:         time.Hour,
+		RenewalTime:   30 * time.Minute,
+		RebindingTime: 45 * time.Minute,
+		Router:        net.ParseIP("192.168.1.1"),
+		ServerIP:      net.ParseIP("192.168.1.2"),
+		DNS:           []net.IP{net.ParseIP("8.8.8.8")},
+	}
+	s, err := server.NewServer(cfg, server.WithTransport(network.Server()), server.WithLeaseStore(lease.NewMemoryStore()))
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Serve(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestClient(t *testing.T) {
+	network := transport.NewMemoryNetwork()
+	newTestServer(t, network)
+
+	mac, err := net.ParseMAC("4a:f3:f1:30:cd:d6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := New(network.Client(mac), mac)
+	ack, err := c.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if ack.DHCPMessageType() != protocol.DHCPACK || !ack.YIAddr.Equal(net.ParseIP("192.168.1.100")) {
+		t.Errorf("Expected an ACK for 192.168.1.100, got %v", ack)
+	}
+	if ip := getServerIP(ack); !ip.Equal(net.ParseIP("192.168.1.2")) {
+		t.Errorf("Expected server 192.168.1.2, got %v", ip)
+	}
+
+	// A second client gets another address, the first one keeps its lease.
+	other, _ := net.ParseMAC("4a:f3:f1:30:cd:d7")
+	otherAck, err := New(network.Client(other), other).Acquire()
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if otherAck.YIAddr.Equal(ack.YIAddr) {
+		t.Errorf("Expected different addresses, both got %s", ack.YIAddr)
+	}
+	again, err := c.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if !again.YIAddr.Equal(ack.YIAddr) {
+		t.Errorf("Expected %s to be offered again, got %s", ack.YIAddr, again.YIAddr)
+	}
+}
+
+func TestChooseOffer(t *testing.T) {
+	offers := []*protocol.Packet{
+		{YIAddr: net.ParseIP("10.0.0.20").To4()},
+		{YIAddr: net.ParseIP("10.0.0.5").To4()},
+	}
+	if offer := chooseOffer(offers); !offer.YIAddr.Equal(net.ParseIP("10.0.0.5")) {
+		t.Errorf("Expected the lowest address, got %s", offer.YIAddr)
+	}
+	if chooseOffer(nil) != nil {
+		t.Errorf("Expected no offer")
+	}
+}
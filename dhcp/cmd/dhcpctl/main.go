@@ -0,0 +1,467 @@
+// Command dhcpctl operates a running DHCP server through its control
+// socket.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const defaultSocket = "/run/dhcpd.sock"
+
+const usage = `Usage: dhcpctl [-socket path] [-json] command
+
+Commands:
+  leases list [-mac mac] [-ip ip] [-hostname name] [-scope scope] [-state state]
+  leases show <mac|ip>
+  leases release <mac|ip>
+  reservations list
+  reservations add -ip ip [-mac mac] [-client-id id] [-circuit-id id] [-remote-id id] [-hostname name]
+  reservations rm <ip>
+  pool stats
+  config reload
+  stats
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "dhcpctl:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// commands maps "noun verb" to the command implementing it.
+var commands = map[string]func(c *ctl, args []string) error{
+	"leases list":       (*ctl).listLeases,
+	"leases show":       (*ctl).showLease,
+	"leases release":    (*ctl).releaseLease,
+	"reservations list": (*ctl).listReservations,
+	"reservations add":  (*ctl).addReservation,
+	"reservations rm":   (*ctl).removeReservation,
+	"pool stats":        (*ctl).poolStats,
+	"config reload":     (*ctl).reloadConfig,
+	"stats":             (*ctl).stats,
+}
+
+func run(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("dhcpctl", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.Usage = func() { fmt.Fprint(fs.Output(), usage) }
+	socket := fs.String("socket", defaultSocket, "path of the server control socket")
+	asJSON := fs.Bool("json", false, "print JSON instead of tables")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+
+	c := newCtl(*socket, *asJSON, out)
+	for _, n := range []int{2, 1} {
+		if len(args) < n {
+			continue
+		}
+		if cmd, ok := commands[strings.Join(args[:n], " ")]; ok {
+			return cmd(c, args[n:])
+		}
+	}
+	fs.Usage()
+	return errors.New("unknown command")
+}
+
+// ctl sends admin API requests over the control socket.
+type ctl struct {
+	client *http.Client
+	json   bool
+	out    io.Writer
+}
+
+func newCtl(socket string, asJSON bool, out io.Writer) *ctl {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	return &ctl{
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		json: asJSON,
+		out:  out,
+	}
+}
+
+// do sends a request with body encoded as JSON, unless it is nil, and
+// returns the response body. Error responses are returned as errors.
+func (c *ctl) do(method, path string, body any) ([]byte, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, "http://dhcpd"+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach the server: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return nil, errors.New(apiErr.Error)
+		}
+		return nil, fmt.Errorf("server answered %s", resp.Status)
+	}
+	return data, nil
+}
+
+// get fetches path and decodes the response into v. In JSON mode the
+// response is printed instead and printed is true.
+func (c *ctl) get(path string, v any) (printed bool, err error) {
+	data, err := c.do(http.MethodGet, path, nil)
+	if err != nil {
+		return false, err
+	}
+	if c.json {
+		return true, c.printJSON(data)
+	}
+	return false, json.Unmarshal(data, v)
+}
+
+func (c *ctl) printJSON(data []byte) error {
+	var b bytes.Buffer
+	if err := json.Indent(&b, bytes.TrimSpace(data), "", "  "); err != nil {
+		return err
+	}
+	b.WriteByte('\n')
+	_, err := b.WriteTo(c.out)
+	return err
+}
+
+// printDone reports a change that has no response body.
+func (c *ctl) printDone(format string, args ...any) {
+	if c.json {
+		fmt.Fprintln(c.out, `{"ok": true}`)
+		return
+	}
+	fmt.Fprintf(c.out, format+"\n", args...)
+}
+
+func (c *ctl) table() *tabwriter.Writer {
+	return tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+}
+
+type leaseInfo struct {
+	IP         string    `json:"ip"`
+	MAC        string    `json:"mac"`
+	ClientID   string    `json:"client_id"`
+	Hostname   string    `json:"hostname"`
+	Scope      string    `json:"scope"`
+	State      string    `json:"state"`
+	Expiration time.Time `json:"expiration"`
+	CircuitID  string    `json:"circuit_id"`
+	RemoteID   string    `json:"remote_id"`
+	// OutsidePool is set for leases a reload left outside the pools.
+	OutsidePool bool `json:"outside_pool"`
+}
+
+func (l *leaseInfo) state() string {
+	if l.OutsidePool {
+		return l.State + ", outside pool"
+	}
+	return l.State
+}
+
+func (c *ctl) listLeases(args []string) error {
+	fs := flag.NewFlagSet("leases list", flag.ContinueOnError)
+	q := url.Values{}
+	for _, name := range []string{"mac", "ip", "hostname", "scope", "state"} {
+		fs.Func(name, "only list leases with this "+name, func(v string) error {
+			q.Set(name, v)
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	path := "/api/v1/leases"
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	var leases []leaseInfo
+	if printed, err := c.get(path, &leases); printed || err != nil {
+		return err
+	}
+	w := c.table()
+	fmt.Fprintln(w, "IP\tMAC\tHOSTNAME\tSCOPE\tSTATE\tEXPIRES")
+	for _, l := range leases {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", l.IP, dash(l.MAC), dash(l.Hostname), l.Scope, l.state(), formatTime(l.Expiration))
+	}
+	return w.Flush()
+}
+
+// findLeases returns the leases of the client with the MAC address, or the
+// lease of the IP address, in arg.
+func (c *ctl) findLeases(arg string) ([]leaseInfo, []byte, error) {
+	path := "/api/v1/leases?mac=" + url.QueryEscape(arg)
+	if ip := net.ParseIP(arg); ip != nil {
+		path = "/api/v1/leases/" + ip.String()
+	} else if _, err := net.ParseMAC(arg); err != nil {
+		return nil, nil, fmt.Errorf("%q is neither an IP nor a MAC address", arg)
+	}
+	data, err := c.do(http.MethodGet, path, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	var leases []leaseInfo
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err = json.Unmarshal(data, &leases)
+	} else {
+		leases = make([]leaseInfo, 1)
+		err = json.Unmarshal(data, &leases[0])
+	}
+	if err == nil && len(leases) == 0 {
+		err = fmt.Errorf("no lease for %s", arg)
+	}
+	return leases, data, err
+}
+
+func (c *ctl) showLease(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: leases show <mac|ip>")
+	}
+	leases, data, err := c.findLeases(args[0])
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(data)
+	}
+	w := c.table()
+	for i, l := range leases {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "IP:\t%s\n", l.IP)
+		fmt.Fprintf(w, "MAC:\t%s\n", dash(l.MAC))
+		fmt.Fprintf(w, "Client ID:\t%s\n", dash(l.ClientID))
+		fmt.Fprintf(w, "Hostname:\t%s\n", dash(l.Hostname))
+		fmt.Fprintf(w, "Scope:\t%s\n", l.Scope)
+		fmt.Fprintf(w, "State:\t%s\n", l.state())
+		fmt.Fprintf(w, "Expires:\t%s\n", formatTime(l.Expiration))
+		if l.CircuitID != "" || l.RemoteID != "" {
+			fmt.Fprintf(w, "Circuit ID:\t%s\n", dash(l.CircuitID))
+			fmt.Fprintf(w, "Remote ID:\t%s\n", dash(l.RemoteID))
+		}
+	}
+	return w.Flush()
+}
+
+func (c *ctl) releaseLease(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: leases release <mac|ip>")
+	}
+	leases, _, err := c.findLeases(args[0])
+	if err != nil {
+		return err
+	}
+	var released []string
+	for _, l := range leases {
+		if _, err := c.do(http.MethodPost, "/api/v1/leases/"+l.IP+"/release", nil); err != nil {
+			return err
+		}
+		released = append(released, l.IP)
+	}
+	c.printDone("Released %s", strings.Join(released, ", "))
+	return nil
+}
+
+type reservation struct {
+	MAC       string `json:"mac,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	CircuitID string `json:"circuit_id,omitempty"`
+	RemoteID  string `json:"remote_id,omitempty"`
+	IP        string `json:"ip"`
+	Hostname  string `json:"hostname,omitempty"`
+}
+
+func (c *ctl) listReservations(args []string) error {
+	var reservations []reservation
+	if printed, err := c.get("/api/v1/reservations", &reservations); printed || err != nil {
+		return err
+	}
+	w := c.table()
+	fmt.Fprintln(w, "IP\tMAC\tCLIENT ID\tCIRCUIT ID\tREMOTE ID\tHOSTNAME")
+	for _, r := range reservations {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.IP, dash(r.MAC), dash(r.ClientID), dash(r.CircuitID), dash(r.RemoteID), dash(r.Hostname))
+	}
+	return w.Flush()
+}
+
+func (c *ctl) addReservation(args []string) error {
+	var r reservation
+	fs := flag.NewFlagSet("reservations add", flag.ContinueOnError)
+	fs.StringVar(&r.IP, "ip", "", "reserved address")
+	fs.StringVar(&r.MAC, "mac", "", "hardware address of the client")
+	fs.StringVar(&r.ClientID, "client-id", "", "client identifier (option 61) in hex")
+	fs.StringVar(&r.CircuitID, "circuit-id", "", "relay agent circuit id, text or hex with a 0x prefix")
+	fs.StringVar(&r.RemoteID, "remote-id", "", "relay agent remote id, text or hex with a 0x prefix")
+	fs.StringVar(&r.Hostname, "hostname", "", "host name handed to the client")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if r.IP == "" {
+		return errors.New("-ip is required")
+	}
+	data, err := c.do(http.MethodPost, "/api/v1/reservations", r)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(data)
+	}
+	fmt.Fprintf(c.out, "Reserved %s\n", r.IP)
+	return nil
+}
+
+func (c *ctl) removeReservation(args []string) error {
+	if len(args) != 1 || net.ParseIP(args[0]) == nil {
+		return errors.New("usage: reservations rm <ip>")
+	}
+	if _, err := c.do(http.MethodDelete, "/api/v1/reservations/"+args[0], nil); err != nil {
+		return err
+	}
+	c.printDone("Removed reservation of %s", args[0])
+	return nil
+}
+
+type poolInfo struct {
+	Scope        string `json:"scope"`
+	Size         int    `json:"size"`
+	Used         int    `json:"used"`
+	Free         int    `json:"free"`
+	Quarantined  int    `json:"quarantined"`
+	ActiveLeases int    `json:"active_leases"`
+}
+
+func (c *ctl) poolStats(args []string) error {
+	var pools []poolInfo
+	if printed, err := c.get("/api/v1/pools", &pools); printed || err != nil {
+		return err
+	}
+	return c.printPools(pools)
+}
+
+func (c *ctl) printPools(pools []poolInfo) error {
+	w := c.table()
+	fmt.Fprintln(w, "SCOPE\tSIZE\tUSED\tFREE\tQUARANTINED\tACTIVE LEASES\tUSAGE")
+	for _, p := range pools {
+		usage := 0.0
+		if p.Size > 0 {
+			usage = 100 * float64(p.Used+p.Quarantined) / float64(p.Size)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%.1f%%\n", p.Scope, p.Size, p.Used, p.Free, p.Quarantined, p.ActiveLeases, usage)
+	}
+	return w.Flush()
+}
+
+func (c *ctl) reloadConfig(args []string) error {
+	data, err := c.do(http.MethodPost, "/api/v1/config/reload", nil)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return c.printJSON(data)
+	}
+	var pools []poolInfo
+	if err := json.Unmarshal(data, &pools); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Configuration reloaded\n\n")
+	return c.printPools(pools)
+}
+
+func (c *ctl) stats(args []string) error {
+	var stats struct {
+		Packets []struct {
+			Type    string `json:"type"`
+			Outcome string `json:"outcome"`
+			Count   uint64 `json:"count"`
+		} `json:"packets"`
+		DecodeErrors  map[string]uint64 `json:"decode_errors"`
+		QueueDepth    int               `json:"queue_depth"`
+		QueueCapacity int               `json:"queue_capacity"`
+		Probes        struct {
+			Free   uint64 `json:"free"`
+			InUse  uint64 `json:"in_use"`
+			Failed uint64 `json:"failed"`
+		} `json:"probes"`
+		Interfaces []string `json:"interfaces"`
+	}
+	if printed, err := c.get("/api/v1/stats", &stats); printed || err != nil {
+		return err
+	}
+	w := c.table()
+	fmt.Fprintln(w, "TYPE\tOUTCOME\tCOUNT")
+	for _, p := range stats.Packets {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", p.Type, p.Outcome, p.Count)
+	}
+	fmt.Fprintln(w)
+	reasons := make([]string, 0, len(stats.DecodeErrors))
+	for reason := range stats.DecodeErrors {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "Decode errors (%s):\t%d\n", reason, stats.DecodeErrors[reason])
+	}
+	fmt.Fprintf(w, "Queue:\t%d/%d\n", stats.QueueDepth, stats.QueueCapacity)
+	fmt.Fprintf(w, "Probes:\t%d free, %d in use, %d failed\n", stats.Probes.Free, stats.Probes.InUse, stats.Probes.Failed)
+	if len(stats.Interfaces) > 0 {
+		fmt.Fprintf(w, "Interfaces:\t%s\n", strings.Join(stats.Interfaces, ", "))
+	}
+	return w.Flush()
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"dhcp/client"
+	"dhcp/lease"
+	"dhcp/server"
+	"dhcp/transport"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer serves a server with a control socket and returns the path
+// of the socket.
+func newTestServer(t *testing.T, network *transport.MemoryNetwork) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "dhcpd.sock")
+	cfg := &server.Config{
+		Start:         net.ParseIP("192.168.1.100"),
+		End:           net.ParseIP("192.168.1.200"),
+		Subnet:        net.IPNet{IP: net.ParseIP("192.168.1.0"), Mask: net.IPv4Mask(255, 255, 255, 0)},
+		Lease:         time.Hour,
+		RenewalTime:   30 * time.Minute,
+		RebindingTime: 45 * time.Minute,
+		Router:        net.ParseIP("192.168.1.1"),
+		ServerIP:      net.ParseIP("192.168.1.2"),
+		ControlSocket: socket,
+	}
+	s, err := server.NewServer(cfg, server.WithTransport(network.Server()), server.WithLeaseStore(lease.NewMemoryStore()))
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Serve(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := dhcpctl(socket, "stats"); err == nil {
+			return socket
+		} else if time.Now().After(deadline) {
+			t.Fatalf("Control socket not served: %v", err)
+		}
+	}
+}
+
+func dhcpctl(socket string, args ...string) (string, error) {
+	var out bytes.Buffer
+	err := run(append([]string{"-socket", socket}, args...), &out)
+	return out.String(), err
+}
+
+func TestLeases(t *testing.T) {
+	network := transport.NewMemoryNetwork()
+	socket := newTestServer(t, network)
+	mac, _ := net.ParseMAC("4a:f3:f1:30:cd:d6")
+	ack, err := client.New(network.Client(mac), mac).Acquire()
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	ip := ack.YIAddr.String()
+
+	out, err := dhcpctl(socket, "leases", "list")
+	if err != nil {
+		t.Fatalf("leases list: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], "IP") ||
+		!strings.Contains(lines[1], ip) || !strings.Contains(lines[1], mac.String()) || !strings.Contains(lines[1], "bound") {
+		t.Errorf("Unexpected table:\n%s", out)
+	}
+
+	out, err = dhcpctl(socket, "-json", "leases", "show", mac.String())
+	if err != nil {
+		t.Fatalf("leases show: %v", err)
+	}
+	var leases []map[string]any
+	if err := json.Unmarshal([]byte(out), &leases); err != nil || len(leases) != 1 || leases[0]["ip"] != ip {
+		t.Errorf("Unexpected JSON %q: %v", out, err)
+	}
+	if out, err := dhcpctl(socket, "leases", "show", ip); err != nil || !strings.Contains(out, mac.String()) {
+		t.Errorf("Unexpected lease %q: %v", out, err)
+	}
+
+	if _, err := dhcpctl(socket, "leases", "release", mac.String()); err != nil {
+		t.Fatalf("leases release: %v", err)
+	}
+	if _, err := dhcpctl(socket, "leases", "show", ip); err == nil || err.Error() != "lease not found" {
+		t.Errorf("Expected the server's error for a released lease, got %v", err)
+	}
+	if _, err := dhcpctl(socket, "leases", "show", "nonsense"); err == nil {
+		t.Errorf("Expected an error for an invalid address")
+	}
+}
+
+func TestReservationsAndPools(t *testing.T) {
+	socket := newTestServer(t, transport.NewMemoryNetwork())
+
+	if _, err := dhcpctl(socket, "reservations", "add", "-mac", "02:00:00:00:00:09", "-ip", "192.168.1.150", "-hostname", "printer"); err != nil {
+		t.Fatalf("reservations add: %v", err)
+	}
+	if _, err := dhcpctl(socket, "reservations", "add", "-mac", "02:00:00:00:00:0a", "-ip", "10.0.0.1"); err == nil {
+		t.Errorf("Expected an error for an address outside the subnet")
+	}
+	if out, err := dhcpctl(socket, "reservations", "list"); err != nil || !strings.Contains(out, "printer") {
+		t.Errorf("Unexpected reservations %q: %v", out, err)
+	}
+
+	out, err := dhcpctl(socket, "-json", "pool", "stats")
+	if err != nil {
+		t.Fatalf("pool stats: %v", err)
+	}
+	var pools []server.PoolStats
+	if err := json.Unmarshal([]byte(out), &pools); err != nil || len(pools) != 1 || pools[0].Used != 1 {
+		t.Errorf("Unexpected pools %q: %v", out, err)
+	}
+
+	if _, err := dhcpctl(socket, "reservations", "rm", "192.168.1.150"); err != nil {
+		t.Fatalf("reservations rm: %v", err)
+	}
+	if out, err := dhcpctl(socket, "pool", "stats"); err != nil || !strings.Contains(out, "101") {
+		t.Errorf("Unexpected pool stats %q: %v", out, err)
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	socket := newTestServer(t, transport.NewMemoryNetwork())
+	if _, err := dhcpctl(socket, "config", "reload"); err == nil || !strings.Contains(err.Error(), "configuration source") {
+		t.Errorf("Expected the server's error without a configuration file, got %v", err)
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	for _, args := range [][]string{nil, {"leases"}, {"leases", "delete"}} {
+		if err := run(append([]string{"-socket", "/nonexistent"}, args...), &bytes.Buffer{}); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
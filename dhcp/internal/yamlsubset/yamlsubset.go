@@ -0,0 +1,312 @@
+// Package yamlsubset decodes the subset of YAML used by configuration files:
+// block mappings and sequences, flow sequences of scalars, comments and
+// plain, single- or double-quoted scalars. Anything else, such as flow
+// mappings, block scalars, anchors, tags or several documents, is rejected
+// rather than read as a plain string.
+package yamlsubset
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type line struct {
+	num    int
+	indent int
+	text   string
+}
+
+var number = regexp.MustCompile(`^[-+]?(\d+(\.\d*)?|\.\d+)([eE][-+]?\d+)?$`)
+
+// Parse decodes data. The result only contains values that encoding/json
+// can marshal, numbers are json.Number.
+func Parse(data []byte) (any, error) {
+	var lines []line
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(stripComment(raw), " \t\r")
+		trimmed := strings.TrimLeft(raw, " ")
+		if trimmed == "" {
+			continue
+		}
+		if trimmed == "---" && len(lines) == 0 && len(raw) == 3 {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs are not allowed for indentation", i+1)
+		}
+		if raw == trimmed && (strings.HasPrefix(raw, "---") || strings.HasPrefix(raw, "...") || strings.HasPrefix(raw, "%")) {
+			return nil, fmt.Errorf("yaml: line %d: directives and multiple documents are not supported", i+1)
+		}
+		lines = append(lines, line{num: i + 1, indent: len(raw) - len(trimmed), text: trimmed})
+	}
+	if len(lines) == 0 {
+		return map[string]any{}, nil
+	}
+
+	p := &parser{lines: lines}
+	v, err := p.parseBlock(lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		return nil, fmt.Errorf("yaml: line %d: unexpected indentation", l.num)
+	}
+	return v, nil
+}
+
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		}
+	}
+	return text
+}
+
+type parser struct {
+	lines []line
+	pos   int
+}
+
+func (p *parser) parseBlock(indent int) (any, error) {
+	if isSeqItem(p.lines[p.pos].text) {
+		return p.parseSequence(indent)
+	}
+	return p.parseMapping(indent)
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *parser) parseSequence(indent int) (any, error) {
+	items := []any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent || (l.indent == indent && !isSeqItem(l.text)) {
+			break
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("yaml: line %d: expected sequence item", l.num)
+		}
+
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if rest == "" {
+			p.pos++
+			v, err := p.parseNested(l, indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			continue
+		}
+
+		if _, _, ok := splitKey(rest); ok || isSeqItem(rest) {
+			// An inline mapping or sequence continues on the following
+			// lines at the column where its first entry starts.
+			p.lines[p.pos] = line{num: l.num, indent: l.indent + len(l.text) - len(rest), text: rest}
+			v, err := p.parseBlock(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			continue
+		}
+
+		v, err := parseScalar(rest, l.num)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, v)
+		p.pos++
+	}
+	return items, nil
+}
+
+func (p *parser) parseMapping(indent int) (any, error) {
+	m := map[string]any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("yaml: line %d: unexpected indentation", l.num)
+		}
+		key, value, ok := splitKey(l.text)
+		if !ok {
+			return nil, fmt.Errorf("yaml: line %d: expected \"key: value\"", l.num)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("yaml: line %d: duplicate key %q", l.num, key)
+		}
+		p.pos++
+
+		var v any
+		var err error
+		if value == "" {
+			v, err = p.parseNested(l, indent)
+		} else {
+			v, err = parseScalar(value, l.num)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+// parseNested parses the block that belongs to a key or sequence item with
+// no inline value. Sequences may start at the parent's indentation.
+func (p *parser) parseNested(parent line, indent int) (any, error) {
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	switch {
+	case next.indent > indent:
+		return p.parseBlock(next.indent)
+	case next.indent == indent && isSeqItem(next.text) && !isSeqItem(parent.text):
+		return p.parseSequence(indent)
+	default:
+		return nil, nil
+	}
+}
+
+func splitKey(text string) (key, value string, ok bool) {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case i == 0 && (c == '"' || c == '\''):
+			quote = c
+		case c == ':' && (i == len(text)-1 || text[i+1] == ' '):
+			key, err := parseScalar(strings.TrimSpace(text[:i]), 0)
+			if err != nil {
+				return "", "", false
+			}
+			if _, ok := key.([]any); ok {
+				return "", "", false
+			}
+			return fmt.Sprint(key), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+func parseScalar(s string, num int) (any, error) {
+	switch {
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("yaml: line %d: unterminated flow sequence", num)
+		}
+		items := []any{}
+		inner := strings.TrimSpace(s[1 : len(s)-1])
+		if inner == "" {
+			return items, nil
+		}
+		for _, part := range splitFlow(inner) {
+			part = strings.TrimSpace(part)
+			if strings.HasPrefix(part, "[") || strings.HasPrefix(part, "{") || strings.HasPrefix(part, "]") {
+				return nil, fmt.Errorf("yaml: line %d: nested flow collections are not supported", num)
+			}
+			v, err := parseScalar(part, num)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case s == "{}":
+		return map[string]any{}, nil
+	case strings.HasPrefix(s, "{"):
+		return nil, fmt.Errorf("yaml: line %d: flow mappings are not supported", num)
+	case strings.HasPrefix(s, "|") || strings.HasPrefix(s, ">"):
+		return nil, fmt.Errorf("yaml: line %d: block scalars are not supported", num)
+	case strings.HasPrefix(s, "&") || strings.HasPrefix(s, "*"):
+		return nil, fmt.Errorf("yaml: line %d: anchors and aliases are not supported", num)
+	case strings.HasPrefix(s, "!"):
+		return nil, fmt.Errorf("yaml: line %d: tags are not supported", num)
+	case strings.HasPrefix(s, "@") || strings.HasPrefix(s, "`") || strings.HasPrefix(s, "%") ||
+		strings.HasPrefix(s, "]") || strings.HasPrefix(s, "}") || strings.HasPrefix(s, ","):
+		return nil, fmt.Errorf("yaml: line %d: plain scalar cannot start with %q", num, s[0])
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("yaml: line %d: invalid quoted string %s", num, s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") || strings.Contains(strings.ReplaceAll(s[1:len(s)-1], "''", ""), "'") {
+			return nil, fmt.Errorf("yaml: line %d: invalid quoted string %s", num, s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.Contains(s, ": "):
+		return nil, fmt.Errorf("yaml: line %d: unexpected mapping in %q", num, s)
+	}
+
+	switch s {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if number.MatchString(s) {
+		return parseNumber(s, num)
+	}
+	return s, nil
+}
+
+// parseNumber returns s in the form JSON accepts, e.g. 7 for 007 and 0.5
+// for .5.
+func parseNumber(s string, num int) (json.Number, error) {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return json.Number(strconv.FormatInt(n, 10)), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return "", fmt.Errorf("yaml: line %d: number %s is out of range", num, s)
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+}
+
+func splitFlow(s string) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
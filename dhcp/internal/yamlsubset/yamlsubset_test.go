@@ -0,0 +1,104 @@
+package yamlsubset
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	data := `
+---
+hosts:
+- mac: 00:11:22:33:44:55
+  ip: 10.0.0.5
+  options:
+    tags: [a, "b, c"]
+- mac: 00:11:22:33:44:66
+nested:
+  empty: []
+  map: {}
+  none:
+  quoted: 'it''s # not a comment'
+  number: 42
+`
+	got, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	want := map[string]any{
+		"hosts": []any{
+			map[string]any{
+				"mac":     "00:11:22:33:44:55",
+				"ip":      "10.0.0.5",
+				"options": map[string]any{"tags": []any{"a", "b, c"}},
+			},
+			map[string]any{"mac": "00:11:22:33:44:66"},
+		},
+		"nested": map[string]any{
+			"empty":  []any{},
+			"map":    map[string]any{},
+			"none":   nil,
+			"quoted": "it's # not a comment",
+			"number": json.Number("42"),
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse = %#v, want %#v", got, want)
+	}
+}
+
+func TestParseUnsupported(t *testing.T) {
+	testCases := []struct {
+		name, data, err string
+	}{
+		{"flow mapping", "key: {a: 1}\n", "flow mappings"},
+		{"flow mapping in sequence", "key: [{a: 1}]\n", "nested flow"},
+		{"nested flow sequence", "key: [a, [b]]\n", "nested flow"},
+		{"literal block scalar", "key: |\n  text\n", "block scalars"},
+		{"folded block scalar", "key: >-\n  text\n", "block scalars"},
+		{"anchor", "key: &a value\n", "anchors"},
+		{"alias", "key: *a\n", "anchors"},
+		{"tag", "key: !!str 1\n", "tags"},
+		{"second document", "a: 1\n---\nb: 2\n", "multiple documents"},
+		{"document end", "a: 1\n...\n", "multiple documents"},
+		{"directive", "%YAML 1.2\n---\na: 1\n", "directives"},
+		{"mapping in a plain scalar", "key: a: b\n", "unexpected mapping"},
+		{"reserved indicator", "key: @value\n", "cannot start"},
+		{"unterminated quote", "key: \"value\n", "invalid quoted string"},
+		{"stray quote", "key: 'it's'\n", "invalid quoted string"},
+		{"tab indentation", "key:\n\t- a\n", "tabs"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tc.data)); err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("Expected an error about %q, got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	if example, err := os.ReadFile("../../config.example.yaml"); err == nil {
+		f.Add(example)
+	}
+	for _, seed := range []string{
+		"a: 1\n",
+		"- a\n- b: [c, 'd']\n  e: \"f\"\n",
+		"a:\n- b\n-\n  - c\n",
+		"a: {}\nb: []\nc: ~\n",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, err := Parse(data)
+		if err != nil {
+			return
+		}
+		if _, err := json.Marshal(v); err != nil {
+			t.Errorf("Result of %q does not marshal: %v", data, err)
+		}
+	})
+}
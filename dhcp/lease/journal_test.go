@@ -0,0 +1,184 @@
+package lease
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournalReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dhcpd.leases")
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	now := time.Now().UTC().Truncate(time.Second)
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+	records := []Record{
+		{Op: OpOffer, IP: net.IPv4(10, 0, 0, 10).To4(), MAC: mac, Expiration: now.Add(time.Minute), Time: now},
+		{Op: OpAck, IP: net.IPv4(10, 0, 0, 10).To4(), MAC: mac, HType: 1, ClientID: []byte{0xff, 1, 2, 3},
+			Expiration: now.Add(time.Hour), Time: now, CircuitID: []byte("Gi1/0/7"), RemoteID: []byte{0, 1, 2, 3, 4, 5}, Hostname: "printer"},
+		{Op: OpOffer, IP: net.IPv4(10, 0, 0, 11).To4(), MAC: mac, Expiration: now.Add(time.Minute), Time: now},
+		{Op: OpDecline, IP: net.IPv4(10, 0, 0, 11).To4(), MAC: mac, Expiration: now.Add(time.Hour), Time: now},
+		{Op: OpOffer, IP: net.IPv4(10, 0, 0, 12).To4(), MAC: mac, Expiration: now.Add(time.Minute), Time: now},
+		{Op: OpRelease, IP: net.IPv4(10, 0, 0, 12).To4(), MAC: mac, Time: now},
+	}
+	for _, rec := range records {
+		if err := j.Append(rec); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	j.Close()
+
+	j, err = OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+	defer j.Close()
+	active, err := Load(j)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(active) != 2 {
+		t.Fatalf("Expected 2 active records, got %d", len(active))
+	}
+	if q := active[1]; q.Op != OpDecline || !q.IP.Equal(records[3].IP) || !q.Expiration.Equal(records[3].Expiration) {
+		t.Errorf("Expected the declined address to stay quarantined, got %+v", q)
+	}
+	got := active[0]
+	if got.Op != OpAck || !got.IP.Equal(records[1].IP) || got.MAC.String() != mac.String() || !got.Expiration.Equal(records[1].Expiration) {
+		t.Errorf("Unexpected active lease %+v", got)
+	}
+	if got.HType != 1 || !bytes.Equal(got.ClientID, records[1].ClientID) {
+		t.Errorf("Expected the client identity to survive replay, got %d and %x", got.HType, got.ClientID)
+	}
+	if string(got.CircuitID) != "Gi1/0/7" || !bytes.Equal(got.RemoteID, records[1].RemoteID) {
+		t.Errorf("Expected relay agent ids to survive replay, got %q and %x", got.CircuitID, got.RemoteID)
+	}
+	if got.Hostname != "printer" {
+		t.Errorf("Expected the hostname to survive replay, got %q", got.Hostname)
+	}
+}
+
+func TestJournalTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dhcpd.leases")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+	rec := Record{Op: OpAck, IP: net.IPv4(10, 0, 0, 10).To4(), Expiration: time.Now().Add(time.Hour), Time: time.Now()}
+	if err := j.Append(rec); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	j.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"release","ip":"10.0`)
+	f.Close()
+
+	j, err = OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+	defer j.Close()
+	rec.IP = net.IPv4(10, 0, 0, 12).To4()
+	if err := j.Append(rec); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	active, err := Load(j)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(active) != 2 {
+		t.Errorf("Expected 2 active leases after dropping torn entry, got %d", len(active))
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dhcpd.leases")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+	defer j.Close()
+	for i := 0; i < 10; i++ {
+		j.Append(Record{Op: OpAck, IP: net.IPv4(10, 0, 0, byte(i)).To4(), Time: time.Now()})
+		j.Append(Record{Op: OpRelease, IP: net.IPv4(10, 0, 0, byte(i)).To4(), Time: time.Now()})
+	}
+	keep := Record{Op: OpAck, IP: net.IPv4(10, 0, 0, 42).To4(), Time: time.Now()}
+	if err := j.Compact([]Record{keep}); err != nil {
+		t.Fatalf("Compact: %v", err)
+	}
+	if err := j.Append(Record{Op: OpAck, IP: net.IPv4(10, 0, 0, 43).To4(), Time: time.Now()}); err != nil {
+		t.Fatalf("Append after compact: %v", err)
+	}
+	active, err := Load(j)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(active) != 2 || !active[0].IP.Equal(keep.IP) {
+		t.Errorf("Unexpected records after compaction: %+v", active)
+	}
+}
+
+func TestLoadOrdersByIP(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryStore(
+		Record{Op: OpAck, IP: net.IPv4(10, 0, 0, 20).To4(), Time: now},
+		Record{Op: OpAck, IP: net.IPv4(10, 0, 0, 3).To4(), Time: now},
+		Record{Op: OpAck, IP: net.IPv4(10, 0, 0, 11).To4(), Time: now},
+	)
+	active, err := Load(store)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for i, want := range []byte{3, 11, 20} {
+		if !active[i].IP.Equal(net.IPv4(10, 0, 0, want)) {
+			t.Errorf("Expected 10.0.0.%d at %d, got %s", want, i, active[i].IP)
+		}
+	}
+}
+
+func TestLoadReservations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dhcpd.leases")
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+	now := time.Now()
+	ip := net.IPv4(10, 0, 0, 10).To4()
+	for _, rec := range []Record{
+		{Op: OpAck, IP: ip, MAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 1}, Expiration: now.Add(time.Hour), Time: now},
+		{Op: OpReserve, IP: ip, Time: now, Reservation: []byte(`{"mac":"02:00:00:00:00:01","ip":"10.0.0.10"}`)},
+		{Op: OpReserve, IP: net.IPv4(10, 0, 0, 11).To4(), Time: now, Reservation: []byte(`{"ip":"10.0.0.11"}`)},
+		{Op: OpUnreserve, IP: net.IPv4(10, 0, 0, 11).To4(), Time: now},
+	} {
+		if err := j.Append(rec); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	j.Close()
+
+	j, err = OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+	defer j.Close()
+	active, err := Load(j)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(active) != 2 || active[0].Op != OpReserve || active[1].Op != OpAck {
+		t.Fatalf("Expected the reservation ahead of the lease, got %+v", active)
+	}
+	if string(active[0].Reservation) != `{"mac":"02:00:00:00:00:01","ip":"10.0.0.10"}` {
+		t.Errorf("Expected the reservation to survive replay, got %s", active[0].Reservation)
+	}
+}
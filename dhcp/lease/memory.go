@@ -0,0 +1,51 @@
+package lease
+
+import "sync"
+
+// MemoryStore keeps records in memory only. It is meant for tests and for
+// running without persistence.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+func NewMemoryStore(records ...Record) *MemoryStore {
+	return &MemoryStore{records: records}
+}
+
+func (m *MemoryStore) Append(rec Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, rec)
+	return nil
+}
+
+func (m *MemoryStore) Replay(fn func(Record) error) error {
+	m.mu.Lock()
+	records := append([]Record(nil), m.records...)
+	m.mu.Unlock()
+
+	for _, rec := range records {
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *MemoryStore) Compact(active []Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append([]Record(nil), active...)
+	return nil
+}
+
+func (m *MemoryStore) Records() []Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Record(nil), m.records...)
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,199 @@
+package lease
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Op string
+
+const (
+	OpOffer   Op = "offer"
+	OpAck     Op = "ack"
+	OpRelease Op = "release"
+	OpDecline Op = "decline"
+	OpExpire  Op = "expire"
+	// OpConflict records an address another host answered a probe for.
+	OpConflict Op = "conflict"
+	// OpReserve and OpUnreserve record reservations added and removed at
+	// runtime. They do not bind the address.
+	OpReserve   Op = "reserve"
+	OpUnreserve Op = "unreserve"
+)
+
+// Quarantined reports whether the op keeps the address out of the pool until
+// the record's expiration rather than binding it to a client.
+func (op Op) Quarantined() bool {
+	return op == OpDecline || op == OpConflict
+}
+
+// Record is a single lease state change as written to a Store.
+type Record struct {
+	Op  Op
+	IP  net.IP
+	MAC net.HardwareAddr
+	// HType is the hardware type of MAC, 0 for records written before it
+	// was recorded, which are all Ethernet.
+	HType byte
+	// ClientID is the client identifier (option 61) the client sent.
+	ClientID   []byte
+	Expiration time.Time
+	Time       time.Time
+	// CircuitID and RemoteID are the relay agent sub-options (option 82)
+	// the client was seen with.
+	CircuitID []byte
+	RemoteID  []byte
+	// Hostname is the host name (option 12) the client sent.
+	Hostname string
+	// Reservation is the reservation of an OpReserve record, as encoded by
+	// the server.
+	Reservation json.RawMessage
+}
+
+type recordJSON struct {
+	Op          Op              `json:"op"`
+	IP          string          `json:"ip"`
+	MAC         string          `json:"mac,omitempty"`
+	HType       byte            `json:"htype,omitempty"`
+	ClientID    string          `json:"client_id,omitempty"`
+	Expiration  time.Time       `json:"expiration,omitempty"`
+	Time        time.Time       `json:"time"`
+	CircuitID   string          `json:"circuit_id,omitempty"`
+	RemoteID    string          `json:"remote_id,omitempty"`
+	Hostname    string          `json:"hostname,omitempty"`
+	Reservation json.RawMessage `json:"reservation,omitempty"`
+}
+
+func (r Record) MarshalJSON() ([]byte, error) {
+	return json.Marshal(recordJSON{
+		Op:          r.Op,
+		IP:          r.IP.String(),
+		MAC:         r.MAC.String(),
+		HType:       r.HType,
+		ClientID:    hex.EncodeToString(r.ClientID),
+		Expiration:  r.Expiration,
+		Time:        r.Time,
+		CircuitID:   hex.EncodeToString(r.CircuitID),
+		RemoteID:    hex.EncodeToString(r.RemoteID),
+		Hostname:    r.Hostname,
+		Reservation: r.Reservation,
+	})
+}
+
+func (r *Record) UnmarshalJSON(data []byte) error {
+	var aux recordJSON
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	ip := net.ParseIP(aux.IP).To4()
+	if ip == nil {
+		return fmt.Errorf("invalid lease IP %q", aux.IP)
+	}
+	mac, err := parseHardwareAddr(aux.MAC)
+	if err != nil {
+		return fmt.Errorf("invalid lease MAC %q: %w", aux.MAC, err)
+	}
+	clientID, err := hex.DecodeString(aux.ClientID)
+	if err != nil {
+		return fmt.Errorf("invalid lease client id %q: %w", aux.ClientID, err)
+	}
+	circuitID, err := hex.DecodeString(aux.CircuitID)
+	if err != nil {
+		return fmt.Errorf("invalid lease circuit id %q: %w", aux.CircuitID, err)
+	}
+	remoteID, err := hex.DecodeString(aux.RemoteID)
+	if err != nil {
+		return fmt.Errorf("invalid lease remote id %q: %w", aux.RemoteID, err)
+	}
+	*r = Record{
+		Op:          aux.Op,
+		IP:          ip,
+		MAC:         mac,
+		HType:       aux.HType,
+		Expiration:  aux.Expiration,
+		Time:        aux.Time,
+		Hostname:    aux.Hostname,
+		Reservation: aux.Reservation,
+	}
+	if len(clientID) > 0 {
+		r.ClientID = clientID
+	}
+	if len(circuitID) > 0 {
+		r.CircuitID = circuitID
+	}
+	if len(remoteID) > 0 {
+		r.RemoteID = remoteID
+	}
+	return nil
+}
+
+// parseHardwareAddr parses a colon separated hardware address of any length,
+// as written by net.HardwareAddr.String. net.ParseMAC only accepts the
+// lengths of IEEE addresses.
+func parseHardwareAddr(s string) (net.HardwareAddr, error) {
+	if s == "" {
+		return nil, nil
+	}
+	return hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+}
+
+// Store persists lease state changes. Records are appended in the order the
+// server applies them and replayed in the same order on startup.
+type Store interface {
+	Append(rec Record) error
+	Replay(fn func(Record) error) error
+	Close() error
+}
+
+// Compacter is implemented by stores that can replace their history with
+// the set of currently active records.
+type Compacter interface {
+	Compact(active []Record) error
+}
+
+// Load replays the store and returns the records that still hold an address,
+// ordered by IP. Declined and conflicting addresses hold theirs until a
+// release or expire record for the address follows. Reservations are
+// returned until an unreserve record for the address follows, ahead of the
+// lease of the same address.
+func Load(s Store) ([]Record, error) {
+	active := make(map[string]Record)
+	reserved := make(map[string]Record)
+	err := s.Replay(func(rec Record) error {
+		key := rec.IP.String()
+		switch rec.Op {
+		case OpOffer, OpAck, OpDecline, OpConflict:
+			active[key] = rec
+		case OpRelease, OpExpire:
+			delete(active, key)
+		case OpReserve:
+			reserved[key] = rec
+		case OpUnreserve:
+			delete(reserved, key)
+		default:
+			return fmt.Errorf("unknown lease op %q", rec.Op)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]Record, 0, len(active)+len(reserved))
+	for _, rec := range reserved {
+		records = append(records, rec)
+	}
+	for _, rec := range active {
+		records = append(records, rec)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return bytes.Compare(records[i].IP.To4(), records[j].IP.To4()) < 0
+	})
+	return records, nil
+}
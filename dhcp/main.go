@@ -2,26 +2,116 @@ package main
 
 import (
 	"dhcp/server"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net"
+	"os"
+	"strings"
 	"time"
 )
 
+type overrides []func(*server.Config)
+
+func (o *overrides) ip(name, usage string, set func(*server.Config, net.IP)) {
+	flag.Func(name, usage, func(v string) error {
+		ip := net.ParseIP(v)
+		if ip == nil {
+			return fmt.Errorf("invalid IP address %q", v)
+		}
+		*o = append(*o, func(cfg *server.Config) { set(cfg, ip) })
+		return nil
+	})
+}
+
+func (o *overrides) ips(name, usage string, set func(*server.Config, []net.IP)) {
+	flag.Func(name, usage, func(v string) error {
+		var ips []net.IP
+		for _, s := range strings.Split(v, ",") {
+			ip := net.ParseIP(strings.TrimSpace(s))
+			if ip == nil {
+				return fmt.Errorf("invalid IP address %q", s)
+			}
+			ips = append(ips, ip)
+		}
+		*o = append(*o, func(cfg *server.Config) { set(cfg, ips) })
+		return nil
+	})
+}
+
+func (o *overrides) duration(name, usage string, set func(*server.Config, time.Duration)) {
+	flag.Func(name, usage, func(v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*o = append(*o, func(cfg *server.Config) { set(cfg, d) })
+		return nil
+	})
+}
+
+func (o *overrides) string(name, usage string, set func(*server.Config, string)) {
+	flag.Func(name, usage, func(v string) error {
+		*o = append(*o, func(cfg *server.Config) { set(cfg, v) })
+		return nil
+	})
+}
+
 func main() {
-	config := server.Config{
-		Start:         net.IP{172, 20, 0, 10},
-		End:           net.IP{172, 20, 0, 20},
-		Subnet:        net.IPNet{IP: net.IP{172, 20, 0, 0}, Mask: net.IPMask{255, 255, 0, 0}},
-		Lease:         10 * time.Minute,
-		RenewalTime:   5 * time.Minute, // 50%
-		RebindingTime: 8 * time.Minute, // 80%
-		DNS:           []net.IP{{8, 8, 8, 8}, {8, 8, 4, 4}},
-		Router:        net.IP{172, 20, 0, 1},
-		ServerIP:      net.IP{172, 20, 0, 2},
-		DomainName:    "DHCP TEST",
+	configPath := flag.String("config", "", "path to a YAML or JSON configuration file")
+
+	var o overrides
+	o.ip("start", "first address of the pool", func(c *server.Config, ip net.IP) { c.Start = ip })
+	o.ip("end", "last address of the pool", func(c *server.Config, ip net.IP) { c.End = ip })
+	o.ip("router", "default gateway handed to clients", func(c *server.Config, ip net.IP) { c.Router = ip })
+	o.ip("server-ip", "server identifier address", func(c *server.Config, ip net.IP) { c.ServerIP = ip })
+	o.ips("dns", "comma separated DNS servers", func(c *server.Config, ips []net.IP) { c.DNS = ips })
+	o.duration("lease", "lease duration", func(c *server.Config, d time.Duration) { c.Lease = d })
+	o.duration("renewal-time", "renewal (T1) time", func(c *server.Config, d time.Duration) { c.RenewalTime = d })
+	o.duration("rebinding-time", "rebinding (T2) time", func(c *server.Config, d time.Duration) { c.RebindingTime = d })
+	o.string("domain-name", "domain name handed to clients", func(c *server.Config, s string) { c.DomainName = s })
+	o.string("lease-file", "path of the lease journal", func(c *server.Config, s string) { c.LeaseFile = s })
+	o.string("metrics-addr", "address to serve Prometheus metrics on", func(c *server.Config, s string) { c.MetricsAddr = s })
+	o.string("control-socket", "path of the dhcpctl control socket", func(c *server.Config, s string) { c.ControlSocket = s })
+	flag.Func("subnet", "served network in CIDR notation", func(v string) error {
+		_, subnet, err := net.ParseCIDR(v)
+		if err != nil {
+			return err
+		}
+		o = append(o, func(c *server.Config) { c.Subnet = *subnet })
+		return nil
+	})
+	flag.Parse()
+
+	// load reads the configuration file, if any, and applies the flags on
+	// top. It runs again when the configuration is reloaded.
+	load := func() (*server.Config, error) {
+		config := &server.Config{}
+		if *configPath != "" {
+			var err error
+			if config, err = server.LoadConfig(*configPath); err != nil {
+				return nil, err
+			}
+		}
+		for _, apply := range o {
+			apply(config)
+		}
+		return config, nil
+	}
+	config, err := load()
+	if err != nil {
+		slog.Error("Error loading configuration", "error", err)
+		os.Exit(1)
+	}
+
+	var opts []server.Option
+	if *configPath != "" {
+		opts = append(opts, server.WithConfigSource(load))
 	}
-	s, err := server.NewServer(&config)
+	s, err := server.NewServer(config, opts...)
 	if err != nil {
-		panic(err)
+		slog.Error("Error starting server", "error", err)
+		os.Exit(1)
 	}
 	s.Run()
 }
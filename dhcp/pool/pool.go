@@ -1,61 +1,316 @@
 package pool
 
 import (
+	"errors"
 	"fmt"
+	"math/bits"
 	"net"
+	"sort"
 	"sync"
+	"sync/atomic"
 )
 
+var ErrInvalidRange = errors.New("invalid IP range")
+
+// Range is an inclusive range of IPv4 addresses.
+type Range struct {
+	Start net.IP
+	End   net.IP
+}
+
+// span is a range with the bitmap index of its first address.
+type span struct {
+	start, end uint32
+	offset     int
+}
+
+// Stats describes the utilization of a pool. Size counts the addresses of
+// all ranges without the excluded ones, Free + Allocated == Size.
+type Stats struct {
+	Size      int
+	Free      int
+	Allocated int
+	Excluded  int
+}
+
+// IPPool hands out never-used addresses first and released ones in the
+// order they were released, so an address that expired stays free as long
+// as possible for its previous owner to come back.
+//
+// Addresses are tracked in bitmaps, one bit per address of the ranges, so a
+// /8 needs a few megabytes. Allocating a never-used address scans forward
+// from a cursor that only moves ahead, released addresses are kept in a FIFO.
+//
+// The bitmap words are updated with atomic operations, so allocating a
+// never-used address, Take, Contains and Stats do not lock. Only Release and
+// allocating from the FIFO, which has to keep its order, take the mutex.
 type IPPool struct {
-	start     uint32
-	end       uint32
-	available []uint32
-	m         sync.Mutex
+	spans []span
+	size  int
+	nExcl int
+	// excluded does not change after New.
+	excluded bitmap
+
+	free  atomicBitmap
+	used  atomicBitmap
+	nFree atomic.Int64
+	// cursor is the first bitmap word that may still hold a never-used
+	// free address.
+	cursor atomic.Int64
+
+	// m guards the release FIFO. released holds it from head on. queued
+	// holds the sequence number of the latest release of each queued
+	// address, entries of earlier releases are stale.
+	m        sync.Mutex
+	released []release
+	head     int
+	queued   map[int]uint64
+	seq      uint64
+}
+
+type release struct {
+	index int
+	seq   uint64
 }
 
+// NewIPPool returns a pool of the addresses from start to end.
 func NewIPPool(start, end net.IP) (*IPPool, error) {
-	startInt := ip4ToUint32(start)
-	endInt := ip4ToUint32(end)
-	if startInt > endInt {
-		return nil, fmt.Errorf("invalid IP range")
+	return New([]Range{{Start: start, End: end}})
+}
+
+// New returns a pool of the given disjoint ranges without the addresses in
+// exclude. Exclusions may reach outside the ranges.
+func New(ranges []Range, exclude ...Range) (*IPPool, error) {
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("%w: no ranges", ErrInvalidRange)
+	}
+	p := &IPPool{queued: make(map[int]uint64)}
+	for _, r := range ranges {
+		start, end, err := parseRange(r)
+		if err != nil {
+			return nil, err
+		}
+		p.spans = append(p.spans, span{start: start, end: end})
+	}
+	sort.Slice(p.spans, func(i, j int) bool { return p.spans[i].start < p.spans[j].start })
+	for i := range p.spans {
+		if i > 0 && p.spans[i].start <= p.spans[i-1].end {
+			return nil, fmt.Errorf("%w: %s-%s overlaps %s-%s", ErrInvalidRange,
+				uint32ToIP4(p.spans[i].start), uint32ToIP4(p.spans[i].end),
+				uint32ToIP4(p.spans[i-1].start), uint32ToIP4(p.spans[i-1].end))
+		}
+		p.spans[i].offset = p.size
+		p.size += int(p.spans[i].end-p.spans[i].start) + 1
 	}
 
-	pool := &IPPool{
-		start:     startInt,
-		end:       endInt,
-		available: make([]uint32, 0, endInt-startInt+1),
+	p.free = make(atomicBitmap, (p.size+63)/64)
+	p.used = make(atomicBitmap, (p.size+63)/64)
+	p.excluded = newBitmap(p.size)
+	p.free.setRange(0, p.size)
+	p.nFree.Store(int64(p.size))
+	for _, r := range exclude {
+		start, end, err := parseRange(r)
+		if err != nil {
+			return nil, err
+		}
+		p.exclude(start, end)
 	}
+	return p, nil
+}
+
+func parseRange(r Range) (uint32, uint32, error) {
+	start, ok := ip4ToUint32(r.Start)
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: %s is not an IPv4 address", ErrInvalidRange, r.Start)
+	}
+	end, ok := ip4ToUint32(r.End)
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: %s is not an IPv4 address", ErrInvalidRange, r.End)
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("%w: %s is after %s", ErrInvalidRange, r.Start, r.End)
+	}
+	return start, end, nil
+}
+
+func (p *IPPool) exclude(start, end uint32) {
+	for _, s := range p.spans {
+		lo, hi := max(start, s.start), min(end, s.end)
+		if lo > hi {
+			continue
+		}
+		from, to := s.offset+int(lo-s.start), s.offset+int(hi-s.start)+1
+		for i := from; i < to; i++ {
+			if p.excluded.get(i) {
+				continue
+			}
+			p.excluded.set(i)
+			if p.free.clear(i) {
+				p.nFree.Add(-1)
+			}
+			p.nExcl++
+		}
+	}
+}
 
-	for ip := startInt; ip <= endInt; ip++ {
-		pool.available = append(pool.available, ip)
+// index returns the bitmap index of ip.
+func (p *IPPool) index(ip net.IP) (int, bool) {
+	n, ok := ip4ToUint32(ip)
+	if !ok {
+		return 0, false
 	}
+	i := sort.Search(len(p.spans), func(i int) bool { return p.spans[i].end >= n })
+	if i == len(p.spans) || n < p.spans[i].start {
+		return 0, false
+	}
+	return p.spans[i].offset + int(n-p.spans[i].start), true
+}
 
-	return pool, nil
+func (p *IPPool) ipAt(index int) net.IP {
+	i := sort.Search(len(p.spans), func(i int) bool {
+		return p.spans[i].offset+int(p.spans[i].end-p.spans[i].start) >= index
+	})
+	s := p.spans[i]
+	return uint32ToIP4(s.start + uint32(index-s.offset))
 }
 
+// Allocate returns a free address, or nil when the pool is exhausted.
 func (p *IPPool) Allocate() net.IP {
-	if len(p.available) == 0 {
+	if p.nFree.Load() == 0 {
 		return nil
 	}
+	if ip := p.allocateNew(); ip != nil {
+		return ip
+	}
 	p.m.Lock()
-	ip := p.available[0]
-	p.available = p.available[1:]
-	p.m.Unlock()
-	return uint32ToIP4(ip)
+	defer p.m.Unlock()
+	for p.head < len(p.released) {
+		r := p.released[p.head]
+		p.head++
+		if p.head*2 >= len(p.released) {
+			// Drop the consumed front so it does not pin the backing array.
+			n := copy(p.released, p.released[p.head:])
+			p.released, p.head = p.released[:n], 0
+		}
+		if p.queued[r.index] != r.seq {
+			continue
+		}
+		delete(p.queued, r.index)
+		if p.take(r.index) {
+			return p.ipAt(r.index)
+		}
+	}
+	return nil
 }
 
+// allocateNew takes the first never-used free address without locking.
+// Never-used addresses only ever become used, so the cursor can move past
+// words that have none left.
+func (p *IPPool) allocateNew() net.IP {
+	for c := int(p.cursor.Load()); c < len(p.free); {
+		w := p.free[c].Load() &^ p.used[c].Load()
+		if w == 0 {
+			p.cursor.CompareAndSwap(int64(c), int64(c+1))
+			c = max(c+1, int(p.cursor.Load()))
+			continue
+		}
+		// Another allocation may win the bit, the word is then tried again.
+		if i := c*64 + bits.TrailingZeros64(w); p.take(i) {
+			return p.ipAt(i)
+		}
+	}
+	return nil
+}
+
+// take marks the free address i as used, reporting whether it was free.
+func (p *IPPool) take(i int) bool {
+	if !p.free.clear(i) {
+		return false
+	}
+	p.used.set(i)
+	p.nFree.Add(-1)
+	return true
+}
+
+// Take removes ip from the free list, reporting whether it was available.
+func (p *IPPool) Take(ip net.IP) bool {
+	i, ok := p.index(ip)
+	return ok && p.take(i)
+}
+
+// Release returns ip to the pool. Addresses outside the ranges, excluded
+// ones and addresses that are already free are ignored.
 func (p *IPPool) Release(ip net.IP) {
-	ipInt := ip4ToUint32(ip)
-	if ipInt >= p.start && ipInt <= p.end {
-		p.m.Lock()
-		p.available = append(p.available, ipInt)
-		p.m.Unlock()
+	i, ok := p.index(ip)
+	if !ok || p.excluded.get(i) {
+		return
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	if !p.free.set(i) {
+		return
+	}
+	p.nFree.Add(1)
+	// An address released again while queued moves to the back.
+	p.seq++
+	p.queued[i] = p.seq
+	p.released = append(p.released, release{index: i, seq: p.seq})
+}
+
+// Contains reports whether ip is part of the pool's ranges and not excluded.
+func (p *IPPool) Contains(ip net.IP) bool {
+	i, ok := p.index(ip)
+	return ok && !p.excluded.get(i)
+}
+
+func (p *IPPool) Stats() Stats {
+	size, free := p.size-p.nExcl, int(p.nFree.Load())
+	return Stats{Size: size, Free: free, Allocated: size - free, Excluded: p.nExcl}
+}
+
+type bitmap []uint64
+
+func newBitmap(n int) bitmap {
+	return make(bitmap, (n+63)/64)
+}
+
+func (b bitmap) get(i int) bool { return b[i/64]&(1<<(i%64)) != 0 }
+func (b bitmap) set(i int)      { b[i/64] |= 1 << (i % 64) }
+
+// atomicBitmap is a bitmap whose words are accessed atomically.
+type atomicBitmap []atomic.Uint64
+
+// set sets bit i, reporting whether it was clear.
+func (b atomicBitmap) set(i int) bool {
+	mask := uint64(1) << (i % 64)
+	return b[i/64].Or(mask)&mask == 0
+}
+
+// clear clears bit i, reporting whether it was set.
+func (b atomicBitmap) clear(i int) bool {
+	mask := uint64(1) << (i % 64)
+	return b[i/64].And(^mask)&mask != 0
+}
+
+// setRange sets the bits [from, to).
+func (b atomicBitmap) setRange(from, to int) {
+	for ; from < to && from%64 != 0; from++ {
+		b.set(from)
+	}
+	for ; from+64 <= to; from += 64 {
+		b[from/64].Store(^uint64(0))
+	}
+	for ; from < to; from++ {
+		b.set(from)
 	}
 }
 
-func ip4ToUint32(ip net.IP) uint32 {
+func ip4ToUint32(ip net.IP) (uint32, bool) {
 	ip = ip.To4()
-	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+	if ip == nil {
+		return 0, false
+	}
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3]), true
 }
 
 func uint32ToIP4(n uint32) net.IP {
@@ -0,0 +1,292 @@
+package pool
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestTake(t *testing.T) {
+	p, err := NewIPPool(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Take(net.ParseIP("10.0.0.2")) {
+		t.Fatalf("Expected 10.0.0.2 to be available")
+	}
+	if p.Take(net.ParseIP("10.0.0.2")) {
+		t.Errorf("Expected 10.0.0.2 to be taken only once")
+	}
+	if p.Take(net.ParseIP("10.0.0.9")) {
+		t.Errorf("Expected address outside the range to be unavailable")
+	}
+	for _, want := range []string{"10.0.0.1", "10.0.0.3", ""} {
+		got := p.Allocate()
+		if want == "" {
+			if got != nil {
+				t.Errorf("Expected empty pool, got %s", got)
+			}
+			continue
+		}
+		if !got.Equal(net.ParseIP(want)) {
+			t.Errorf("Allocate = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestAllocationOrder(t *testing.T) {
+	p, err := NewIPPool(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b := p.Allocate(), p.Allocate()
+	p.Release(b)
+	p.Release(a)
+	for _, want := range []string{"10.0.0.3", "10.0.0.4", "10.0.0.2", "10.0.0.1"} {
+		if got := p.Allocate(); !got.Equal(net.ParseIP(want)) {
+			t.Errorf("Allocate = %s, want %s", got, want)
+		}
+	}
+}
+
+func TestReleaseOrderAfterTake(t *testing.T) {
+	p, err := NewIPPool(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, b, c := p.Allocate(), p.Allocate(), p.Allocate()
+	p.Release(a)
+	p.Release(b)
+	// a is taken and released again while its first release is queued.
+	p.Take(a)
+	p.Release(a)
+	p.Release(c)
+	for _, want := range []net.IP{b, a, c, nil} {
+		if got := p.Allocate(); !got.Equal(want) {
+			t.Errorf("Allocate = %s, want %s", got, want)
+		}
+	}
+	if n := len(p.released) - p.head; n != 0 {
+		t.Errorf("Expected the released queue to be empty, got %d entries", n)
+	}
+}
+
+func TestRangesAndExclusions(t *testing.T) {
+	p, err := New([]Range{
+		{Start: net.ParseIP("10.0.1.1"), End: net.ParseIP("10.0.1.3")},
+		{Start: net.ParseIP("10.0.0.1"), End: net.ParseIP("10.0.0.4")},
+	}, Range{Start: net.ParseIP("10.0.0.2"), End: net.ParseIP("10.0.0.3")}, Range{Start: net.ParseIP("10.0.1.3"), End: net.ParseIP("10.0.9.9")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Stats{Size: 4, Free: 4, Excluded: 3}); p.Stats() != want {
+		t.Errorf("Expected %+v, got %+v", want, p.Stats())
+	}
+	if p.Take(net.ParseIP("10.0.0.2")) || p.Contains(net.ParseIP("10.0.0.2")) {
+		t.Errorf("Expected 10.0.0.2 to be excluded")
+	}
+	p.Release(net.ParseIP("10.0.0.3"))
+	for _, want := range []string{"10.0.0.1", "10.0.0.4", "10.0.1.1", "10.0.1.2", ""} {
+		got := p.Allocate()
+		if want == "" {
+			if got != nil {
+				t.Errorf("Expected empty pool, got %s", got)
+			}
+			continue
+		}
+		if !got.Equal(net.ParseIP(want)) {
+			t.Errorf("Allocate = %s, want %s", got, want)
+		}
+	}
+	if want := (Stats{Size: 4, Allocated: 4, Excluded: 3}); p.Stats() != want {
+		t.Errorf("Expected %+v, got %+v", want, p.Stats())
+	}
+	p.Release(net.ParseIP("10.0.1.2"))
+	p.Release(net.ParseIP("10.0.1.2"))
+	if s := p.Stats(); s.Free != 1 {
+		t.Errorf("Expected a double release to count once, got %+v", s)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	for name, ranges := range map[string][]Range{
+		"none":     nil,
+		"reversed": {{Start: net.ParseIP("10.0.0.9"), End: net.ParseIP("10.0.0.1")}},
+		"ipv6":     {{Start: net.ParseIP("::1"), End: net.ParseIP("::2")}},
+		"overlap": {
+			{Start: net.ParseIP("10.0.0.1"), End: net.ParseIP("10.0.0.9")},
+			{Start: net.ParseIP("10.0.0.9"), End: net.ParseIP("10.0.0.20")},
+		},
+	} {
+		if _, err := New(ranges); !errors.Is(err, ErrInvalidRange) {
+			t.Errorf("%s: expected ErrInvalidRange, got %v", name, err)
+		}
+	}
+}
+
+func TestConcurrentAllocate(t *testing.T) {
+	p, err := NewIPPool(net.ParseIP("10.0.0.0"), net.ParseIP("10.0.3.255"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := p.Allocate(); ip != nil; ip = p.Allocate() {
+				mu.Lock()
+				if seen[ip.String()] {
+					t.Errorf("%s allocated twice", ip)
+				}
+				seen[ip.String()] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(seen) != 1024 {
+		t.Errorf("Expected 1024 addresses, got %d", len(seen))
+	}
+}
+
+func TestConcurrentTakeAndRelease(t *testing.T) {
+	p, err := NewIPPool(net.ParseIP("10.0.0.0"), net.ParseIP("10.0.0.255"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if ip := p.Allocate(); ip != nil {
+					p.Release(ip)
+				}
+				if ip := net.IPv4(10, 0, 0, byte(i)); p.Take(ip) {
+					p.Release(ip)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if want := (Stats{Size: 256, Free: 256}); p.Stats() != want {
+		t.Errorf("Expected %+v, got %+v", want, p.Stats())
+	}
+	seen := make(map[string]bool)
+	for ip := p.Allocate(); ip != nil; ip = p.Allocate() {
+		if seen[ip.String()] {
+			t.Fatalf("%s allocated twice", ip)
+		}
+		seen[ip.String()] = true
+	}
+	if len(seen) != 256 {
+		t.Errorf("Expected 256 addresses, got %d", len(seen))
+	}
+}
+
+func benchmarkPool(b *testing.B, end string) {
+	newPool := func(b *testing.B) *IPPool {
+		p, err := NewIPPool(net.ParseIP("10.0.0.0"), net.ParseIP(end))
+		if err != nil {
+			b.Fatal(err)
+		}
+		return p
+	}
+	b.Run("New", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			newPool(b)
+		}
+	})
+	b.Run("Allocate", func(b *testing.B) {
+		p := newPool(b)
+		// Keep half the pool allocated so both the never-used scan and the
+		// released list are exercised.
+		held := make([]net.IP, p.Stats().Size/2)
+		for i := range held {
+			held[i] = p.Allocate()
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			ip := p.Allocate()
+			if ip == nil {
+				b.Fatal("pool exhausted")
+			}
+			p.Release(held[i%len(held)])
+			held[i%len(held)] = ip
+		}
+	})
+	b.Run("Take", func(b *testing.B) {
+		p := newPool(b)
+		ip := net.ParseIP("10.0.0.77")
+		for i := 0; i < b.N; i++ {
+			p.Take(ip)
+			p.Release(ip)
+		}
+	})
+	b.Run("AllocateParallel", func(b *testing.B) {
+		p := newPool(b)
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				ip := p.Allocate()
+				if ip == nil {
+					b.Error("pool exhausted")
+					return
+				}
+				p.Release(ip)
+			}
+		})
+	})
+	b.Run("AllocateNewParallel", func(b *testing.B) {
+		// Only never-used addresses, the path that does not lock. The pool
+		// is replaced when it runs out.
+		var mu sync.Mutex
+		p := newPool(b)
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				mu.Lock()
+				cur := p
+				mu.Unlock()
+				if cur.Allocate() == nil {
+					mu.Lock()
+					if p == cur {
+						p = newPool(b)
+					}
+					mu.Unlock()
+				}
+			}
+		})
+	})
+	b.Run("TakeParallel", func(b *testing.B) {
+		p := newPool(b)
+		var next atomic.Uint32
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			ip := net.IPv4(10, 0, 0, byte(next.Add(1)))
+			for pb.Next() {
+				p.Take(ip)
+				p.Release(ip)
+			}
+		})
+	})
+	b.Run("StatsParallel", func(b *testing.B) {
+		p := newPool(b)
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				p.Stats()
+			}
+		})
+	})
+}
+
+func BenchmarkPool24(b *testing.B) { benchmarkPool(b, "10.0.0.255") }
+func BenchmarkPool16(b *testing.B) { benchmarkPool(b, "10.0.255.255") }
+func BenchmarkPool8(b *testing.B)  { benchmarkPool(b, "10.255.255.255") }
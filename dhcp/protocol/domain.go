@@ -0,0 +1,219 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	maxLabelLength  = 63
+	maxNameLength   = 255
+	pointerMask     = 0xC0
+	maxPointerValue = 0x3FFF
+)
+
+var ErrInvalidDomainName = errors.New("invalid domain name")
+
+func splitLabels(name string) ([]string, error) {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" {
+		return nil, fmt.Errorf("%w: empty name", ErrInvalidDomainName)
+	}
+	labels := strings.Split(name, ".")
+	wireLength := 1
+	for _, label := range labels {
+		if label == "" || len(label) > maxLabelLength {
+			return nil, fmt.Errorf("%w: bad label %q in %q", ErrInvalidDomainName, label, name)
+		}
+		wireLength += 1 + len(label)
+	}
+	if wireLength > maxNameLength {
+		return nil, fmt.Errorf("%w: %q is longer than %d bytes", ErrInvalidDomainName, name, maxNameLength)
+	}
+	return labels, nil
+}
+
+// EncodeDomainList encodes a domain search list (option 119) using the
+// message compression of RFC 1035 section 4.1.4, as RFC 3397 requires.
+func EncodeDomainList(domains []string) ([]byte, error) {
+	var data []byte
+	offsets := make(map[string]int)
+	for _, domain := range domains {
+		labels, err := splitLabels(domain)
+		if err != nil {
+			return nil, err
+		}
+		terminated := false
+		for i := range labels {
+			suffix := strings.ToLower(strings.Join(labels[i:], "."))
+			if off, ok := offsets[suffix]; ok {
+				data = append(data, pointerMask|byte(off>>8), byte(off))
+				terminated = true
+				break
+			}
+			if len(data) <= maxPointerValue {
+				offsets[suffix] = len(data)
+			}
+			data = append(data, byte(len(labels[i])))
+			data = append(data, labels[i]...)
+		}
+		if !terminated {
+			data = append(data, 0)
+		}
+	}
+	return data, nil
+}
+
+// ParseDomainList decodes a compressed domain search list. Pointers have to
+// point backwards, which rules out loops.
+func ParseDomainList(data []byte) ([]string, error) {
+	if len(data) == 0 {
+		return nil, lengthError("empty domain list")
+	}
+	var domains []string
+	for off := 0; off < len(data); {
+		name, next, err := readName(data, off)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, name)
+		off = next
+	}
+	return domains, nil
+}
+
+// readName reads the name starting at off and returns it together with the
+// offset following it.
+func readName(data []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	wireLength := 1
+	for pos := off; ; {
+		if pos >= len(data) {
+			return "", 0, fmt.Errorf("%w: truncated name at offset %d", ErrInvalidDomainName, off)
+		}
+		n := int(data[pos])
+		switch {
+		case n == 0:
+			if next < 0 {
+				next = pos + 1
+			}
+			if len(labels) == 0 {
+				return "", 0, fmt.Errorf("%w: empty name at offset %d", ErrInvalidDomainName, off)
+			}
+			return strings.Join(labels, "."), next, nil
+		case n&pointerMask == pointerMask:
+			if pos+1 >= len(data) {
+				return "", 0, fmt.Errorf("%w: truncated pointer at offset %d", ErrInvalidDomainName, pos)
+			}
+			target := int(data[pos]&^pointerMask)<<8 | int(data[pos+1])
+			if target >= pos {
+				return "", 0, fmt.Errorf("%w: forward pointer at offset %d", ErrInvalidDomainName, pos)
+			}
+			if next < 0 {
+				next = pos + 2
+			}
+			pos = target
+		case n&pointerMask != 0:
+			return "", 0, fmt.Errorf("%w: unsupported label type at offset %d", ErrInvalidDomainName, pos)
+		default:
+			if pos+1+n > len(data) {
+				return "", 0, fmt.Errorf("%w: truncated label at offset %d", ErrInvalidDomainName, pos)
+			}
+			wireLength += 1 + n
+			if wireLength > maxNameLength {
+				return "", 0, fmt.Errorf("%w: name at offset %d is too long", ErrInvalidDomainName, off)
+			}
+			label := data[pos+1 : pos+1+n]
+			if bytes.IndexByte(label, '.') >= 0 {
+				return "", 0, fmt.Errorf("%w: label with a dot at offset %d", ErrInvalidDomainName, pos)
+			}
+			labels = append(labels, string(label))
+			pos += 1 + n
+		}
+	}
+}
+
+const (
+	FQDNFlagS = 0x01 // server performs the A RR update
+	FQDNFlagO = 0x02 // server overrode the client's S bit
+	FQDNFlagE = 0x04 // name uses the canonical wire format
+	FQDNFlagN = 0x08 // server performs no DNS updates
+)
+
+// ClientFQDN is the value of the Client FQDN option (81, RFC 4702). A name
+// ending in '.' is fully qualified, anything else is a partial name.
+type ClientFQDN struct {
+	Flags  byte
+	RCode1 byte
+	RCode2 byte
+	Name   string
+}
+
+func EncodeClientFQDN(f *ClientFQDN) ([]byte, error) {
+	data := []byte{f.Flags, f.RCode1, f.RCode2}
+	if f.Name == "" {
+		return data, nil
+	}
+	if f.Flags&FQDNFlagE == 0 {
+		return append(data, f.Name...), nil
+	}
+	labels, err := splitLabels(f.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, label := range labels {
+		data = append(data, byte(len(label)))
+		data = append(data, label...)
+	}
+	if strings.HasSuffix(f.Name, ".") {
+		data = append(data, 0)
+	}
+	return data, nil
+}
+
+func ParseClientFQDN(data []byte) (*ClientFQDN, error) {
+	if len(data) < 3 {
+		return nil, lengthError("got %d bytes, want at least 3", len(data))
+	}
+	f := &ClientFQDN{Flags: data[0], RCode1: data[1], RCode2: data[2]}
+	if f.Flags&FQDNFlagS != 0 && f.Flags&FQDNFlagN != 0 {
+		return nil, errors.New("flags S and N are both set")
+	}
+	name := data[3:]
+	if f.Flags&FQDNFlagE == 0 {
+		f.Name = string(name)
+		return f, nil
+	}
+	wireLength := len(name)
+	if wireLength > 0 && name[wireLength-1] != 0 {
+		// A partial name still needs room for the root label.
+		wireLength++
+	}
+	if wireLength > maxNameLength {
+		return nil, fmt.Errorf("%w: name is longer than %d bytes", ErrInvalidDomainName, maxNameLength)
+	}
+
+	var labels []string
+	for pos := 0; pos < len(name); {
+		n := int(name[pos])
+		if n == 0 {
+			if pos != len(name)-1 {
+				return nil, fmt.Errorf("%w: data after the root label", ErrInvalidDomainName)
+			}
+			if len(labels) > 0 {
+				f.Name = strings.Join(labels, ".") + "."
+			}
+			return f, nil
+		}
+		if n > maxLabelLength || pos+1+n > len(name) || bytes.IndexByte(name[pos+1:pos+1+n], '.') >= 0 {
+			return nil, fmt.Errorf("%w: bad label at offset %d", ErrInvalidDomainName, pos)
+		}
+		labels = append(labels, string(name[pos+1:pos+1+n]))
+		pos += 1 + n
+	}
+	f.Name = strings.Join(labels, ".")
+	return f, nil
+}
@@ -2,10 +2,53 @@ package protocol
 
 import (
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
 	"net"
+	"strings"
+	"time"
 )
 
-func flattenIPs(ips []net.IP) []byte {
+var (
+	ErrOptionNotFound      = errors.New("option not found")
+	ErrInvalidOptionLength = errors.New("invalid option length")
+)
+
+// InfiniteDuration is the decoded form of the all-ones time value
+// (0xffffffff) that stands for an infinite lease.
+const InfiniteDuration = time.Duration(math.MaxInt64)
+
+// OptionError reports an option value that could not be parsed.
+type OptionError struct {
+	Code byte
+	Err  error
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("option %d (%s): %v", e.Code, DHCPOptions[e.Code].Name, e.Err)
+}
+
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+func lengthError(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{ErrInvalidOptionLength}, args...)...)
+}
+
+func EncodeIP(ip net.IP) []byte {
+	return ip.To4()
+}
+
+func ParseIP(data []byte) (net.IP, error) {
+	if len(data) != net.IPv4len {
+		return nil, lengthError("got %d bytes, want 4", len(data))
+	}
+	return net.IPv4(data[0], data[1], data[2], data[3]).To4(), nil
+}
+
+func EncodeIPs(ips []net.IP) []byte {
 	result := make([]byte, 0, len(ips)*4)
 	for _, ip := range ips {
 		result = append(result, ip.To4()...)
@@ -13,8 +56,248 @@ func flattenIPs(ips []net.IP) []byte {
 	return result
 }
 
-func intToBytes(i uint32) []byte {
-	b := make([]byte, 4)
-	binary.BigEndian.PutUint32(b, i)
-	return b
+func ParseIPs(data []byte) ([]net.IP, error) {
+	if len(data) == 0 || len(data)%net.IPv4len != 0 {
+		return nil, lengthError("got %d bytes, want a positive multiple of 4", len(data))
+	}
+	ips := make([]net.IP, 0, len(data)/net.IPv4len)
+	for i := 0; i < len(data); i += net.IPv4len {
+		ip, _ := ParseIP(data[i : i+net.IPv4len])
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+func EncodeUint8(v uint8) []byte {
+	return []byte{v}
+}
+
+func ParseUint8(data []byte) (uint8, error) {
+	if len(data) != 1 {
+		return 0, lengthError("got %d bytes, want 1", len(data))
+	}
+	return data[0], nil
+}
+
+func EncodeUint16(v uint16) []byte {
+	return binary.BigEndian.AppendUint16(nil, v)
+}
+
+func ParseUint16(data []byte) (uint16, error) {
+	if len(data) != 2 {
+		return 0, lengthError("got %d bytes, want 2", len(data))
+	}
+	return binary.BigEndian.Uint16(data), nil
+}
+
+func EncodeUint32(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+func ParseUint32(data []byte) (uint32, error) {
+	if len(data) != 4 {
+		return 0, lengthError("got %d bytes, want 4", len(data))
+	}
+	return binary.BigEndian.Uint32(data), nil
+}
+
+func EncodeString(s string) []byte {
+	return []byte(s)
+}
+
+// ParseString decodes an NVT ASCII option. Trailing NULs some clients send
+// are removed.
+func ParseString(data []byte) (string, error) {
+	s := strings.TrimRight(string(data), "\x00")
+	if s == "" {
+		return "", lengthError("empty string")
+	}
+	return s, nil
+}
+
+// EncodeDuration encodes d as whole seconds. Durations that do not fit and
+// InfiniteDuration are encoded as infinite.
+func EncodeDuration(d time.Duration) []byte {
+	switch {
+	case d < 0:
+		return EncodeUint32(0)
+	case d >= time.Duration(math.MaxUint32)*time.Second:
+		return EncodeUint32(math.MaxUint32)
+	}
+	return EncodeUint32(uint32(d / time.Second))
+}
+
+func ParseDuration(data []byte) (time.Duration, error) {
+	v, err := ParseUint32(data)
+	if err != nil {
+		return 0, err
+	}
+	if v == math.MaxUint32 {
+		return InfiniteDuration, nil
+	}
+	return time.Duration(v) * time.Second, nil
+}
+
+// lookupOption returns the value of the option code or ErrOptionNotFound.
+func (p *Packet) lookupOption(code byte) ([]byte, error) {
+	data := p.GetOption(code)
+	if data == nil {
+		return nil, &OptionError{Code: code, Err: ErrOptionNotFound}
+	}
+	return data, nil
+}
+
+func parseOption[T any](p *Packet, code byte, parse func([]byte) (T, error)) (T, error) {
+	data, err := p.lookupOption(code)
+	if err == nil {
+		var v T
+		if v, err = parse(data); err == nil {
+			return v, nil
+		}
+		err = &OptionError{Code: code, Err: err}
+	}
+	var zero T
+	return zero, err
+}
+
+func (p *Packet) GetIPOption(code byte) (net.IP, error) {
+	return parseOption(p, code, ParseIP)
+}
+
+func (p *Packet) GetIPsOption(code byte) ([]net.IP, error) {
+	return parseOption(p, code, ParseIPs)
+}
+
+func (p *Packet) GetUint8Option(code byte) (uint8, error) {
+	return parseOption(p, code, ParseUint8)
+}
+
+func (p *Packet) GetUint16Option(code byte) (uint16, error) {
+	return parseOption(p, code, ParseUint16)
+}
+
+func (p *Packet) GetUint32Option(code byte) (uint32, error) {
+	return parseOption(p, code, ParseUint32)
+}
+
+func (p *Packet) GetStringOption(code byte) (string, error) {
+	return parseOption(p, code, ParseString)
+}
+
+func (p *Packet) GetDurationOption(code byte) (time.Duration, error) {
+	return parseOption(p, code, ParseDuration)
+}
+
+func (p *Packet) GetDomainListOption(code byte) ([]string, error) {
+	return parseOption(p, code, ParseDomainList)
+}
+
+func (p *Packet) GetClasslessRoutesOption() ([]Route, error) {
+	return parseOption(p, OptionClasslessStaticRoute, ParseClasslessRoutes)
+}
+
+func (p *Packet) GetClientFQDNOption() (*ClientFQDN, error) {
+	return parseOption(p, OptionClientFQDN, ParseClientFQDN)
+}
+
+func (p *Packet) GetRelayAgentInfoOption() (RelayAgentInfo, error) {
+	return parseOption(p, OptionDHCPAgentOptions, ParseRelayAgentInfo)
+}
+
+// OptionType describes how the value of an option is encoded.
+type OptionType int
+
+const (
+	TypeBytes OptionType = iota
+	TypeIP
+	TypeIPs
+	TypeUint8
+	TypeUint16
+	TypeUint32
+	TypeString
+	TypeDuration
+	TypeDomainList
+	TypeClasslessRoutes
+	TypeClientFQDN
+	TypeRelayAgentInfo
+)
+
+var optionTypes = map[byte]OptionType{
+	OptionSubnetMask:           TypeIP,
+	2:                          TypeUint32,
+	OptionRouter:               TypeIPs,
+	4:                          TypeIPs,
+	5:                          TypeIPs,
+	OptionDomainNameServer:     TypeIPs,
+	7:                          TypeIPs,
+	9:                          TypeIPs,
+	OptionHostname:             TypeString,
+	OptionDomainName:           TypeString,
+	17:                         TypeString,
+	23:                         TypeUint8,
+	26:                         TypeUint16,
+	OptionBroadcastAddress:     TypeIP,
+	40:                         TypeString,
+	41:                         TypeIPs,
+	OptionNetworkTimeProtocol:  TypeIPs,
+	44:                         TypeIPs,
+	46:                         TypeUint8,
+	OptionRequestedIPAddress:   TypeIP,
+	OptionIPAddressLeaseTime:   TypeDuration,
+	OptionOverload:             TypeUint8,
+	OptionDHCPMessageType:      TypeUint8,
+	OptionServerIdentifier:     TypeIP,
+	56:                         TypeString,
+	OptionMaxMessageSize:       TypeUint16,
+	OptionRenewalTime:          TypeDuration,
+	OptionRebindingTime:        TypeDuration,
+	OptionTFTPServerName:       TypeString,
+	OptionBootfileName:         TypeString,
+	OptionClientFQDN:           TypeClientFQDN,
+	OptionDHCPAgentOptions:     TypeRelayAgentInfo,
+	OptionSubnetSelection:      TypeIP,
+	OptionDomainSearch:         TypeDomainList,
+	OptionClasslessStaticRoute: TypeClasslessRoutes,
+}
+
+// OptionTypeOf returns the value type of a known option, TypeBytes otherwise.
+func OptionTypeOf(code byte) OptionType {
+	return optionTypes[code]
+}
+
+// ParseOptionValue decodes data according to the type of option code. Values
+// of options with no known type are returned as a byte slice.
+func ParseOptionValue(code byte, data []byte) (any, error) {
+	var v any
+	var err error
+	switch OptionTypeOf(code) {
+	case TypeIP:
+		v, err = ParseIP(data)
+	case TypeIPs:
+		v, err = ParseIPs(data)
+	case TypeUint8:
+		v, err = ParseUint8(data)
+	case TypeUint16:
+		v, err = ParseUint16(data)
+	case TypeUint32:
+		v, err = ParseUint32(data)
+	case TypeString:
+		v, err = ParseString(data)
+	case TypeDuration:
+		v, err = ParseDuration(data)
+	case TypeDomainList:
+		v, err = ParseDomainList(data)
+	case TypeClasslessRoutes:
+		v, err = ParseClasslessRoutes(data)
+	case TypeClientFQDN:
+		v, err = ParseClientFQDN(data)
+	case TypeRelayAgentInfo:
+		v, err = ParseRelayAgentInfo(data)
+	default:
+		v = data
+	}
+	if err != nil {
+		return nil, &OptionError{Code: code, Err: err}
+	}
+	return v, nil
 }
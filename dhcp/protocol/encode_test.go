@@ -0,0 +1,239 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mustCIDR(s string) net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return *n
+}
+
+func TestOptionRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name   string
+		code   byte
+		value  any
+		encode func() ([]byte, error)
+	}{
+		{
+			name:   "ip",
+			code:   OptionServerIdentifier,
+			value:  net.IP{192, 168, 1, 2},
+			encode: func() ([]byte, error) { return EncodeIP(net.ParseIP("192.168.1.2")), nil },
+		},
+		{
+			name:  "ip list",
+			code:  OptionDomainNameServer,
+			value: []net.IP{{8, 8, 8, 8}, {1, 1, 1, 1}},
+			encode: func() ([]byte, error) {
+				return EncodeIPs([]net.IP{net.ParseIP("8.8.8.8"), net.ParseIP("1.1.1.1")}), nil
+			},
+		},
+		{
+			name:   "uint8",
+			code:   OptionDHCPMessageType,
+			value:  uint8(DHCPREQUEST),
+			encode: func() ([]byte, error) { return EncodeUint8(DHCPREQUEST), nil },
+		},
+		{
+			name:   "uint16",
+			code:   OptionMaxMessageSize,
+			value:  uint16(1500),
+			encode: func() ([]byte, error) { return EncodeUint16(1500), nil },
+		},
+		{
+			name:   "uint32",
+			code:   2,
+			value:  uint32(3600),
+			encode: func() ([]byte, error) { return EncodeUint32(3600), nil },
+		},
+		{
+			name:   "string",
+			code:   OptionHostname,
+			value:  "host",
+			encode: func() ([]byte, error) { return EncodeString("host"), nil },
+		},
+		{
+			name:   "duration",
+			code:   OptionIPAddressLeaseTime,
+			value:  90 * time.Minute,
+			encode: func() ([]byte, error) { return EncodeDuration(90 * time.Minute), nil },
+		},
+		{
+			name:   "infinite duration",
+			code:   OptionIPAddressLeaseTime,
+			value:  InfiniteDuration,
+			encode: func() ([]byte, error) { return EncodeDuration(InfiniteDuration), nil },
+		},
+		{
+			name:  "domain search list",
+			code:  OptionDomainSearch,
+			value: []string{"eng.example.com", "example.com", "corp.example.com", "example.org"},
+			encode: func() ([]byte, error) {
+				return EncodeDomainList([]string{"eng.example.com", "example.com.", "corp.example.com", "example.org"})
+			},
+		},
+		{
+			name: "classless routes",
+			code: OptionClasslessStaticRoute,
+			value: []Route{
+				{Destination: mustCIDR("0.0.0.0/0"), Router: net.IP{10, 0, 0, 1}},
+				{Destination: mustCIDR("10.20.0.0/14"), Router: net.IP{10, 0, 0, 2}},
+				{Destination: mustCIDR("192.168.7.9/32"), Router: net.IP{10, 0, 0, 3}},
+			},
+			encode: func() ([]byte, error) {
+				return EncodeClasslessRoutes([]Route{
+					{Destination: mustCIDR("0.0.0.0/0"), Router: net.ParseIP("10.0.0.1")},
+					{Destination: mustCIDR("10.20.0.0/14"), Router: net.ParseIP("10.0.0.2")},
+					{Destination: mustCIDR("192.168.7.9/32"), Router: net.ParseIP("10.0.0.3")},
+				})
+			},
+		},
+		{
+			name:  "client fqdn wire format",
+			code:  OptionClientFQDN,
+			value: &ClientFQDN{Flags: FQDNFlagE | FQDNFlagS, Name: "host.example.com."},
+			encode: func() ([]byte, error) {
+				return EncodeClientFQDN(&ClientFQDN{Flags: FQDNFlagE | FQDNFlagS, Name: "host.example.com."})
+			},
+		},
+		{
+			name:  "client fqdn partial name",
+			code:  OptionClientFQDN,
+			value: &ClientFQDN{Flags: FQDNFlagE, Name: "host"},
+			encode: func() ([]byte, error) {
+				return EncodeClientFQDN(&ClientFQDN{Flags: FQDNFlagE, Name: "host"})
+			},
+		},
+		{
+			name:  "client fqdn ascii",
+			code:  OptionClientFQDN,
+			value: &ClientFQDN{Flags: FQDNFlagN, RCode1: 255, RCode2: 255, Name: "host.example.com"},
+			encode: func() ([]byte, error) {
+				return EncodeClientFQDN(&ClientFQDN{Flags: FQDNFlagN, RCode1: 255, RCode2: 255, Name: "host.example.com"})
+			},
+		},
+		{
+			name: "relay agent information",
+			code: OptionDHCPAgentOptions,
+			value: RelayAgentInfo{
+				{Code: AgentCircuitID, Data: []byte("eth0/1")},
+				{Code: AgentRemoteID, Data: []byte{0, 1, 2, 3, 4, 5}},
+				{Code: AgentLinkSelection, Data: []byte{10, 1, 0, 0}},
+			},
+			encode: func() ([]byte, error) {
+				return RelayAgentInfo{
+					{Code: AgentCircuitID, Data: []byte("eth0/1")},
+					{Code: AgentRemoteID, Data: []byte{0, 1, 2, 3, 4, 5}},
+					{Code: AgentLinkSelection, Data: []byte{10, 1, 0, 0}},
+				}.Encode(), nil
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := tc.encode()
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			got, err := ParseOptionValue(tc.code, data)
+			if err != nil {
+				t.Fatalf("ParseOptionValue: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.value) {
+				t.Errorf("Expected %#v, got %#v", tc.value, got)
+			}
+
+			p := &Packet{}
+			p.AddOption(tc.code, data)
+			if raw := p.GetOption(tc.code); !bytes.Equal(raw, data) {
+				t.Errorf("Expected option data %v, got %v", data, raw)
+			}
+		})
+	}
+}
+
+func TestParseOptionErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		code byte
+		data []byte
+	}{
+		{"short ip", OptionServerIdentifier, []byte{10, 0, 0}},
+		{"ip list not a multiple of four", OptionRouter, []byte{10, 0, 0, 1, 10}},
+		{"empty ip list", OptionDomainNameServer, nil},
+		{"long uint8", OptionDHCPMessageType, []byte{1, 2}},
+		{"short uint16", OptionMaxMessageSize, []byte{5}},
+		{"short duration", OptionIPAddressLeaseTime, []byte{0, 0, 1}},
+		{"empty string", OptionHostname, []byte{0, 0}},
+		{"truncated label", OptionDomainSearch, []byte{7, 'e', 'x', 'a'}},
+		{"forward pointer", OptionDomainSearch, []byte{0xc0, 0x04, 0, 0, 3, 'c', 'o', 'm', 0}},
+		{"self pointer", OptionDomainSearch, []byte{0xc0, 0x00}},
+		{"missing root label", OptionDomainSearch, []byte{3, 'c', 'o', 'm'}},
+		{"route prefix too long", OptionClasslessStaticRoute, []byte{33, 10, 0, 0, 0, 0, 10, 0, 0, 1}},
+		{"truncated route", OptionClasslessStaticRoute, []byte{24, 10, 0, 0, 10, 0}},
+		{"route host bits set", OptionClasslessStaticRoute, []byte{14, 10, 21, 10, 0, 0, 1}},
+		{"short fqdn", OptionClientFQDN, []byte{FQDNFlagE, 0}},
+		{"fqdn with S and N", OptionClientFQDN, []byte{FQDNFlagS | FQDNFlagN, 0, 0}},
+		{"fqdn label overrun", OptionClientFQDN, []byte{FQDNFlagE, 0, 0, 9, 'h', 'o', 's', 't'}},
+		{"relay sub-option overrun", OptionDHCPAgentOptions, []byte{AgentCircuitID, 5, 'e', 't', 'h'}},
+		{"relay truncated header", OptionDHCPAgentOptions, []byte{AgentCircuitID, 1, 'x', AgentRemoteID}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseOptionValue(tc.code, tc.data)
+			var optErr *OptionError
+			if !errors.As(err, &optErr) || optErr.Code != tc.code {
+				t.Errorf("Expected an OptionError for option %d, got %v", tc.code, err)
+			}
+		})
+	}
+}
+
+func TestDomainListCompression(t *testing.T) {
+	domains := []string{"eng.example.com", "corp.example.com", "example.com"}
+	data, err := EncodeDomainList(domains)
+	if err != nil {
+		t.Fatalf("EncodeDomainList: %v", err)
+	}
+	// eng.example.com in full (17 bytes), corp plus a pointer (7 bytes) and a
+	// bare pointer for example.com (2 bytes).
+	if len(data) != 26 {
+		t.Errorf("Expected 26 bytes, got %d: %v", len(data), data)
+	}
+
+	if _, err := EncodeDomainList([]string{"bad..name"}); !errors.Is(err, ErrInvalidDomainName) {
+		t.Errorf("Expected ErrInvalidDomainName for an empty label, got %v", err)
+	}
+	long := string(bytes.Repeat([]byte("a"), 64)) + ".com"
+	if _, err := EncodeDomainList([]string{long}); !errors.Is(err, ErrInvalidDomainName) {
+		t.Errorf("Expected ErrInvalidDomainName for a 64 byte label, got %v", err)
+	}
+}
+
+func TestGetTypedOption(t *testing.T) {
+	p := &Packet{}
+	p.AddOption(OptionDHCPMessageType, []byte{DHCPDISCOVER})
+	p.AddOption(OptionRequestedIPAddress, []byte{10, 0, 0})
+
+	if _, err := p.GetIPOption(OptionServerIdentifier); !errors.Is(err, ErrOptionNotFound) {
+		t.Errorf("Expected ErrOptionNotFound, got %v", err)
+	}
+	if _, err := p.GetIPOption(OptionRequestedIPAddress); !errors.Is(err, ErrInvalidOptionLength) {
+		t.Errorf("Expected ErrInvalidOptionLength, got %v", err)
+	}
+	if mt, err := p.GetUint8Option(OptionDHCPMessageType); err != nil || mt != DHCPDISCOVER {
+		t.Errorf("Expected message type %d, got %d (%v)", DHCPDISCOVER, mt, err)
+	}
+}
@@ -0,0 +1,89 @@
+package protocol
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func FuzzDecode(f *testing.F) {
+	f.Add(testPacket)
+	f.Add(testPacket[:fixedHeaderLength])
+	f.Fuzz(func(t *testing.T, data []byte) {
+		p, err := Decode(data)
+		if err != nil {
+			return
+		}
+		getDHCPMessageType(p.Options)
+		for code := 0; code < 256; code++ {
+			if value := p.GetOption(byte(code)); value != nil {
+				_, _ = ParseOptionValue(byte(code), value)
+			}
+		}
+
+		again, err := Decode(p.Encode())
+		if err != nil {
+			t.Fatalf("Decode of encoded packet: %v", err)
+		}
+		if !reflect.DeepEqual(p, again) {
+			t.Errorf("Round trip changed the packet:\n%#v\n%#v", p, again)
+		}
+	})
+}
+
+func FuzzEncode(f *testing.F) {
+	f.Add(byte(BOOTREQUEST), byte(6), uint32(1), []byte{0, 1, 2, 3, 4, 5}, []byte{OptionDHCPMessageType, 1, DHCPDISCOVER})
+	f.Fuzz(func(t *testing.T, op, hlen byte, xid uint32, chaddr, options []byte) {
+		p := &Packet{Op: op, HType: 6, HLen: hlen, XId: xid, CHAddr: chaddr, Options: options}
+		data := p.Encode()
+		if len(data) != fixedHeaderLength+len(options)+1 {
+			t.Fatalf("Expected %d bytes, got %d", fixedHeaderLength+len(options)+1, len(data))
+		}
+		decoded, err := Decode(data)
+		if err != nil {
+			return
+		}
+		if decoded.Op != op || decoded.XId != xid {
+			t.Errorf("Expected op %d xid %d, got op %d xid %d", op, xid, decoded.Op, decoded.XId)
+		}
+		if n := min(int(hlen), len(chaddr), 16); !bytes.Equal(decoded.CHAddr[:n], chaddr[:n]) {
+			t.Errorf("Expected chaddr %x, got %x", chaddr[:n], decoded.CHAddr[:n])
+		}
+	})
+}
+
+func FuzzParseOption(f *testing.F) {
+	f.Add(byte(OptionDomainSearch), []byte{3, 'e', 'n', 'g', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0xc0, 4})
+	f.Add(byte(OptionClasslessStaticRoute), []byte{24, 192, 168, 1, 10, 0, 0, 1, 0, 10, 0, 0, 1})
+	f.Add(byte(OptionClientFQDN), []byte{FQDNFlagE, 0, 0, 4, 'h', 'o', 's', 't', 0})
+	f.Add(byte(OptionDHCPAgentOptions), []byte{AgentCircuitID, 2, 'e', '0', AgentLinkSelection, 4, 10, 0, 0, 0})
+	f.Fuzz(func(t *testing.T, code byte, data []byte) {
+		v, err := ParseOptionValue(code, data)
+		if err != nil {
+			return
+		}
+		var encoded []byte
+		switch v := v.(type) {
+		case []string:
+			encoded, err = EncodeDomainList(v)
+		case []Route:
+			encoded, err = EncodeClasslessRoutes(v)
+		case *ClientFQDN:
+			encoded, err = EncodeClientFQDN(v)
+		case RelayAgentInfo:
+			encoded = v.Encode()
+		default:
+			return
+		}
+		if err != nil {
+			t.Fatalf("Encoding parsed value %#v: %v", v, err)
+		}
+		again, err := ParseOptionValue(code, encoded)
+		if err != nil {
+			t.Fatalf("Parsing re-encoded value: %v", err)
+		}
+		if !reflect.DeepEqual(v, again) {
+			t.Errorf("Round trip changed the value:\n%#v\n%#v", v, again)
+		}
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"sync/atomic"
 )
 
 const (
@@ -14,8 +15,14 @@ const (
 	ethernetIPv4Type = 0x0800
 	clientPort       = 68
 	serverPort       = 67
+	// ipDontFragment is the DF flag in the IPv4 flags and fragment offset
+	// field.
+	ipDontFragment = 0x4000
 )
 
+// ipID numbers the IPv4 datagrams built by Ethernet.Bytes.
+var ipID atomic.Uint32
+
 type udp struct {
 	Source, Destination uint16
 	Length              uint16
@@ -27,15 +34,32 @@ func (u *udp) Encode() []byte {
 	binary.BigEndian.PutUint16(data[0:], u.Source)
 	binary.BigEndian.PutUint16(data[2:], u.Destination)
 	binary.BigEndian.PutUint16(data[4:], u.Length)
-	for i, b := range u.Payload {
-		data[i+8] = b
-	}
+	copy(data[8:], u.Payload)
 	return data
 }
 
+// udpChecksum returns the checksum of the UDP datagram data, whose checksum
+// field is zero, including the IPv4 pseudo header (RFC 768).
+func udpChecksum(source, destination net.IP, data []byte) uint16 {
+	pseudo := make([]byte, 12+len(data))
+	copy(pseudo[0:4], source.To4())
+	copy(pseudo[4:8], destination.To4())
+	pseudo[9] = udpProtocol
+	binary.BigEndian.PutUint16(pseudo[10:], uint16(len(data)))
+	copy(pseudo[12:], data)
+	sum := Checksum(pseudo)
+	// A zero checksum means none was computed, zero is sent as all ones.
+	if sum == 0 {
+		sum = 0xffff
+	}
+	return sum
+}
+
 type ipHeader struct {
 	Version             uint8
 	Length              uint16
+	ID                  uint16
+	Flags               uint16
 	Protocol            uint8
 	Source, Destination net.IP
 }
@@ -44,10 +68,13 @@ func (i *ipHeader) Encode() []byte {
 	data := make([]byte, 20)
 	data[0] = i.Version
 	binary.BigEndian.PutUint16(data[2:], i.Length)
+	binary.BigEndian.PutUint16(data[4:], i.ID)
+	binary.BigEndian.PutUint16(data[6:], i.Flags)
 	data[8] = ttlHeader
 	data[9] = i.Protocol
 	copy(data[12:16], i.Source.To4())
 	copy(data[16:20], i.Destination.To4())
+	binary.BigEndian.PutUint16(data[10:], Checksum(data))
 	return data
 }
 
@@ -65,12 +92,25 @@ func (e *ethernet) Encode() []byte {
 	copy(eth[6:12], e.Source)
 	eth[12] = byte(e.Type >> 8)
 	eth[13] = byte(e.Type)
-	for i, b := range e.Payload {
-		eth[i+14] = b
-	}
+	copy(eth[14:], e.Payload)
 	return eth
 }
 
+// Checksum is the Internet checksum of RFC 1071.
+func Checksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
+
 type Ethernet struct {
 	SourcePort, DestinationPort uint16
 	SourceIP, DestinationIP     net.IP
@@ -79,19 +119,16 @@ type Ethernet struct {
 	Payload []byte
 }
 
+// Bytes returns the complete Ethernet frame with IPv4 and UDP checksums.
 func (p *Ethernet) Bytes() []byte {
-	u := udp{
-		Source:      p.SourcePort,
-		Destination: p.DestinationPort,
-		Length:      uint16(8 + len(p.Payload)),
-		Payload:     p.Payload,
-	}
-
-	UDP := u.Encode()
+	UDP := p.udp()
+	binary.BigEndian.PutUint16(UDP[6:], udpChecksum(p.SourceIP, p.DestinationIP, UDP))
 
 	h := ipHeader{
 		Version:     0x45, // IPv4
 		Length:      uint16(20 + len(UDP)),
+		ID:          uint16(ipID.Add(1)),
+		Flags:       ipDontFragment,
 		Protocol:    udpProtocol, // udp
 		Source:      p.SourceIP,
 		Destination: p.DestinationIP,
@@ -119,11 +156,31 @@ func (p *Ethernet) udp() []byte {
 	return u.Encode()
 }
 
-func SendPacket(conn net.PacketConn, p *Packet, sendAddr *net.UDPAddr) error {
+// FrameWriter is implemented by connections that can send complete
+// Ethernet frames on the serving interface. It lets replies reach clients
+// that have no address yet without broadcasting them.
+type FrameWriter interface {
+	WriteFrame(frame []byte) error
+	HardwareAddr() net.HardwareAddr
+}
+
+// PacketWriter sends datagrams, like a net.PacketConn.
+type PacketWriter interface {
+	WriteTo(p []byte, addr net.Addr) (n int, err error)
+}
+
+func SendPacket(conn PacketWriter, p *Packet, sendAddr *net.UDPAddr) error {
 	if conn == nil || p == nil {
 		return errors.New("conn and packet must not be nil")
 	}
 
+	if fw, ok := conn.(FrameWriter); ok && p.unicastToHardware() {
+		if err := sendFrame(fw, p); err != nil {
+			return fmt.Errorf("failed to send frame: %w", err)
+		}
+		return nil
+	}
+
 	destAddr, err := resolveDestinationAddress(p, sendAddr)
 	if err != nil {
 		return fmt.Errorf("failed to resolve destination address: %w", err)
@@ -150,17 +207,24 @@ func SendPacket(conn net.PacketConn, p *Packet, sendAddr *net.UDPAddr) error {
 	return nil
 }
 func resolveDestinationAddress(p *Packet, sendAddr *net.UDPAddr) (net.Addr, error) {
-	if p.IsBroadcast() {
-		return &net.UDPAddr{IP: net.IPv4bcast, Port: clientPort}, nil
+	// The answer to a DHCPINFORM goes straight to the address the client
+	// already has, whatever its broadcast flag says.
+	if p.isInformAck() {
+		return &net.UDPAddr{IP: p.CIAddr, Port: clientPort}, nil
 	}
 
-	if len(p.GetOption(OptionDHCPMessageType)) > 0 && p.GetOption(OptionDHCPMessageType)[0] == DHCPNAK {
+	// If GIAddr is specified and not zero, send to the relay agent, which
+	// takes care of broadcasting on the client's network (RFC 2131 4.1).
+	if p.GIAddr != nil && !p.GIAddr.IsUnspecified() {
+		return &net.UDPAddr{IP: p.GIAddr, Port: serverPort}, nil
+	}
+
+	if p.IsBroadcast() {
 		return &net.UDPAddr{IP: net.IPv4bcast, Port: clientPort}, nil
 	}
 
-	// If GIAddr is specified and not zero, send to the relay agent
-	if p.GIAddr != nil && !p.GIAddr.IsUnspecified() {
-		return &net.UDPAddr{IP: p.GIAddr, Port: serverPort}, nil
+	if p.DHCPMessageType() == DHCPNAK {
+		return &net.UDPAddr{IP: net.IPv4bcast, Port: clientPort}, nil
 	}
 
 	// Send directly to the client's IP if specified
@@ -168,10 +232,9 @@ func resolveDestinationAddress(p *Packet, sendAddr *net.UDPAddr) (net.Addr, erro
 		return &net.UDPAddr{IP: p.CIAddr, Port: clientPort}, nil
 	}
 
-	// Handle unicast
-	if p.CHAddr != nil {
-		//TODO
-	}
+	// A client without an address that accepts unicast is sent a frame by
+	// SendPacket when the connection can write frames. Otherwise it has to
+	// be broadcast, as the client cannot answer ARP for yiaddr.
 
 	// Default to broadcast
 	if sendAddr == nil || sendAddr.IP.IsUnspecified() {
@@ -180,3 +243,48 @@ func resolveDestinationAddress(p *Packet, sendAddr *net.UDPAddr) (net.Addr, erro
 
 	return sendAddr, nil
 }
+
+// unicastToHardware reports whether p is for a client without an address
+// that has to be unicast to its hardware address and yiaddr (RFC 2131
+// section 4.1).
+func (p *Packet) unicastToHardware() bool {
+	return !p.isInformAck() &&
+		(p.GIAddr == nil || p.GIAddr.IsUnspecified()) &&
+		!p.IsBroadcast() &&
+		p.DHCPMessageType() != DHCPNAK &&
+		(p.CIAddr == nil || p.CIAddr.IsUnspecified()) &&
+		p.YIAddr != nil && !p.YIAddr.IsUnspecified() &&
+		p.HType == HTypeEthernet && len(p.CHAddr) == 6
+}
+
+func sendFrame(fw FrameWriter, p *Packet) error {
+	serverIP, err := p.GetIPOption(OptionServerIdentifier)
+	if err != nil {
+		return err
+	}
+	frame := &Ethernet{
+		SourcePort:      serverPort,
+		DestinationPort: clientPort,
+		SourceIP:        serverIP,
+		DestinationIP:   p.YIAddr,
+		SourceMAC:       fw.HardwareAddr(),
+		DestinationMAC:  p.CHAddr,
+		Payload:         p.Encode(),
+	}
+	if err := fw.WriteFrame(frame.Bytes()); err != nil {
+		return err
+	}
+	slog.Debug("Sent DHCP packet",
+		"client", p.CHAddr.String(),
+		"offer_ip", p.YIAddr.String(),
+		"destination", "link-layer unicast",
+	)
+	return nil
+}
+
+func (p *Packet) isInformAck() bool {
+	return p.DHCPMessageType() == DHCPACK &&
+		(p.YIAddr == nil || p.YIAddr.IsUnspecified()) &&
+		(p.GIAddr == nil || p.GIAddr.IsUnspecified()) &&
+		p.CIAddr != nil && !p.CIAddr.IsUnspecified()
+}
@@ -0,0 +1,104 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// frameConn records frames and datagrams written to it.
+type frameConn struct {
+	frames [][]byte
+	sent   []net.Addr
+}
+
+func (c *frameConn) WriteFrame(frame []byte) error {
+	c.frames = append(c.frames, frame)
+	return nil
+}
+
+func (c *frameConn) HardwareAddr() net.HardwareAddr {
+	return net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+}
+
+func (c *frameConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.sent = append(c.sent, addr)
+	return len(p), nil
+}
+
+func (c *frameConn) ReadFrom(p []byte) (int, net.Addr, error) { return 0, nil, nil }
+func (c *frameConn) Close() error                             { return nil }
+func (c *frameConn) LocalAddr() net.Addr                      { return &net.UDPAddr{} }
+func (c *frameConn) SetDeadline(time.Time) error              { return nil }
+func (c *frameConn) SetReadDeadline(time.Time) error          { return nil }
+func (c *frameConn) SetWriteDeadline(time.Time) error         { return nil }
+
+func TestEthernetBytes(t *testing.T) {
+	e := &Ethernet{
+		SourcePort:      serverPort,
+		DestinationPort: clientPort,
+		SourceIP:        net.ParseIP("192.168.1.2"),
+		DestinationIP:   net.ParseIP("192.168.1.100"),
+		SourceMAC:       net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01},
+		DestinationMAC:  net.HardwareAddr{0x02, 0, 0, 0, 0, 0x02},
+		Payload:         []byte("odd length payload!"),
+	}
+	frame := e.Bytes()
+	if len(frame) != 14+20+8+len(e.Payload) {
+		t.Fatalf("Unexpected frame length %d", len(frame))
+	}
+	if !bytes.Equal(frame[0:6], e.DestinationMAC) || !bytes.Equal(frame[6:12], e.SourceMAC) {
+		t.Errorf("Unexpected MAC addresses % x", frame[0:12])
+	}
+	ip, udp := frame[14:34], frame[34:]
+	if Checksum(ip) != 0 {
+		t.Errorf("Expected a valid IPv4 header checksum, got %#04x", binary.BigEndian.Uint16(ip[10:]))
+	}
+	if flags := binary.BigEndian.Uint16(ip[6:]); flags != ipDontFragment {
+		t.Errorf("Expected the DF flag, got %#04x", flags)
+	}
+	pseudo := append(append(append([]byte{}, ip[12:20]...), 0, udpProtocol, 0, byte(len(udp))), udp...)
+	if binary.BigEndian.Uint16(udp[6:]) == 0 || Checksum(pseudo) != 0 {
+		t.Errorf("Expected a valid UDP checksum, got %#04x", binary.BigEndian.Uint16(udp[6:]))
+	}
+	if id := binary.BigEndian.Uint16(e.Bytes()[18:]); id == binary.BigEndian.Uint16(ip[4:]) {
+		t.Errorf("Expected consecutive frames to have different IP ids")
+	}
+}
+
+func TestSendPacketUnicastsFrame(t *testing.T) {
+	request, err := Decode(testPacket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offerIP := net.ParseIP("192.168.1.100")
+
+	conn := &frameConn{}
+	if err := SendPacket(conn, request.ToOffer(offerIP, testReplyOptions()), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.frames) != 1 || len(conn.sent) != 0 {
+		t.Fatalf("Expected one frame, got %d frames and %d datagrams", len(conn.frames), len(conn.sent))
+	}
+	frame := conn.frames[0]
+	if !bytes.Equal(frame[0:6], request.CHAddr) {
+		t.Errorf("Expected the frame to go to %s, got % x", request.CHAddr, frame[0:6])
+	}
+	if !net.IP(frame[30:34]).Equal(offerIP) || !net.IP(frame[26:30]).Equal(net.ParseIP("192.168.1.2")) {
+		t.Errorf("Expected %s from 192.168.1.2, got %s from %s", offerIP, net.IP(frame[30:34]), net.IP(frame[26:30]))
+	}
+	if reply, err := Decode(frame[42:]); err != nil || !reply.YIAddr.Equal(offerIP) {
+		t.Errorf("Expected the offer as payload, got %v (%v)", reply, err)
+	}
+
+	request.SetBroadcast()
+	conn = &frameConn{}
+	if err := SendPacket(conn, request.ToOffer(offerIP, testReplyOptions()), nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.frames) != 0 || len(conn.sent) != 1 || !conn.sent[0].(*net.UDPAddr).IP.Equal(net.IPv4bcast) {
+		t.Errorf("Expected the broadcast flag to be honored, got %v", conn.sent)
+	}
+}
@@ -1,7 +1,9 @@
 package protocol
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
 	"strings"
@@ -9,6 +11,42 @@ import (
 
 var magicCookie = []byte{99, 130, 83, 99}
 
+const (
+	HTypeEthernet     = 1
+	maxHardwareLength = 16
+)
+
+var (
+	ErrPacketTooShort        = errors.New("packet too short")
+	ErrBadMagicCookie        = errors.New("bad magic cookie")
+	ErrInvalidHardwareLength = errors.New("invalid hardware address length")
+	ErrTruncatedOption       = errors.New("truncated option")
+)
+
+// DecodeError reports where a malformed message was rejected.
+type DecodeError struct {
+	Field  string
+	Offset int
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode %s at offset %d: %v", e.Field, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func withField(err error, field string, base int) error {
+	var de *DecodeError
+	if errors.As(err, &de) {
+		de.Field = field
+		de.Offset += base
+	}
+	return err
+}
+
 type Packet struct {
 	Op      byte
 	HType   byte
@@ -52,7 +90,8 @@ func (p *Packet) ToOffer(offerIP net.IP, options *ReplyOptions) *Packet {
 	}
 
 	offer.AddOption(OptionDHCPMessageType, []byte{DHCPOFFER})
-	offer.addCommonOptions(options)
+	offer.echoClientID(p)
+	offer.addReplyOptions(p, options)
 
 	return offer
 }
@@ -74,7 +113,35 @@ func (p *Packet) ToAck(ackIP net.IP, options *ReplyOptions) *Packet {
 	}
 
 	ack.AddOption(OptionDHCPMessageType, []byte{DHCPACK})
-	ack.addCommonOptions(options)
+	ack.echoClientID(p)
+	ack.addReplyOptions(p, options)
+
+	return ack
+}
+
+// ToInformAck answers a DHCPINFORM (RFC 2131 section 4.3.5). The client
+// already has an address, so the ACK carries neither YIAddr nor lease times.
+func (p *Packet) ToInformAck(options *ReplyOptions) *Packet {
+	ack := &Packet{
+		Op:     BOOTREPLY,
+		HType:  p.HType,
+		HLen:   p.HLen,
+		Hops:   0,
+		XId:    p.XId,
+		Secs:   0,
+		Flags:  p.Flags,
+		CIAddr: p.CIAddr,
+		YIAddr: net.IPv4zero,
+		SIAddr: options.ServerIP,
+		GIAddr: p.GIAddr,
+		CHAddr: p.CHAddr,
+	}
+
+	o := *options
+	o.LeaseTime, o.RenewalTime, o.RebindingTime = 0, 0, 0
+	ack.AddOption(OptionDHCPMessageType, []byte{DHCPACK})
+	ack.echoClientID(p)
+	ack.addReplyOptions(p, &o)
 
 	return ack
 }
@@ -95,25 +162,19 @@ func (p *Packet) ToNak(options *ReplyOptions) *Packet {
 		CHAddr: p.CHAddr,
 	}
 
+	if p.GIAddr != nil && !p.GIAddr.IsUnspecified() {
+		// The relay has to broadcast the NAK, the client may not have the
+		// address it asked for (RFC 2131 section 4.3.2).
+		nak.SetBroadcast()
+	}
 	nak.AddOption(OptionDHCPMessageType, []byte{DHCPNAK})
-	nak.AddOption(OptionServerIdentifier, options.ServerIP.To4()) // Server Identifier
+	nak.AddOption(OptionServerIdentifier, EncodeIP(options.ServerIP))
+	nak.echoClientID(p)
+	nak.echoAgentInfo(p.GetOption(OptionDHCPAgentOptions))
 
 	return nak
 }
 
-func (p *Packet) addCommonOptions(options *ReplyOptions) {
-	p.AddOption(OptionSubnetMask, options.SubnetMask)
-	p.AddOption(OptionRouter, options.Router.To4())
-	p.AddOption(OptionDomainNameServer, flattenIPs(options.DNS))
-	p.AddOption(OptionIPAddressLeaseTime, intToBytes(uint32(options.LeaseTime.Seconds())))
-	p.AddOption(OptionServerIdentifier, options.ServerIP.To4())
-	p.AddOption(OptionRenewalTime, intToBytes(uint32(options.RenewalTime.Seconds())))
-	p.AddOption(OptionRebindingTime, intToBytes(uint32(options.RebindingTime.Seconds())))
-	if options.DomainName != "" {
-		p.AddOption(OptionDomainName, []byte(options.DomainName))
-	}
-}
-
 func (p *Packet) Print() {
 	fmt.Printf("Op: %d\n", p.Op)
 	fmt.Printf("Hardware Type: %d\n", p.HType)
@@ -156,9 +217,23 @@ func (p *Packet) Encode() []byte {
 	return data
 }
 
+// Decode parses a DHCP message. The returned packet does not share memory
+// with data, so the caller may reuse the buffer.
 func Decode(data []byte) (*Packet, error) {
-	if len(data) < 240 {
-		return nil, fmt.Errorf("packet too short")
+	if len(data) < fixedHeaderLength {
+		return nil, &DecodeError{Field: "header", Offset: len(data), Err: ErrPacketTooShort}
+	}
+	if !bytes.Equal(data[236:240], magicCookie) {
+		return nil, &DecodeError{Field: "header", Offset: 236, Err: ErrBadMagicCookie}
+	}
+	hlen := int(data[2])
+	if hlen > maxHardwareLength || (data[1] == HTypeEthernet && hlen != 6) {
+		return nil, &DecodeError{Field: "header", Offset: 2, Err: ErrInvalidHardwareLength}
+	}
+
+	end, err := walkOptions(data[fixedHeaderLength:], func(byte, []byte) {})
+	if err != nil {
+		return nil, withField(err, "options", fixedHeaderLength)
 	}
 
 	packet := &Packet{
@@ -169,63 +244,124 @@ func Decode(data []byte) (*Packet, error) {
 		XId:     binary.BigEndian.Uint32(data[4:8]),
 		Secs:    binary.BigEndian.Uint16(data[8:10]),
 		Flags:   binary.BigEndian.Uint16(data[10:12]),
-		CIAddr:  net.IP(data[12:16]),
-		YIAddr:  net.IP(data[16:20]),
-		SIAddr:  net.IP(data[20:24]),
-		GIAddr:  net.IP(data[24:28]),
-		CHAddr:  data[28:44],
-		SName:   data[44:108],
-		File:    data[108:236],
-		Options: data[240:],
+		CIAddr:  clone(data[12:16]),
+		YIAddr:  clone(data[16:20]),
+		SIAddr:  clone(data[20:24]),
+		GIAddr:  clone(data[24:28]),
+		CHAddr:  clone(data[28 : 28+hlen]),
+		SName:   clone(data[44:108]),
+		File:    clone(data[108:236]),
+		Options: clone(data[fixedHeaderLength : fixedHeaderLength+end]),
+	}
+
+	overload, _ := ParseUint8(optionValue(packet.Options, OptionOverload))
+	if overload&overloadFile != 0 {
+		if _, err := walkOptions(packet.File, func(byte, []byte) {}); err != nil {
+			return nil, withField(err, "file", 108)
+		}
+	}
+	if overload&overloadSName != 0 {
+		if _, err := walkOptions(packet.SName, func(byte, []byte) {}); err != nil {
+			return nil, withField(err, "sname", 44)
+		}
 	}
 	return packet, nil
 }
 
+func clone(b []byte) []byte {
+	return append(make([]byte, 0, len(b)), b...)
+}
+
+// walkOptions calls fn for every option in field up to the End option,
+// skipping Pad. It returns the offset of End, or the length of field when
+// there is none.
+func walkOptions(field []byte, fn func(code byte, data []byte)) (int, error) {
+	for i := 0; i < len(field); {
+		code := field[i]
+		switch code {
+		case OptionPad:
+			i++
+			continue
+		case OptionEnd:
+			return i, nil
+		}
+		if i+1 >= len(field) {
+			return i, &DecodeError{Offset: i, Err: ErrTruncatedOption}
+		}
+		n := int(field[i+1])
+		if i+2+n > len(field) {
+			return i, &DecodeError{Offset: i, Err: ErrTruncatedOption}
+		}
+		fn(code, field[i+2:i+2+n])
+		i += 2 + n
+	}
+	return len(field), nil
+}
+
 func getDHCPMessageType(options []byte) string {
 	b := strings.Builder{}
-	for i := 0; i < len(options); {
-		optN := options[i]
-		opt := DHCPOptions[optN]
-		if opt.Name == "End" {
-			break
-		}
-		b.WriteString(opt.Name)
+	_, err := walkOptions(options, func(code byte, data []byte) {
+		b.WriteString(DHCPOptions[code].Name)
 		b.WriteString(": ")
-		size := int(options[i+1])
-		for j := 0; j < size; j++ {
-			if optN == OptionParameterRequestList {
-				b.WriteString(fmt.Sprintf("%s ;", DHCPOptions[options[i+2+j]].Name))
+		for _, v := range data {
+			if code == OptionParameterRequestList {
+				b.WriteString(fmt.Sprintf("%s ;", DHCPOptions[v].Name))
 			} else {
-				b.WriteString(fmt.Sprintf("%d ;", options[i+2+j]))
+				b.WriteString(fmt.Sprintf("%d ;", v))
 			}
 		}
-
-		i += int(options[i+1]) + 2
-
+	})
+	if err != nil {
+		b.WriteString(err.Error())
 	}
 	return b.String()
 }
 
 func (p *Packet) AddOption(code byte, data []byte) {
-	p.Options = append(p.Options, code, byte(len(data)))
-	p.Options = append(p.Options, data...)
+	p.Options = appendOption(p.Options, code, data)
 }
 
+// GetOption returns the value of option code. Options split over several
+// instances are concatenated (RFC 3396), including instances in the file and
+// sname fields when the options field is overloaded.
 func (p *Packet) GetOption(code byte) []byte {
-	for i := 0; i < len(p.Options)-1; {
-		if p.Options[i] == code {
-			length := int(p.Options[i+1])
-			return p.Options[i+2 : i+2+length]
+	value := optionValue(p.Options, code)
+	if code == OptionOverload {
+		return value
+	}
+	overload, _ := ParseUint8(optionValue(p.Options, OptionOverload))
+	if overload&overloadFile != 0 {
+		value = appendValue(value, optionValue(p.File, code))
+	}
+	if overload&overloadSName != 0 {
+		value = appendValue(value, optionValue(p.SName, code))
+	}
+	return value
+}
+
+// optionValue returns the concatenated value of every instance of code in
+// field, or nil when there is none. A truncated option ends the search.
+func optionValue(field []byte, code byte) []byte {
+	var value []byte
+	_, _ = walkOptions(field, func(c byte, data []byte) {
+		if c == code {
+			value = appendValue(value, data)
 		}
-		i += int(p.Options[i+1]) + 2
+	})
+	return value
+}
+
+func appendValue(value, data []byte) []byte {
+	if data == nil {
+		return value
 	}
-	return nil
+	return append(append(make([]byte, 0, len(value)+len(data)), value...), data...)
 }
 
 func (p *Packet) DHCPMessageType() byte {
-	t := p.GetOption(OptionDHCPMessageType)
-	if len(t) != 1 {
+	t, err := p.GetUint8Option(OptionDHCPMessageType)
+	if err != nil {
 		return 0
 	}
-	return t[0]
+	return t
 }
@@ -1,6 +1,9 @@
 package protocol
 
 import (
+	"bytes"
+	"errors"
+	"net"
 	"testing"
 )
 
@@ -19,3 +22,107 @@ var testPacket = []byte{1, 1, 6, 0, 93, 81, 216, 159, 0, 0, 0, 0, 0, 0, 0, 0, 0,
 func TestPacket_Marshal(t *testing.T) {
 	//_, _ = decode(testPacket)
 }
+
+func TestDecode(t *testing.T) {
+	data := append([]byte(nil), testPacket...)
+	p, err := Decode(data)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	for i := range data {
+		data[i] = 0
+	}
+
+	if p.DHCPMessageType() != DHCPREQUEST {
+		t.Errorf("Expected message type %d, got %d", DHCPREQUEST, p.DHCPMessageType())
+	}
+	if !bytes.Equal(p.CHAddr, net.HardwareAddr{0xd8, 0xdc, 0x40, 0xf3, 0xbe, 0xb3}) {
+		t.Errorf("Expected CHAddr d8:dc:40:f3:be:b3, got %s", p.CHAddr)
+	}
+	if ip, err := p.GetIPOption(OptionRequestedIPAddress); err != nil || !ip.Equal(net.IPv4(192, 168, 0, 122)) {
+		t.Errorf("Expected requested IP 192.168.0.122, got %v (%v)", ip, err)
+	}
+	if name, err := p.GetStringOption(OptionHostname); err != nil || name != "iPhone-Denis" {
+		t.Errorf("Expected hostname iPhone-Denis, got %q (%v)", name, err)
+	}
+	if p.Options[len(p.Options)-1] == OptionEnd {
+		t.Errorf("Expected options to stop before End")
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	withOptions := func(options ...byte) []byte {
+		data := append([]byte(nil), testPacket[:fixedHeaderLength]...)
+		return append(data, options...)
+	}
+	testCases := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"short", testPacket[:239], ErrPacketTooShort},
+		{"bad cookie", func() []byte {
+			data := withOptions(OptionEnd)
+			data[239] = 0
+			return data
+		}(), ErrBadMagicCookie},
+		{"ethernet hlen", func() []byte {
+			data := withOptions(OptionEnd)
+			data[2] = 16
+			return data
+		}(), ErrInvalidHardwareLength},
+		{"hlen too long", func() []byte {
+			data := withOptions(OptionEnd)
+			data[1], data[2] = 6, 17
+			return data
+		}(), ErrInvalidHardwareLength},
+		{"missing length", withOptions(OptionPad, OptionDHCPMessageType), ErrTruncatedOption},
+		{"length overrun", withOptions(OptionHostname, 10, 'h', 'o', 's', 't'), ErrTruncatedOption},
+		{"overloaded file", func() []byte {
+			data := withOptions(OptionOverload, 1, overloadFile, OptionEnd)
+			data[108], data[109] = OptionHostname, 200
+			return data
+		}(), ErrTruncatedOption},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Decode(tc.data)
+			var de *DecodeError
+			if !errors.Is(err, tc.want) || !errors.As(err, &de) {
+				t.Errorf("Expected a DecodeError wrapping %v, got %v", tc.want, err)
+			}
+		})
+	}
+
+	p, err := Decode(withOptions(OptionPad, OptionPad, OptionDHCPMessageType, 1, DHCPDISCOVER))
+	if err != nil {
+		t.Fatalf("Expected options without End to decode: %v", err)
+	}
+	if p.DHCPMessageType() != DHCPDISCOVER {
+		t.Errorf("Expected message type %d, got %d", DHCPDISCOVER, p.DHCPMessageType())
+	}
+}
+
+func TestGetOptionConcatenation(t *testing.T) {
+	p := &Packet{
+		Options: []byte{OptionHostname, 2, 'a', 'b', OptionPad, OptionOverload, 1, overloadFile | overloadSName, OptionHostname, 1, 'c'},
+		File:    []byte{OptionHostname, 1, 'd', OptionEnd},
+		SName:   []byte{OptionPad, OptionHostname, 1, 'e', OptionEnd},
+	}
+	if got := string(p.GetOption(OptionHostname)); got != "abcde" {
+		t.Errorf("Expected abcde, got %q", got)
+	}
+
+	p.Options = []byte{OptionHostname, 2, 'a', 'b', OptionDomainName, 9, 'x'}
+	if got := string(p.GetOption(OptionHostname)); got != "ab" {
+		t.Errorf("Expected ab before the truncated option, got %q", got)
+	}
+	if got := p.GetOption(OptionDomainName); got != nil {
+		t.Errorf("Expected no value for a truncated option, got %v", got)
+	}
+	p.Options = []byte{80, 0}
+	if got := p.GetOption(80); got == nil || len(got) != 0 {
+		t.Errorf("Expected an empty value for a zero length option, got %v", got)
+	}
+}
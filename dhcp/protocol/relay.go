@@ -0,0 +1,76 @@
+package protocol
+
+import (
+	"net"
+)
+
+// Relay agent information sub-options (RFC 3046, RFC 3527, RFC 3993,
+// RFC 5107).
+const (
+	AgentCircuitID          byte = 1
+	AgentRemoteID           byte = 2
+	AgentLinkSelection      byte = 5
+	AgentSubscriberID       byte = 6
+	AgentServerIDOverride   byte = 11
+	AgentRelaySourcePortTag byte = 19
+)
+
+// RelayAgentInfo holds the sub-options of option 82 in the order the relay
+// sent them.
+type RelayAgentInfo []Option
+
+func ParseRelayAgentInfo(data []byte) (RelayAgentInfo, error) {
+	if len(data) == 0 {
+		return nil, lengthError("empty relay agent information")
+	}
+	var info RelayAgentInfo
+	for pos := 0; pos < len(data); {
+		if pos+2 > len(data) {
+			return nil, lengthError("truncated sub-option header at offset %d", pos)
+		}
+		code, n := data[pos], int(data[pos+1])
+		if pos+2+n > len(data) {
+			return nil, lengthError("sub-option %d overruns the option", code)
+		}
+		info = append(info, Option{Code: code, Data: append([]byte(nil), data[pos+2:pos+2+n]...)})
+		pos += 2 + n
+	}
+	return info, nil
+}
+
+func (r RelayAgentInfo) Encode() []byte {
+	var data []byte
+	for _, opt := range r {
+		data = append(data, opt.Code, byte(len(opt.Data)))
+		data = append(data, opt.Data...)
+	}
+	return data
+}
+
+// Get returns the value of the first sub-option with the given code.
+func (r RelayAgentInfo) Get(code byte) []byte {
+	for _, opt := range r {
+		if opt.Code == code {
+			return opt.Data
+		}
+	}
+	return nil
+}
+
+func (r RelayAgentInfo) CircuitID() []byte {
+	return r.Get(AgentCircuitID)
+}
+
+func (r RelayAgentInfo) RemoteID() []byte {
+	return r.Get(AgentRemoteID)
+}
+
+// LinkSelection returns the subnet address of the link-selection sub-option
+// (RFC 3527), or nil.
+func (r RelayAgentInfo) LinkSelection() net.IP {
+	ip, err := ParseIP(r.Get(AgentLinkSelection))
+	if err != nil {
+		return nil
+	}
+	return ip
+}
@@ -0,0 +1,245 @@
+package protocol
+
+import (
+	"log/slog"
+)
+
+const (
+	OptionPad            byte = 0
+	OptionOverload       byte = 52
+	OptionMaxMessageSize byte = 57
+
+	// minMaxMessageSize is the IP datagram every client must accept
+	// (RFC 2131 section 2) and the smallest legal option 57 value.
+	minMaxMessageSize = 576
+	ipUDPHeaderLength = 28
+	fixedHeaderLength = 240
+	sNameLength       = 64
+	fileLength        = 128
+
+	overloadFile  = 1
+	overloadSName = 2
+)
+
+// Option is a single encoded DHCP option.
+type Option struct {
+	Code byte
+	Data []byte
+}
+
+// mandatoryOptions are sent in every OFFER and ACK, whatever the client asked
+// for, and always in the options field itself.
+var mandatoryOptions = []byte{
+	OptionServerIdentifier,
+	OptionIPAddressLeaseTime,
+	OptionRenewalTime,
+	OptionRebindingTime,
+}
+
+// encode returns every option configured in o, in the order they are sent to
+// clients that do not send a parameter request list.
+func (o *ReplyOptions) encode() []Option {
+	var opts []Option
+	add := func(code byte, data []byte) {
+		for i := range opts {
+			if opts[i].Code == code {
+				opts[i].Data = data
+				return
+			}
+		}
+		opts = append(opts, Option{Code: code, Data: data})
+	}
+
+	add(OptionServerIdentifier, EncodeIP(o.ServerIP))
+	if o.LeaseTime > 0 {
+		add(OptionIPAddressLeaseTime, EncodeDuration(o.LeaseTime))
+		add(OptionRenewalTime, EncodeDuration(o.RenewalTime))
+		add(OptionRebindingTime, EncodeDuration(o.RebindingTime))
+	}
+	if len(o.SubnetMask) > 0 {
+		add(OptionSubnetMask, o.SubnetMask)
+	}
+	if o.Router != nil {
+		add(OptionRouter, EncodeIP(o.Router))
+	}
+	if len(o.DNS) > 0 {
+		add(OptionDomainNameServer, EncodeIPs(o.DNS))
+	}
+	if o.DomainName != "" {
+		add(OptionDomainName, EncodeString(o.DomainName))
+	}
+	if o.Hostname != "" {
+		add(OptionHostname, EncodeString(o.Hostname))
+	}
+	for _, opt := range o.Extra {
+		add(opt.Code, opt.Data)
+	}
+	return opts
+}
+
+// selectOptions returns the mandatory options, the options listed in Always
+// and the options the client asked for in its parameter request list, in the
+// client's order. Without a parameter request list every option is sent.
+func (o *ReplyOptions) selectOptions(request *Packet) []Option {
+	all := o.encode()
+	prl := request.GetOption(OptionParameterRequestList)
+	if len(prl) == 0 {
+		return all
+	}
+
+	byCode := make(map[byte]Option, len(all))
+	for _, opt := range all {
+		byCode[opt.Code] = opt
+	}
+	selected := make([]Option, 0, len(all))
+	seen := make(map[byte]bool, len(all))
+	pick := func(code byte) {
+		if opt, ok := byCode[code]; ok && !seen[code] {
+			seen[code] = true
+			selected = append(selected, opt)
+		}
+	}
+	for _, code := range mandatoryOptions {
+		pick(code)
+	}
+	for _, code := range o.Always {
+		pick(code)
+	}
+	for _, code := range prl {
+		pick(code)
+	}
+	return selected
+}
+
+// maxReplySize returns the largest DHCP message the client accepts, bounded
+// by its maximum message size (option 57) and the interface MTU. Both are
+// IP datagram sizes.
+func (o *ReplyOptions) maxReplySize(request *Packet) int {
+	limit := minMaxMessageSize
+	if size, err := request.GetUint16Option(OptionMaxMessageSize); err == nil && int(size) > limit {
+		limit = int(size)
+	}
+	if o.MTU >= minMaxMessageSize && o.MTU < limit {
+		limit = o.MTU
+	}
+	return limit - ipUDPHeaderLength
+}
+
+// addReplyOptions selects the options for the reply to request and packs
+// them into the options field, overloading the file and sname fields
+// (option 52) when they do not fit.
+func (p *Packet) addReplyOptions(request *Packet, options *ReplyOptions) {
+	selected := options.selectOptions(request)
+	agentInfo := request.GetOption(OptionDHCPAgentOptions)
+	space := options.maxReplySize(request) - fixedHeaderLength - len(p.Options) - 1
+	if agentInfo != nil {
+		space -= encodedLength([]Option{{Code: OptionDHCPAgentOptions, Data: agentInfo}})
+	}
+	defer p.echoAgentInfo(agentInfo)
+
+	if encodedLength(selected) <= space {
+		for _, opt := range selected {
+			p.AddOption(opt.Code, opt.Data)
+		}
+		return
+	}
+
+	// The overload option itself has to fit into the options field.
+	space -= 3
+	var file, sname []byte
+	fileSpace, snameSpace := fileLength-1, sNameLength-1
+	for _, opt := range selected {
+		size := encodedLength([]Option{opt})
+		switch {
+		case size <= space:
+			p.AddOption(opt.Code, opt.Data)
+			space -= size
+		case isMandatory(opt.Code):
+			slog.Warn("Mandatory option does not fit into reply", "option", opt.Code)
+		case size <= fileSpace:
+			file = appendOption(file, opt.Code, opt.Data)
+			fileSpace -= size
+		case size <= snameSpace:
+			sname = appendOption(sname, opt.Code, opt.Data)
+			snameSpace -= size
+		default:
+			slog.Warn("Dropping option that does not fit into reply", "option", opt.Code, "size", size)
+		}
+	}
+
+	var overload byte
+	if file != nil {
+		overload |= overloadFile
+		p.File = overloadField(file, fileLength)
+	}
+	if sname != nil {
+		overload |= overloadSName
+		p.SName = overloadField(sname, sNameLength)
+	}
+	if overload != 0 {
+		p.AddOption(OptionOverload, []byte{overload})
+	}
+}
+
+// echoAgentInfo copies the relay agent information of the request into the
+// reply. RFC 3046 section 2.2 requires it to be the last option.
+func (p *Packet) echoAgentInfo(agentInfo []byte) {
+	if agentInfo != nil {
+		p.AddOption(OptionDHCPAgentOptions, agentInfo)
+	}
+}
+
+// echoClientID copies the client identifier (option 61) of the request into
+// the reply, as RFC 6842 requires.
+func (p *Packet) echoClientID(request *Packet) {
+	if id := request.GetOption(OptionClientIdentifier); id != nil {
+		p.AddOption(OptionClientIdentifier, id)
+	}
+}
+
+func isMandatory(code byte) bool {
+	for _, c := range mandatoryOptions {
+		if c == code {
+			return true
+		}
+	}
+	return code == OptionDHCPMessageType
+}
+
+func overloadField(options []byte, size int) []byte {
+	field := make([]byte, size)
+	n := copy(field, options)
+	field[n] = OptionEnd
+	return field
+}
+
+// encodedLength is the number of bytes opts take on the wire, including the
+// extra headers of options longer than 255 bytes (RFC 3396).
+func encodedLength(opts []Option) int {
+	n := 0
+	for _, opt := range opts {
+		chunks := (len(opt.Data) + 254) / 255
+		if chunks == 0 {
+			chunks = 1
+		}
+		n += 2*chunks + len(opt.Data)
+	}
+	return n
+}
+
+// appendOption encodes an option, splitting values longer than 255 bytes into
+// consecutive instances of the same option as described in RFC 3396.
+func appendOption(b []byte, code byte, data []byte) []byte {
+	for {
+		chunk := data
+		if len(chunk) > 255 {
+			chunk = chunk[:255]
+		}
+		b = append(b, code, byte(len(chunk)))
+		b = append(b, chunk...)
+		data = data[len(chunk):]
+		if len(data) == 0 {
+			return b
+		}
+	}
+}
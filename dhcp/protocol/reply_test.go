@@ -0,0 +1,200 @@
+package protocol
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func testReplyOptions() *ReplyOptions {
+	return &ReplyOptions{
+		LeaseTime:     time.Hour,
+		RenewalTime:   30 * time.Minute,
+		RebindingTime: 45 * time.Minute,
+		SubnetMask:    net.IPv4Mask(255, 255, 255, 0),
+		Router:        net.ParseIP("192.168.1.1"),
+		DNS:           []net.IP{net.ParseIP("8.8.8.8")},
+		ServerIP:      net.ParseIP("192.168.1.2"),
+		DomainName:    "example.com",
+		Hostname:      "host",
+		Extra:         []Option{{Code: OptionNetworkTimeProtocol, Data: []byte{10, 0, 0, 1}}, {Code: 252, Data: []byte("wpad")}},
+		Always:        []byte{252},
+		MTU:           1500,
+	}
+}
+
+func optionCodes(options []byte) []byte {
+	var codes []byte
+	for i := 0; i+1 < len(options) && options[i] != OptionEnd; {
+		if options[i] == OptionPad {
+			i++
+			continue
+		}
+		codes = append(codes, options[i])
+		i += 2 + int(options[i+1])
+	}
+	return codes
+}
+
+func TestReplyOptionSelection(t *testing.T) {
+	testCases := []struct {
+		name    string
+		prl     []byte
+		want    []byte
+		options func(*ReplyOptions)
+	}{
+		{
+			name: "client order",
+			prl:  []byte{OptionDomainName, OptionDomainNameServer, OptionRouter, OptionSubnetMask},
+			want: []byte{OptionDHCPMessageType, OptionServerIdentifier, OptionIPAddressLeaseTime, OptionRenewalTime, OptionRebindingTime, 252,
+				OptionDomainName, OptionDomainNameServer, OptionRouter, OptionSubnetMask},
+		},
+		{
+			name: "unknown and duplicate codes",
+			prl:  []byte{OptionSubnetMask, 200, OptionServerIdentifier, OptionNetworkTimeProtocol, OptionSubnetMask},
+			want: []byte{OptionDHCPMessageType, OptionServerIdentifier, OptionIPAddressLeaseTime, OptionRenewalTime, OptionRebindingTime, 252,
+				OptionSubnetMask, OptionNetworkTimeProtocol},
+		},
+		{
+			name: "no parameter request list",
+			want: []byte{OptionDHCPMessageType, OptionServerIdentifier, OptionIPAddressLeaseTime, OptionRenewalTime, OptionRebindingTime,
+				OptionSubnetMask, OptionRouter, OptionDomainNameServer, OptionDomainName, OptionHostname, OptionNetworkTimeProtocol, 252},
+		},
+		{
+			name:    "extra option replaces built-in",
+			prl:     []byte{OptionRouter},
+			options: func(o *ReplyOptions) { o.Extra = []Option{{Code: OptionRouter, Data: []byte{192, 168, 1, 254}}} },
+			want: []byte{OptionDHCPMessageType, OptionServerIdentifier, OptionIPAddressLeaseTime, OptionRenewalTime, OptionRebindingTime,
+				OptionRouter},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			options := testReplyOptions()
+			if tc.options != nil {
+				tc.options(options)
+			}
+			request := &Packet{CHAddr: net.HardwareAddr{0, 1, 2, 3, 4, 5}}
+			if tc.prl != nil {
+				request.AddOption(OptionParameterRequestList, tc.prl)
+			}
+			offer := request.ToOffer(net.ParseIP("192.168.1.100"), options)
+			if got := optionCodes(offer.Options); !bytes.Equal(got, tc.want) {
+				t.Errorf("Options = %v, want %v", got, tc.want)
+			}
+			if tc.name == "extra option replaces built-in" {
+				if got := offer.GetOption(OptionRouter); !bytes.Equal(got, []byte{192, 168, 1, 254}) {
+					t.Errorf("Router = %v, want override", got)
+				}
+			}
+		})
+	}
+}
+
+func TestReplyOverload(t *testing.T) {
+	options := testReplyOptions()
+	options.Extra = []Option{
+		{Code: 224, Data: bytes.Repeat([]byte{1}, 250)},
+		{Code: 225, Data: bytes.Repeat([]byte{2}, 100)},
+		{Code: 226, Data: bytes.Repeat([]byte{3}, 50)},
+		{Code: 227, Data: bytes.Repeat([]byte{4}, 250)},
+	}
+	options.Always = []byte{224, 225, 226, 227}
+	request := &Packet{CHAddr: net.HardwareAddr{0, 1, 2, 3, 4, 5}}
+	request.AddOption(OptionParameterRequestList, []byte{OptionSubnetMask})
+
+	offer := request.ToOffer(net.ParseIP("192.168.1.100"), options)
+	if size := len(offer.Encode()); size > minMaxMessageSize-ipUDPHeaderLength {
+		t.Errorf("Reply of %d bytes exceeds the default maximum message size", size)
+	}
+	if got := offer.GetOption(OptionOverload); !bytes.Equal(got, []byte{overloadFile | overloadSName}) {
+		t.Fatalf("Overload = %v, want both fields", got)
+	}
+	if got := optionCodes(offer.File); !bytes.Equal(got, []byte{225}) {
+		t.Errorf("File options = %v, want [225]", got)
+	}
+	if got := optionCodes(offer.SName); !bytes.Equal(got, []byte{226}) {
+		t.Errorf("SName options = %v, want [226]", got)
+	}
+	if offer.GetOption(227) != nil {
+		t.Errorf("Expected option that fits nowhere to be dropped")
+	}
+	if offer.GetOption(OptionServerIdentifier) == nil || offer.GetOption(224) == nil {
+		t.Errorf("Expected mandatory and fitting options in the options field")
+	}
+
+	request.AddOption(OptionMaxMessageSize, []byte{0x05, 0xdc})
+	offer = request.ToOffer(net.ParseIP("192.168.1.100"), options)
+	if offer.GetOption(OptionOverload) != nil || offer.GetOption(227) == nil {
+		t.Errorf("Expected every option to fit with a maximum message size of 1500")
+	}
+
+	options.MTU = 576
+	offer = request.ToOffer(net.ParseIP("192.168.1.100"), options)
+	if offer.GetOption(OptionOverload) == nil {
+		t.Errorf("Expected the MTU to bound the client's maximum message size")
+	}
+}
+
+func TestAddLongOption(t *testing.T) {
+	p := &Packet{}
+	p.AddOption(OptionDomainSearch, bytes.Repeat([]byte{'a'}, 300))
+	if len(p.Options) != 304 || p.Options[1] != 255 || p.Options[257] != OptionDomainSearch || p.Options[258] != 45 {
+		t.Errorf("Expected option to be split into 255 and 45 byte parts, got %d bytes", len(p.Options))
+	}
+}
+
+func TestAgentInfoEcho(t *testing.T) {
+	agentInfo := RelayAgentInfo{
+		{Code: AgentCircuitID, Data: []byte("Gi1/0/7")},
+		{Code: AgentRemoteID, Data: []byte{0, 1, 2, 3, 4, 5}},
+	}.Encode()
+	request := &Packet{CHAddr: net.HardwareAddr{0, 1, 2, 3, 4, 5}, GIAddr: net.ParseIP("10.0.0.1")}
+	request.AddOption(OptionDHCPAgentOptions, agentInfo)
+	options := testReplyOptions()
+	options.Extra = append(options.Extra, Option{Code: 224, Data: bytes.Repeat([]byte{1}, 250)})
+	options.Always = []byte{224}
+
+	replies := map[string]*Packet{
+		"offer": request.ToOffer(net.ParseIP("10.0.0.100"), options),
+		"ack":   request.ToAck(net.ParseIP("10.0.0.100"), options),
+		"nak":   request.ToNak(options),
+	}
+	for name, reply := range replies {
+		codes := optionCodes(reply.Options)
+		if codes[len(codes)-1] != OptionDHCPAgentOptions {
+			t.Errorf("Expected option 82 last in the %s, got %v", name, codes)
+		}
+		if got := reply.GetOption(OptionDHCPAgentOptions); !bytes.Equal(got, agentInfo) {
+			t.Errorf("Expected the %s to echo %x, got %x", name, agentInfo, got)
+		}
+		if size := len(reply.Encode()); size > minMaxMessageSize-ipUDPHeaderLength {
+			t.Errorf("The %s of %d bytes exceeds the default maximum message size", name, size)
+		}
+	}
+
+	plain := &Packet{CHAddr: net.HardwareAddr{0, 1, 2, 3, 4, 5}}
+	if plain.ToOffer(net.ParseIP("10.0.0.100"), options).GetOption(OptionDHCPAgentOptions) != nil {
+		t.Errorf("Expected no option 82 in replies to unrelayed requests")
+	}
+}
+
+func TestClientIDEcho(t *testing.T) {
+	clientID := []byte{0xff, 0, 0, 0, 1, 0, 1, 0x2a, 0x3b}
+	request := &Packet{CHAddr: net.HardwareAddr{0, 1, 2, 3, 4, 5}, CIAddr: net.ParseIP("10.0.0.100")}
+	request.AddOption(OptionClientIdentifier, clientID)
+	options := testReplyOptions()
+
+	replies := map[string]*Packet{
+		"offer":  request.ToOffer(net.ParseIP("10.0.0.100"), options),
+		"ack":    request.ToAck(net.ParseIP("10.0.0.100"), options),
+		"inform": request.ToInformAck(options),
+		"nak":    request.ToNak(options),
+	}
+	for name, reply := range replies {
+		if got := reply.GetOption(OptionClientIdentifier); !bytes.Equal(got, clientID) {
+			t.Errorf("Expected the %s to echo client id %x, got %x", name, clientID, got)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package protocol
+
+import (
+	"fmt"
+	"net"
+)
+
+// Route is a classless static route (option 121, RFC 3442).
+type Route struct {
+	Destination net.IPNet
+	Router      net.IP
+}
+
+func EncodeClasslessRoutes(routes []Route) ([]byte, error) {
+	var data []byte
+	for _, r := range routes {
+		dest := r.Destination.IP.To4()
+		width, bits := r.Destination.Mask.Size()
+		if dest == nil || bits != 32 {
+			return nil, fmt.Errorf("route destination %s is not an IPv4 network", &r.Destination)
+		}
+		router := r.Router.To4()
+		if router == nil {
+			return nil, fmt.Errorf("route router %s is not an IPv4 address", r.Router)
+		}
+		data = append(data, byte(width))
+		data = append(data, dest.Mask(r.Destination.Mask)[:(width+7)/8]...)
+		data = append(data, router...)
+	}
+	return data, nil
+}
+
+func ParseClasslessRoutes(data []byte) ([]Route, error) {
+	if len(data) == 0 {
+		return nil, lengthError("empty route list")
+	}
+	var routes []Route
+	for pos := 0; pos < len(data); {
+		width := int(data[pos])
+		if width > 32 {
+			return nil, fmt.Errorf("invalid prefix length %d at offset %d", width, pos)
+		}
+		significant := (width + 7) / 8
+		if pos+1+significant+4 > len(data) {
+			return nil, lengthError("truncated route at offset %d", pos)
+		}
+		dest := make(net.IP, net.IPv4len)
+		copy(dest, data[pos+1:pos+1+significant])
+		mask := net.CIDRMask(width, 32)
+		if !dest.Mask(mask).Equal(dest) {
+			return nil, fmt.Errorf("destination %s has bits set beyond /%d", dest, width)
+		}
+		router, _ := ParseIP(data[pos+1+significant : pos+1+significant+4])
+		routes = append(routes, Route{
+			Destination: net.IPNet{IP: dest, Mask: mask},
+			Router:      router,
+		})
+		pos += 1 + significant + 4
+	}
+	return routes, nil
+}
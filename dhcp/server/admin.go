@@ -0,0 +1,233 @@
+package server
+
+import (
+	"bytes"
+	"dhcp/lease"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrLeaseNotFound       = errors.New("lease not found")
+	ErrLeaseNotBound       = errors.New("lease is not bound")
+	ErrReservationNotFound = errors.New("reservation not found")
+	ErrAddressInUse        = errors.New("address is leased to another client")
+	ErrAddressQuarantined  = errors.New("address is quarantined")
+)
+
+// LeaseFilter selects leases by their fields. Empty fields match every
+// lease, hostnames are compared case-insensitively.
+type LeaseFilter struct {
+	MAC      net.HardwareAddr
+	IP       net.IP
+	Hostname string
+	Scope    string
+	State    LeaseState
+}
+
+func (f LeaseFilter) match(l Lease) bool {
+	return (f.MAC == nil || l.MAC.String() == f.MAC.String()) &&
+		(f.IP == nil || l.IP.Equal(f.IP)) &&
+		(f.Hostname == "" || strings.EqualFold(l.Hostname, f.Hostname)) &&
+		(f.Scope == "" || l.Scope == f.Scope) &&
+		(f.State == "" || l.State == f.State)
+}
+
+// FindLeases returns the leases matching f ordered by IP.
+func (s *Server) FindLeases(f LeaseFilter) []Lease {
+	var found []Lease
+	for _, l := range s.Leases() {
+		if f.match(l) {
+			found = append(found, l)
+		}
+	}
+	return found
+}
+
+// Lease returns the lease of ip.
+func (s *Server) Lease(ip net.IP) (Lease, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if q, ok := s.quarantined[IPToUint32(ip)]; ok {
+		return s.quarantinedLease(q), nil
+	}
+	if _, b := s.bindingForIP(ip); b != nil {
+		return s.leaseOf(b), nil
+	}
+	return Lease{}, ErrLeaseNotFound
+}
+
+// ReleaseLease ends the lease of ip as if its client had released it, or
+// ends the quarantine of ip. The address goes back to its pool.
+func (s *Server) ReleaseLease(ip net.IP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, ok := s.quarantined[IPToUint32(ip)]; ok {
+		s.releaseQuarantined(q, time.Now())
+		return nil
+	}
+	if _, b := s.bindingForIP(ip); b == nil {
+		return ErrLeaseNotFound
+	}
+	s.releaseIPLocked(ip, lease.OpRelease)
+	slog.Info("Released lease", "ip", ip)
+	return nil
+}
+
+// ExtendLease moves the expiration of the bound lease of ip d further, or d
+// from now when it has expired.
+func (s *Server) ExtendLease(ip net.IP, d time.Duration) (Lease, error) {
+	if d <= 0 {
+		return Lease{}, fmt.Errorf("invalid duration %s", d)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, b := s.bindingForIP(ip)
+	if b == nil {
+		return Lease{}, ErrLeaseNotFound
+	}
+	if b.State != LeaseBound {
+		return Lease{}, ErrLeaseNotBound
+	}
+	extended := *b
+	extended.Expiration = later(b.Expiration, time.Now()).Add(d)
+	if err := s.persist(lease.OpAck, &extended); err != nil {
+		return Lease{}, fmt.Errorf("failed to persist lease: %w", err)
+	}
+	*b = extended
+	s.scheduleExpiry(b.IP, s.expiresAt(b))
+	slog.Info("Extended lease", "ip", ip, "expiration", b.Expiration.Format(time.RFC3339))
+	return s.leaseOf(b), nil
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// Reservations returns the configured and added reservations.
+func (s *Server) Reservations() []Reservation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Reservation(nil), s.reservations.list...)
+}
+
+// AddReservation reserves r.IP for the client of r. The address must not be
+// leased to another client. Added reservations are written to the lease
+// store and restored on restart.
+func (s *Server) AddReservation(r Reservation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkReservation(r); err != nil {
+		return err
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Append(lease.Record{Op: lease.OpReserve, IP: r.IP, Time: time.Now(), Reservation: data}); err != nil {
+		return fmt.Errorf("failed to persist reservation: %w", err)
+	}
+	s.addReservation(r)
+	slog.Info("Added reservation", "ip", r.IP, "hostname", r.Hostname)
+	return nil
+}
+
+// checkReservation reports why r cannot be added to the reservations.
+func (s *Server) checkReservation(r Reservation) error {
+	c := *s.config
+	c.Reservations = append(append([]Reservation(nil), s.reservations.list...), r)
+	if err := c.validateReservations(); err != nil {
+		return err
+	}
+	if _, ok := s.quarantined[IPToUint32(r.IP)]; ok {
+		return fmt.Errorf("%s: %w", r.IP, ErrAddressQuarantined)
+	}
+	if _, b := s.bindingForIP(r.IP); b != nil && !r.matches(b) {
+		return ErrAddressInUse
+	}
+	return nil
+}
+
+// addReservation adds r, which passed checkReservation, to the reservations.
+func (s *Server) addReservation(r Reservation) {
+	n := IPToUint32(r.IP)
+	// A reserved address is never returned to the pool, so the address
+	// is kept out of it even if the client has it from there already.
+	if s.allocated[n] {
+		delete(s.allocated, n)
+	} else if sc := s.scopeForIP(r.IP); sc != nil {
+		sc.poolFor(r.IP).Take(r.IP)
+	}
+	s.reservations = newReservationTable(append(append([]Reservation(nil), s.reservations.list...), r))
+	s.added = append(s.added, r)
+}
+
+// restoreReservation adds the reservation of an OpReserve record unless it
+// conflicts with the configured ones.
+func (s *Server) restoreReservation(rec lease.Record) bool {
+	var r Reservation
+	err := json.Unmarshal(rec.Reservation, &r)
+	if err == nil {
+		err = s.checkReservation(r)
+	}
+	if err != nil {
+		slog.Warn("Ignoring persisted reservation", "ip", rec.IP, "error", err)
+		return false
+	}
+	s.addReservation(r)
+	return true
+}
+
+// RemoveReservation removes the reservation of ip. A client that holds the
+// address keeps its lease, the address goes back to the pool when it ends.
+func (s *Server) RemoveReservation(ip net.IP) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Reservation, 0, len(s.reservations.list))
+	for _, r := range s.reservations.list {
+		if !r.IP.Equal(ip) {
+			list = append(list, r)
+		}
+	}
+	if len(list) == len(s.reservations.list) {
+		return ErrReservationNotFound
+	}
+	if err := s.store.Append(lease.Record{Op: lease.OpUnreserve, IP: ip, Time: time.Now()}); err != nil {
+		return fmt.Errorf("failed to persist reservation: %w", err)
+	}
+	s.reservations = newReservationTable(list)
+	s.added = slices.DeleteFunc(s.added, func(r Reservation) bool { return r.IP.Equal(ip) })
+
+	if sc := s.scopeForIP(ip); sc != nil && sc.poolFor(ip).Contains(ip) {
+		if _, b := s.bindingForIP(ip); b != nil {
+			s.allocated[IPToUint32(ip)] = true
+		} else {
+			sc.poolFor(ip).Release(ip)
+		}
+	}
+	slog.Info("Removed reservation", "ip", ip)
+	return nil
+}
+
+// matches reports whether b belongs to the client r is for.
+func (r *Reservation) matches(b *binding) bool {
+	switch {
+	case len(r.ClientID) > 0 && bytes.Equal(r.ClientID, b.ClientID):
+		return true
+	case r.MAC != nil && r.MAC.String() == b.MAC.String():
+		return true
+	case r.CircuitID != nil || r.RemoteID != nil:
+		return (r.CircuitID == nil || bytes.Equal(r.CircuitID, b.CircuitID)) &&
+			(r.RemoteID == nil || bytes.Equal(r.RemoteID, b.RemoteID))
+	}
+	return false
+}
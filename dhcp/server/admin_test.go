@@ -0,0 +1,183 @@
+package server
+
+import (
+	"dhcp/lease"
+	"dhcp/protocol"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// bindLease runs a DISCOVER and REQUEST for mac and returns the leased
+// address.
+func bindLease(t *testing.T, s *Server, mac net.HardwareAddr, hostname string) net.IP {
+	t.Helper()
+	discover := newDiscover(mac)
+	discover.AddOption(protocol.OptionHostname, []byte(hostname))
+	s.handleDiscover(discover, nil)
+	offer := s.conn.(*mockConn).sentPacket()
+	if offer == nil {
+		t.Fatalf("Expected an offer for %s", mac)
+	}
+	s.handleRequest(newSelectingRequest(mac, offer.YIAddr), nil)
+	if ack := s.conn.(*mockConn).sentPacket(); ack.DHCPMessageType() != protocol.DHCPACK {
+		t.Fatalf("Expected an ACK for %s, got %v", mac, ack)
+	}
+	return offer.YIAddr
+}
+
+func TestReleaseAndExtendLease(t *testing.T) {
+	store := lease.NewMemoryStore()
+	s := newTestServer(t, newTestConfig(), store)
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	ip := bindLease(t, s, mac, "laptop")
+
+	l, err := s.Lease(ip)
+	if err != nil || l.Hostname != "laptop" || l.Scope != defaultScopeName || l.State != LeaseBound {
+		t.Fatalf("Unexpected lease %+v, %v", l, err)
+	}
+	extended, err := s.ExtendLease(ip, time.Hour)
+	if err != nil {
+		t.Fatalf("ExtendLease: %v", err)
+	}
+	if want := l.Expiration.Add(time.Hour); !extended.Expiration.Equal(want) {
+		t.Errorf("Expected expiration %s, got %s", want, extended.Expiration)
+	}
+	records, _ := lease.Load(store)
+	if len(records) != 1 || !records[0].Expiration.Equal(extended.Expiration) || records[0].Hostname != "laptop" {
+		t.Errorf("Expected the extension to be persisted, got %+v", records)
+	}
+
+	if err := s.ReleaseLease(ip); err != nil {
+		t.Fatalf("ReleaseLease: %v", err)
+	}
+	if _, err := s.Lease(ip); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("Expected the lease to be gone, got %v", err)
+	}
+	if !s.scopes[0].pool.Take(ip) {
+		t.Errorf("Expected %s to be back in the pool", ip)
+	}
+	if records, _ := lease.Load(store); len(records) != 0 {
+		t.Errorf("Expected the release to be persisted, got %+v", records)
+	}
+	if err := s.ReleaseLease(ip); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("Expected ErrLeaseNotFound, got %v", err)
+	}
+	if _, err := s.ExtendLease(ip, time.Hour); !errors.Is(err, ErrLeaseNotFound) {
+		t.Errorf("Expected ErrLeaseNotFound, got %v", err)
+	}
+}
+
+func TestFindLeases(t *testing.T) {
+	s := newTestServer(t, newTestConfig(), lease.NewMemoryStore())
+	laptop := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	bindLease(t, s, laptop, "laptop")
+	phone := bindLease(t, s, net.HardwareAddr{0x02, 0, 0, 0, 0, 2}, "phone")
+	s.handleDiscover(newDiscover(net.HardwareAddr{0x02, 0, 0, 0, 0, 3}), nil)
+
+	testCases := []struct {
+		name   string
+		filter LeaseFilter
+		want   int
+	}{
+		{"all", LeaseFilter{}, 3},
+		{"mac", LeaseFilter{MAC: laptop}, 1},
+		{"ip", LeaseFilter{IP: phone}, 1},
+		{"hostname", LeaseFilter{Hostname: "PHONE"}, 1},
+		{"scope", LeaseFilter{Scope: defaultScopeName}, 3},
+		{"other scope", LeaseFilter{Scope: "lab"}, 0},
+		{"state", LeaseFilter{State: LeaseOffered}, 1},
+		{"combined", LeaseFilter{MAC: laptop, State: LeaseOffered}, 0},
+	}
+	for _, tc := range testCases {
+		if got := s.FindLeases(tc.filter); len(got) != tc.want {
+			t.Errorf("%s: expected %d leases, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestAddAndRemoveReservation(t *testing.T) {
+	s := newTestServer(t, newTestConfig(), lease.NewMemoryStore())
+	conn := s.conn.(*mockConn)
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	other := net.HardwareAddr{0x02, 0, 0, 0, 0, 2}
+	leased := bindLease(t, s, other, "")
+
+	if err := s.AddReservation(Reservation{MAC: mac, IP: leased}); !errors.Is(err, ErrAddressInUse) {
+		t.Errorf("Expected ErrAddressInUse, got %v", err)
+	}
+	var fe *FieldError
+	if err := s.AddReservation(Reservation{MAC: mac, IP: net.ParseIP("10.0.0.1")}); !errors.As(err, &fe) {
+		t.Errorf("Expected a field error, got %v", err)
+	}
+
+	reserved := net.ParseIP("192.168.1.150")
+	if err := s.AddReservation(Reservation{MAC: mac, IP: reserved, Hostname: "printer"}); err != nil {
+		t.Fatalf("AddReservation: %v", err)
+	}
+	if err := s.AddReservation(Reservation{MAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 3}, IP: reserved}); err == nil {
+		t.Errorf("Expected an error for an address reserved twice")
+	}
+	if s.scopes[0].pool.Take(reserved) {
+		t.Errorf("Expected %s to be taken out of the pool", reserved)
+	}
+	s.handleDiscover(newDiscover(mac), nil)
+	if offer := conn.sentPacket(); !offer.YIAddr.Equal(reserved) {
+		t.Errorf("Expected the reserved %s to be offered, got %s", reserved, offer.YIAddr)
+	}
+	if got := s.Reservations(); len(got) != 1 || got[0].Hostname != "printer" {
+		t.Errorf("Unexpected reservations %+v", got)
+	}
+
+	if err := s.RemoveReservation(reserved); err != nil {
+		t.Fatalf("RemoveReservation: %v", err)
+	}
+	if err := s.RemoveReservation(reserved); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("Expected ErrReservationNotFound, got %v", err)
+	}
+	// The offered client keeps the address until its binding ends.
+	if s.scopes[0].pool.Take(reserved) {
+		t.Errorf("Expected %s to stay taken while it is offered", reserved)
+	}
+	s.releaseIP(reserved, lease.OpRelease)
+	if !s.scopes[0].pool.Take(reserved) {
+		t.Errorf("Expected %s to be back in the pool", reserved)
+	}
+}
+
+func TestReservationsSurviveRestart(t *testing.T) {
+	store := lease.NewMemoryStore()
+	s := newTestServer(t, newTestConfig(), store)
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	reserved := net.ParseIP("192.168.1.150")
+	dns := net.ParseIP("192.168.1.53")
+	if err := s.AddReservation(Reservation{MAC: mac, IP: reserved, Hostname: "printer", Options: HostOptions{DNS: []net.IP{dns}}}); err != nil {
+		t.Fatalf("AddReservation: %v", err)
+	}
+	removed := net.ParseIP("192.168.1.151")
+	if err := s.AddReservation(Reservation{MAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 2}, IP: removed}); err != nil {
+		t.Fatalf("AddReservation: %v", err)
+	}
+	if err := s.RemoveReservation(removed); err != nil {
+		t.Fatalf("RemoveReservation: %v", err)
+	}
+
+	s = newTestServer(t, newTestConfig(), store)
+	got := s.Reservations()
+	if len(got) != 1 || !got[0].IP.Equal(reserved) || got[0].MAC.String() != mac.String() || got[0].Hostname != "printer" ||
+		len(got[0].Options.DNS) != 1 || !got[0].Options.DNS[0].Equal(dns) {
+		t.Fatalf("Expected the added reservation to be restored, got %+v", got)
+	}
+	if s.scopes[0].pool.Take(reserved) {
+		t.Errorf("Expected %s to stay out of the pool", reserved)
+	}
+
+	// A reservation configured since then takes precedence.
+	cfg := newTestConfig()
+	cfg.Reservations = []Reservation{{MAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 3}, IP: reserved}}
+	s = newTestServer(t, cfg, store)
+	if got := s.Reservations(); len(got) != 1 || got[0].MAC.String() != "02:00:00:00:00:03" {
+		t.Errorf("Expected only the configured reservation, got %+v", got)
+	}
+}
@@ -0,0 +1,289 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// AdminConfig enables the admin API on its own address. Requests have to
+// carry the token as a bearer token.
+type AdminConfig struct {
+	Addr  string `json:"addr"`
+	Token string `json:"token"`
+}
+
+func (c *AdminConfig) validate() error {
+	if c.Addr == "" {
+		return fieldError("admin.addr", "is required")
+	}
+	if c.Token == "" {
+		return fieldError("admin.token", "is required")
+	}
+	return nil
+}
+
+// maxRequestBody limits the size of admin API request bodies.
+const maxRequestBody = 1 << 20
+
+// AdminHandler serves the admin API, rejecting requests without the
+// configured token.
+func (s *Server) AdminHandler() http.Handler {
+	api := s.apiHandler()
+	token := ""
+	s.mu.RLock()
+	if s.config.Admin != nil {
+		token = s.config.Admin.Token
+	}
+	s.mu.RUnlock()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid token"))
+			return
+		}
+		api.ServeHTTP(w, r)
+	})
+}
+
+// apiHandler serves the admin API without authentication.
+func (s *Server) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/leases", s.apiListLeases)
+	mux.HandleFunc("GET /api/v1/leases/{ip}", s.apiGetLease)
+	mux.HandleFunc("POST /api/v1/leases/{ip}/release", s.apiReleaseLease)
+	mux.HandleFunc("POST /api/v1/leases/{ip}/extend", s.apiExtendLease)
+	mux.HandleFunc("GET /api/v1/reservations", s.apiListReservations)
+	mux.HandleFunc("POST /api/v1/reservations", s.apiAddReservation)
+	mux.HandleFunc("DELETE /api/v1/reservations/{ip}", s.apiRemoveReservation)
+	mux.HandleFunc("GET /api/v1/pools", s.apiPools)
+	mux.HandleFunc("GET /api/v1/stats", s.apiStats)
+	mux.HandleFunc("POST /api/v1/config/reload", s.apiReloadConfig)
+	return mux
+}
+
+func (s *Server) apiListLeases(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := LeaseFilter{
+		Hostname: q.Get("hostname"),
+		Scope:    q.Get("scope"),
+		State:    LeaseState(q.Get("state")),
+	}
+	if v := q.Get("mac"); v != "" {
+		mac, err := net.ParseMAC(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid mac: %w", err))
+			return
+		}
+		f.MAC = mac
+	}
+	if v := q.Get("ip"); v != "" {
+		if f.IP = net.ParseIP(v); f.IP == nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ip %q", v))
+			return
+		}
+	}
+	switch f.State {
+	case "", LeaseOffered, LeaseBound, LeaseQuarantined:
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid state %q", f.State))
+		return
+	}
+	leases := s.FindLeases(f)
+	if leases == nil {
+		leases = []Lease{}
+	}
+	writeJSON(w, http.StatusOK, leases)
+}
+
+func (s *Server) apiGetLease(w http.ResponseWriter, r *http.Request) {
+	ip, ok := pathIP(w, r)
+	if !ok {
+		return
+	}
+	l, err := s.Lease(ip)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+func (s *Server) apiReleaseLease(w http.ResponseWriter, r *http.Request) {
+	ip, ok := pathIP(w, r)
+	if !ok {
+		return
+	}
+	if err := s.ReleaseLease(ip); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) apiExtendLease(w http.ResponseWriter, r *http.Request) {
+	ip, ok := pathIP(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Duration Duration `json:"duration"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	l, err := s.ExtendLease(ip, time.Duration(req.Duration))
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+func (s *Server) apiListReservations(w http.ResponseWriter, r *http.Request) {
+	reservations := s.Reservations()
+	if reservations == nil {
+		reservations = []Reservation{}
+	}
+	writeJSON(w, http.StatusOK, reservations)
+}
+
+func (s *Server) apiAddReservation(w http.ResponseWriter, r *http.Request) {
+	var res Reservation
+	if !readJSON(w, r, &res) {
+		return
+	}
+	if err := s.AddReservation(res); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, res)
+}
+
+func (s *Server) apiRemoveReservation(w http.ResponseWriter, r *http.Request) {
+	ip, ok := pathIP(w, r)
+	if !ok {
+		return
+	}
+	if err := s.RemoveReservation(ip); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) apiPools(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.PoolStats())
+}
+
+func (s *Server) apiStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Stats())
+}
+
+// apiReloadConfig reloads the configuration and answers with the usage of
+// the resized pools.
+func (s *Server) apiReloadConfig(w http.ResponseWriter, r *http.Request) {
+	if err := s.ReloadConfig(); err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.PoolStats())
+}
+
+func pathIP(w http.ResponseWriter, r *http.Request) (net.IP, bool) {
+	ip := net.ParseIP(r.PathValue("ip")).To4()
+	if ip == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid ip %q", r.PathValue("ip")))
+		return nil, false
+	}
+	return ip, true
+}
+
+// readJSON decodes the request body into v, answering with an error when it
+// cannot.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody))
+	if err == nil {
+		err = decodeStrict(data, v)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request: %w", err))
+		return false
+	}
+	return true
+}
+
+func errorStatus(err error) int {
+	var fe *FieldError
+	switch {
+	case errors.Is(err, ErrLeaseNotFound), errors.Is(err, ErrReservationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrLeaseNotBound), errors.Is(err, ErrAddressInUse), errors.Is(err, ErrAddressQuarantined),
+		errors.Is(err, ErrNoConfigSource):
+		return http.StatusConflict
+	case errors.As(err, &fe):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error writing response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// serveControlSocket serves the admin API without a token on the control
+// socket at path. The socket's file permissions are its only protection:
+// it is created readable and writable by the server's user only, so the
+// directory it is in must not let others replace it.
+func (s *Server) serveControlSocket(ctx context.Context, path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("Error removing stale control socket", "path", path, "error", err)
+		return
+	}
+	ln, err := listenControlSocket(path)
+	if err != nil {
+		slog.Error("Error starting listener", "server", "control socket", "addr", path, "error", err)
+		return
+	}
+	serve(ctx, "control socket", ln, s.apiHandler())
+}
+
+// serveHTTP serves h on addr until ctx is done.
+func serveHTTP(ctx context.Context, name, addr string, h http.Handler) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		slog.Error("Error starting listener", "server", name, "addr", addr, "error", err)
+		return
+	}
+	serve(ctx, name, ln, h)
+}
+
+func serve(ctx context.Context, name string, ln net.Listener, h http.Handler) {
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	slog.Info("Serving "+name, "addr", ln.Addr())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Error serving "+name, "error", err)
+	}
+}
@@ -0,0 +1,189 @@
+package server
+
+import (
+	"dhcp/lease"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testToken = "secret"
+
+func newTestAPI(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	cfg := newTestConfig()
+	cfg.Admin = &AdminConfig{Addr: "127.0.0.1:0", Token: testToken}
+	s := newTestServer(t, cfg, lease.NewMemoryStore())
+	ts := httptest.NewServer(s.AdminHandler())
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// call sends a request with the test token and decodes the JSON response
+// into v unless it is nil.
+func call(t *testing.T, ts *httptest.Server, method, path, body string, v any) int {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if v != nil {
+		if err := json.Unmarshal(data, v); err != nil {
+			t.Fatalf("%s %s: invalid response %q: %v", method, path, data, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAdminAuth(t *testing.T) {
+	_, ts := newTestAPI(t)
+	for _, header := range []string{"", "Bearer wrong", testToken} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/api/v1/leases", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected 401 for Authorization %q, got %d", header, resp.StatusCode)
+		}
+	}
+	if status := call(t, ts, http.MethodGet, "/api/v1/leases", "", nil); status != http.StatusOK {
+		t.Errorf("Expected 200 with the token, got %d", status)
+	}
+}
+
+func TestAdminLeases(t *testing.T) {
+	s, ts := newTestAPI(t)
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	ip := bindLease(t, s, mac, "laptop")
+	bindLease(t, s, net.HardwareAddr{0x02, 0, 0, 0, 0, 2}, "phone")
+
+	var leases []map[string]any
+	if status := call(t, ts, http.MethodGet, "/api/v1/leases?hostname=laptop&state=bound", "", &leases); status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", status)
+	}
+	if len(leases) != 1 || leases[0]["ip"] != ip.String() || leases[0]["mac"] != mac.String() || leases[0]["scope"] != defaultScopeName {
+		t.Errorf("Unexpected leases %v", leases)
+	}
+	if status := call(t, ts, http.MethodGet, "/api/v1/leases?mac=nonsense", "", nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid mac, got %d", status)
+	}
+
+	var l map[string]any
+	if status := call(t, ts, http.MethodGet, "/api/v1/leases/"+ip.String(), "", &l); status != http.StatusOK || l["hostname"] != "laptop" {
+		t.Errorf("Unexpected lease %v (%d)", l, status)
+	}
+	if status := call(t, ts, http.MethodPost, "/api/v1/leases/"+ip.String()+"/extend", `{"duration": "2h"}`, &l); status != http.StatusOK {
+		t.Errorf("Expected 200 for extend, got %d", status)
+	}
+	if status := call(t, ts, http.MethodPost, "/api/v1/leases/"+ip.String()+"/extend", `{"duration": "soon"}`, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid duration, got %d", status)
+	}
+	if status := call(t, ts, http.MethodPost, "/api/v1/leases/"+ip.String()+"/release", "", nil); status != http.StatusNoContent {
+		t.Errorf("Expected 204 for release, got %d", status)
+	}
+	if status := call(t, ts, http.MethodGet, "/api/v1/leases/"+ip.String(), "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for a released lease, got %d", status)
+	}
+}
+
+func TestAdminReservations(t *testing.T) {
+	_, ts := newTestAPI(t)
+	body := `{"mac": "02:00:00:00:00:09", "ip": "192.168.1.150", "hostname": "printer", "circuit_id": "Gi1/0/7"}`
+	if status := call(t, ts, http.MethodPost, "/api/v1/reservations", body, nil); status != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", status)
+	}
+	if status := call(t, ts, http.MethodPost, "/api/v1/reservations", body, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a duplicate reservation, got %d", status)
+	}
+	if status := call(t, ts, http.MethodPost, "/api/v1/reservations", `{"ip": "192.168.1.151", "colour": "red"}`, nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown field, got %d", status)
+	}
+
+	var reservations []map[string]any
+	call(t, ts, http.MethodGet, "/api/v1/reservations", "", &reservations)
+	if len(reservations) != 1 || reservations[0]["mac"] != "02:00:00:00:00:09" || reservations[0]["circuit_id"] != "Gi1/0/7" {
+		t.Errorf("Unexpected reservations %v", reservations)
+	}
+
+	var pools []PoolStats
+	call(t, ts, http.MethodGet, "/api/v1/pools", "", &pools)
+	if len(pools) != 1 || pools[0].Size != 101 || pools[0].Used != 1 || pools[0].Free != 100 {
+		t.Errorf("Expected the reserved address to be used, got %+v", pools)
+	}
+
+	if status := call(t, ts, http.MethodDelete, "/api/v1/reservations/192.168.1.150", "", nil); status != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", status)
+	}
+	if status := call(t, ts, http.MethodDelete, "/api/v1/reservations/192.168.1.150", "", nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", status)
+	}
+	call(t, ts, http.MethodGet, "/api/v1/pools", "", &pools)
+	if pools[0].Free != 101 {
+		t.Errorf("Expected the address to be back in the pool, got %+v", pools)
+	}
+}
+
+func TestAdminReserveQuarantined(t *testing.T) {
+	s, ts := newTestAPI(t)
+	ip := net.ParseIP("192.168.1.150")
+	if !s.scopes[0].pool.Take(ip) {
+		t.Fatalf("Expected %s to be free in the pool", ip)
+	}
+	s.mu.Lock()
+	s.quarantineLocked(ip, nil, lease.OpDecline, time.Hour)
+	s.mu.Unlock()
+
+	body := `{"mac": "02:00:00:00:00:09", "ip": "192.168.1.150"}`
+	if status := call(t, ts, http.MethodPost, "/api/v1/reservations", body, nil); status != http.StatusConflict {
+		t.Errorf("Expected 409 for a quarantined address, got %d", status)
+	}
+}
+
+func TestAdminReloadConfig(t *testing.T) {
+	s, ts := newTestAPI(t)
+	if status := call(t, ts, http.MethodPost, "/api/v1/config/reload", "", nil); status != http.StatusConflict {
+		t.Errorf("Expected 409 without a configuration source, got %d", status)
+	}
+
+	invalid := newTestConfig()
+	invalid.Lease = 0
+	source := invalid
+	WithConfigSource(func() (*Config, error) { return source, nil })(s)
+	if status := call(t, ts, http.MethodPost, "/api/v1/config/reload", "", nil); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid configuration, got %d", status)
+	}
+
+	source = newTestConfig()
+	source.End = net.ParseIP("192.168.1.149")
+	var pools []PoolStats
+	if status := call(t, ts, http.MethodPost, "/api/v1/config/reload", "", &pools); status != http.StatusOK || pools[0].Size != 50 {
+		t.Errorf("Expected the resized pool, got %+v (%d)", pools, status)
+	}
+}
+
+func TestValidateAdmin(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Admin = &AdminConfig{Addr: "127.0.0.1:9168"}
+	var fe *FieldError
+	if err := cfg.Validate(); !errors.As(err, &fe) || fe.Field != "admin.token" {
+		t.Errorf("Expected an error for admin.token, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"bytes"
+	"dhcp/pool"
+	"dhcp/protocol"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ClassConfig groups clients by the relay agent information (option 82)
+// their access switch inserts. Members get the class options and, when a
+// range is set, addresses from that part of the scope's pool only. The
+// range is then no longer handed out to other clients.
+type ClassConfig struct {
+	Name      string         `json:"name"`
+	CircuitID []byte         `json:"-"`
+	RemoteID  []byte         `json:"-"`
+	Start     net.IP         `json:"start"`
+	End       net.IP         `json:"end"`
+	Options   []OptionConfig `json:"options"`
+}
+
+func (c *ClassConfig) UnmarshalJSON(data []byte) error {
+	type plain ClassConfig
+	aux := struct {
+		*plain
+		CircuitID *string `json:"circuit_id"`
+		RemoteID  *string `json:"remote_id"`
+	}{plain: (*plain)(c)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return fieldDecodeError(data, err, func(field []byte) error {
+			return new(ClassConfig).UnmarshalJSON(field)
+		})
+	}
+	var err error
+	if c.CircuitID, err = parseAgentID("circuit_id", aux.CircuitID); err != nil {
+		return err
+	}
+	c.RemoteID, err = parseAgentID("remote_id", aux.RemoteID)
+	return err
+}
+
+// parseAgentID decodes a circuit or remote id from configuration. Switches
+// mostly send text such as "Gi1/0/7", binary ids are written in hex with a
+// "0x" prefix.
+func parseAgentID(field string, s *string) ([]byte, error) {
+	if s == nil {
+		return nil, nil
+	}
+	if *s == "" {
+		return nil, fieldError(field, "must not be empty")
+	}
+	if hexID, ok := strings.CutPrefix(*s, "0x"); ok {
+		id, err := hex.DecodeString(hexID)
+		if err != nil || len(id) == 0 {
+			return nil, fieldError(field, "invalid hex string %q", *s)
+		}
+		return id, nil
+	}
+	return []byte(*s), nil
+}
+
+// formatAgentID renders a circuit or remote id for logs, as text when it is
+// printable and in hex otherwise.
+func formatAgentID(id []byte) string {
+	for _, b := range id {
+		if b < 0x20 || b > 0x7e {
+			return "0x" + hex.EncodeToString(id)
+		}
+	}
+	return string(id)
+}
+
+// matchesAgent reports whether the relay agent information carries the
+// given ids. Unset ids match anything, but at least one must be set.
+func matchesAgent(info protocol.RelayAgentInfo, circuitID, remoteID []byte) bool {
+	if circuitID == nil && remoteID == nil {
+		return false
+	}
+	if circuitID != nil && !bytes.Equal(info.CircuitID(), circuitID) {
+		return false
+	}
+	return remoteID == nil || bytes.Equal(info.RemoteID(), remoteID)
+}
+
+func (c *Config) validateClasses() error {
+	names := make(map[string]bool)
+	for i, cl := range c.Classes {
+		field := fmt.Sprintf("classes[%d]", i)
+		if cl.Name == "" {
+			return fieldError(field+".name", "is required")
+		}
+		if names[cl.Name] {
+			return fieldError(field+".name", "class %q is defined more than once", cl.Name)
+		}
+		names[cl.Name] = true
+		if cl.CircuitID == nil && cl.RemoteID == nil {
+			return fieldError(field, "circuit_id or remote_id is required")
+		}
+		if err := validateOptions(field+".options", cl.Options); err != nil {
+			return err
+		}
+		if cl.Start == nil && cl.End == nil {
+			continue
+		}
+		if err := validateIPv4(field+".start", cl.Start); err != nil {
+			return err
+		}
+		if err := validateIPv4(field+".end", cl.End); err != nil {
+			return err
+		}
+		if IPToUint32(cl.Start) > IPToUint32(cl.End) {
+			return fieldError(field+".end", "%s is before start %s", cl.End, cl.Start)
+		}
+		inPool := false
+		for _, sc := range c.scopes() {
+			if _, ok := sc.rangeFor(IPRange{Start: cl.Start, End: cl.End}); ok {
+				inPool = true
+				break
+			}
+		}
+		if !inPool {
+			return fieldError(field+".start", "%s-%s is not inside the pool range of a scope", cl.Start, cl.End)
+		}
+		for j := 0; j < i; j++ {
+			other := c.Classes[j]
+			if other.Start != nil && IPToUint32(cl.Start) <= IPToUint32(other.End) && IPToUint32(other.Start) <= IPToUint32(cl.End) {
+				return fieldError(field+".start", "%s-%s overlaps class %q", cl.Start, cl.End, other.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// class is the runtime state of a ClassConfig.
+type class struct {
+	ClassConfig
+	extra  []protocol.Option
+	always []byte
+	// pool holds the class range, it is nil for classes without one.
+	pool *pool.IPPool
+}
+
+// classRanges returns the class ranges inside the pool of sc. They are
+// excluded from the scope pool.
+func classRanges(sc ScopeConfig, list []ClassConfig) []IPRange {
+	var ranges []IPRange
+	for _, cc := range list {
+		if cc.Start == nil {
+			continue
+		}
+		if _, ok := sc.rangeFor(IPRange{Start: cc.Start, End: cc.End}); ok {
+			ranges = append(ranges, IPRange{Start: cc.Start, End: cc.End})
+		}
+	}
+	return ranges
+}
+
+// newClasses builds the configured classes and attaches those with a range
+// to their scope. The ranges have to be excluded from the scope pools
+// already.
+func newClasses(scopes []*scope, list []ClassConfig) ([]*class, error) {
+	var classes []*class
+	for _, cc := range list {
+		cl := &class{ClassConfig: cc}
+		cl.extra, cl.always = replyExtras(cc.Options)
+		if cc.Start != nil {
+			sc := scopeContaining(scopes, cc.Start)
+			var exclude []pool.Range
+			for _, r := range sc.Exclude {
+				exclude = append(exclude, pool.Range{Start: r.Start, End: r.End})
+			}
+			ipPool, err := pool.New([]pool.Range{{Start: cc.Start, End: cc.End}}, exclude...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create IP pool for class %q: %w", cc.Name, err)
+			}
+			cl.pool = ipPool
+			sc.classes = append(sc.classes, cl)
+		}
+		classes = append(classes, cl)
+	}
+	return classes, nil
+}
+
+// classFor returns the first class the client's relay agent information
+// matches, or nil.
+func (s *Server) classFor(packet *protocol.Packet) *class {
+	info, err := packet.GetRelayAgentInfoOption()
+	if err != nil {
+		return nil
+	}
+	for _, cl := range s.classes {
+		if matchesAgent(info, cl.CircuitID, cl.RemoteID) {
+			return cl
+		}
+	}
+	return nil
+}
+
+func uint32ToIP(n uint32) net.IP {
+	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n)).To4()
+}
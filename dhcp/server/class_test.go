@@ -0,0 +1,135 @@
+package server
+
+import (
+	"bytes"
+	"dhcp/lease"
+	"dhcp/protocol"
+	"errors"
+	"net"
+	"testing"
+)
+
+func relayedDiscover(mac net.HardwareAddr, circuitID, remoteID []byte) *protocol.Packet {
+	p := newDiscover(mac)
+	p.GIAddr = net.ParseIP("192.168.1.1")
+	var info protocol.RelayAgentInfo
+	if circuitID != nil {
+		info = append(info, protocol.Option{Code: protocol.AgentCircuitID, Data: circuitID})
+	}
+	if remoteID != nil {
+		info = append(info, protocol.Option{Code: protocol.AgentRemoteID, Data: remoteID})
+	}
+	p.AddOption(protocol.OptionDHCPAgentOptions, info.Encode())
+	return p
+}
+
+func TestRelayAgentPolicy(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Classes = []ClassConfig{{
+		Name:      "cameras",
+		CircuitID: []byte("Gi1/0/7"),
+		Start:     net.ParseIP("192.168.1.150"),
+		End:       net.ParseIP("192.168.1.160"),
+		Options:   []OptionConfig{{Code: protocol.OptionNetworkTimeProtocol, Data: []byte{192, 168, 1, 5}}},
+	}}
+	cfg.Reservations = []Reservation{{
+		CircuitID: []byte("Gi1/0/9"),
+		RemoteID:  []byte{0, 1, 2, 3, 4, 5},
+		IP:        net.ParseIP("192.168.1.50"),
+	}}
+	store := lease.NewMemoryStore()
+	s := newTestServer(t, cfg, store)
+	conn := s.conn.(*mockConn)
+	switchMAC := []byte{0, 1, 2, 3, 4, 5}
+
+	camera := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	s.handleDiscover(relayedDiscover(camera, []byte("Gi1/0/7"), switchMAC), nil)
+	offer := conn.sentPacket()
+	if offer == nil || !ipInRange(offer.YIAddr, cfg.Classes[0].Start, cfg.Classes[0].End) {
+		t.Fatalf("Expected an offer from the class range, got %v", offer)
+	}
+	if ntp, _ := offer.GetIPsOption(protocol.OptionNetworkTimeProtocol); len(ntp) != 1 || !ntp[0].Equal(net.ParseIP("192.168.1.5")) {
+		t.Errorf("Expected the class NTP server, got %v", ntp)
+	}
+	if info, err := offer.GetRelayAgentInfoOption(); err != nil || string(info.CircuitID()) != "Gi1/0/7" {
+		t.Errorf("Expected option 82 to be echoed, got %v (%v)", info, err)
+	}
+	b := s.bindings[macKey(camera)]
+	if string(b.CircuitID) != "Gi1/0/7" || !bytes.Equal(b.RemoteID, switchMAC) {
+		t.Errorf("Expected the binding to record the switch port, got %q and %x", b.CircuitID, b.RemoteID)
+	}
+	if recs := store.Records(); len(recs) != 1 || string(recs[0].CircuitID) != "Gi1/0/7" {
+		t.Errorf("Expected the circuit id to be persisted, got %+v", recs)
+	}
+
+	s.handleDiscover(relayedDiscover(net.HardwareAddr{0x02, 0, 0, 0, 0, 2}, []byte("Gi1/0/8"), switchMAC), nil)
+	offer = conn.sentPacket()
+	if offer == nil || ipInRange(offer.YIAddr, cfg.Classes[0].Start, cfg.Classes[0].End) {
+		t.Errorf("Expected an offer outside the class range, got %v", offer)
+	} else if offer.GetOption(protocol.OptionNetworkTimeProtocol) != nil {
+		t.Errorf("Expected no class options for other ports")
+	}
+
+	s.handleDiscover(relayedDiscover(net.HardwareAddr{0x02, 0, 0, 0, 0, 3}, []byte("Gi1/0/9"), switchMAC), nil)
+	if offer = conn.sentPacket(); offer == nil || !offer.YIAddr.Equal(net.ParseIP("192.168.1.50")) {
+		t.Errorf("Expected the address reserved for the port, got %v", offer)
+	}
+	s.handleDiscover(relayedDiscover(net.HardwareAddr{0x02, 0, 0, 0, 0, 4}, []byte("Gi1/0/9"), []byte{9, 9, 9, 9, 9, 9}), nil)
+	if offer = conn.sentPacket(); offer == nil || offer.YIAddr.Equal(net.ParseIP("192.168.1.50")) {
+		t.Errorf("Expected the reservation to require the remote id, got %v", offer)
+	}
+}
+
+func TestParseClasses(t *testing.T) {
+	cfg, err := ParseConfig([]byte(testYAMLConfig+`
+classes:
+  - name: cameras
+    circuit_id: Gi1/0/7
+    remote_id: "0x000102030405"
+    start: 192.168.1.150
+    end: 192.168.1.160
+reservations:
+  - circuit_id: Gi1/0/9
+    ip: 192.168.1.50
+`), "yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if cl := cfg.Classes[0]; string(cl.CircuitID) != "Gi1/0/7" || !bytes.Equal(cl.RemoteID, []byte{0, 1, 2, 3, 4, 5}) {
+		t.Errorf("Unexpected class ids %q and %x", cl.CircuitID, cl.RemoteID)
+	}
+	if string(cfg.Reservations[0].CircuitID) != "Gi1/0/9" {
+		t.Errorf("Unexpected reservation circuit id %q", cfg.Reservations[0].CircuitID)
+	}
+
+	testCases := []struct {
+		name   string
+		modify func(*Config)
+		field  string
+	}{
+		{"no ids", func(c *Config) { c.Classes[0].CircuitID, c.Classes[0].RemoteID = nil, nil }, "classes[0]"},
+		{"range outside pool", func(c *Config) { c.Classes[0].Start = net.ParseIP("192.168.1.20") }, "classes[0].start"},
+		{"overlapping ranges", func(c *Config) {
+			c.Classes = append(c.Classes, ClassConfig{Name: "phones", CircuitID: []byte("x"),
+				Start: net.ParseIP("192.168.1.160"), End: net.ParseIP("192.168.1.170")})
+		}, "classes[1].start"},
+		{"duplicate port reservation", func(c *Config) {
+			c.Reservations = append(c.Reservations, Reservation{CircuitID: []byte("Gi1/0/9"), IP: net.ParseIP("192.168.1.51")})
+		}, "reservations[1].circuit_id"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := *cfg
+			c.Classes = append([]ClassConfig(nil), cfg.Classes...)
+			c.Reservations = append([]Reservation(nil), cfg.Reservations...)
+			tc.modify(&c)
+			var fe *FieldError
+			if err := c.Validate(); !errors.As(err, &fe) || fe.Field != tc.field {
+				t.Errorf("Expected error for %q, got %v", tc.field, err)
+			}
+		})
+	}
+}
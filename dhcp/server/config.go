@@ -0,0 +1,306 @@
+package server
+
+import (
+	"bytes"
+	"dhcp/internal/yamlsubset"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Start net.IP `json:"start"`
+	End   net.IP `json:"end"`
+	// Ranges are further dynamic ranges besides start and end, Exclude
+	// takes addresses out of all of them.
+	Ranges        []IPRange      `json:"ranges"`
+	Exclude       []IPRange      `json:"exclude"`
+	Subnet        net.IPNet      `json:"-"`
+	Lease         time.Duration  `json:"-"`
+	RenewalTime   time.Duration  `json:"-"`
+	RebindingTime time.Duration  `json:"-"`
+	DNS           []net.IP       `json:"dns"`
+	Router        net.IP         `json:"router"`
+	ServerIP      net.IP         `json:"server_ip"`
+	DomainName    string         `json:"domain_name"`
+	LeaseFile     string         `json:"lease_file"`
+	Reservations  []Reservation  `json:"reservations"`
+	Options       []OptionConfig `json:"options"`
+	Scopes        []ScopeConfig  `json:"scopes"`
+	Classes       []ClassConfig  `json:"classes"`
+
+	// Interfaces lists the interfaces to serve on. Without it the server
+	// serves the first interface with an IPv4 address.
+	Interfaces []InterfaceConfig `json:"interfaces"`
+
+	// IgnoreClientID identifies clients by hardware address only.
+	IgnoreClientID bool `json:"ignore_client_id"`
+
+	ConflictDetection *ConflictDetection `json:"conflict_detection"`
+	// GracePeriod keeps an expired lease from being reclaimed, so its client
+	// can still renew it.
+	GracePeriod time.Duration `json:"-"`
+	// OfferTTL is how long an offered address is held for a REQUEST.
+	OfferTTL time.Duration `json:"-"`
+	// QuarantineTime is how long a declined address is kept out of the pool.
+	QuarantineTime time.Duration `json:"-"`
+
+	// MetricsAddr is the address /metrics is served on, e.g. ":9167". It
+	// is not served when empty.
+	MetricsAddr string `json:"metrics_addr"`
+	// Admin enables the admin API.
+	Admin *AdminConfig `json:"admin"`
+	// ControlSocket is the path of the Unix socket dhcpctl connects to. It
+	// is not created when empty. Anyone who can connect to it has full
+	// admin access; only its file permissions restrict that to the
+	// server's user.
+	ControlSocket string `json:"control_socket"`
+}
+
+// FieldError reports an invalid value for a single configuration field.
+// Field uses the key names of the configuration file.
+type FieldError struct {
+	Field string
+	Msg   string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Msg
+}
+
+func fieldError(field, format string, args ...any) error {
+	return &FieldError{Field: field, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Validate derives unset defaults and checks the configuration. It runs on
+// the final configuration, after command line flags were applied, so
+// defaults follow the overridden values.
+func (c *Config) Validate() error {
+	c.applyDefaults()
+	if err := c.validateScopes(); err != nil {
+		return err
+	}
+	if err := validateIPv4("server_ip", c.ServerIP); err != nil {
+		return err
+	}
+	if !c.Subnet.Contains(c.ServerIP) {
+		return fieldError("server_ip", "%s is outside subnet %s", c.ServerIP, &c.Subnet)
+	}
+	if err := c.validateClasses(); err != nil {
+		return err
+	}
+	if err := c.validateInterfaces(); err != nil {
+		return err
+	}
+	if c.ConflictDetection != nil {
+		if err := c.ConflictDetection.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Admin != nil {
+		if err := c.Admin.validate(); err != nil {
+			return err
+		}
+	}
+	if c.GracePeriod < 0 {
+		return fieldError("grace_period", "must not be negative")
+	}
+	if c.OfferTTL < 0 {
+		return fieldError("offer_ttl", "must not be negative")
+	}
+	if c.QuarantineTime < 0 {
+		return fieldError("quarantine_time", "must not be negative")
+	}
+	return c.validateReservations()
+}
+
+func validateIPv4(field string, ip net.IP) error {
+	if ip == nil {
+		return fieldError(field, "is required")
+	}
+	if ip.To4() == nil {
+		return fieldError(field, "%s is not an IPv4 address", ip)
+	}
+	return nil
+}
+
+func ipInRange(ip, start, end net.IP) bool {
+	n := IPToUint32(ip)
+	return n >= IPToUint32(start) && n <= IPToUint32(end)
+}
+
+func (c *Config) offerTTL() time.Duration {
+	if c.OfferTTL == 0 {
+		return defaultOfferTTL
+	}
+	return c.OfferTTL
+}
+
+// applyDefaults derives unset T1 and T2 from the lease length using the
+// defaults from RFC 2131 section 4.4.5.
+func (c *Config) applyDefaults() {
+	if c.RenewalTime == 0 && c.Lease > 0 {
+		c.RenewalTime = c.Lease / 2
+	}
+	if c.RebindingTime == 0 && c.Lease > 0 {
+		c.RebindingTime = c.Lease * 7 / 8
+	}
+	if c.ConflictDetection != nil {
+		c.ConflictDetection.applyDefaults()
+	}
+}
+
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type plain Config
+	aux := struct {
+		*plain
+		Subnet         string   `json:"subnet"`
+		Lease          Duration `json:"lease"`
+		RenewalTime    Duration `json:"renewal_time"`
+		RebindingTime  Duration `json:"rebinding_time"`
+		QuarantineTime Duration `json:"quarantine_time"`
+		OfferTTL       Duration `json:"offer_ttl"`
+		GracePeriod    Duration `json:"grace_period"`
+	}{plain: (*plain)(c)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return fieldDecodeError(data, err, func(field []byte) error {
+			return new(Config).UnmarshalJSON(field)
+		})
+	}
+	if aux.Subnet != "" {
+		_, subnet, err := net.ParseCIDR(aux.Subnet)
+		if err != nil {
+			return fieldError("subnet", "%v", err)
+		}
+		c.Subnet = *subnet
+	}
+	c.Lease = time.Duration(aux.Lease)
+	c.RenewalTime = time.Duration(aux.RenewalTime)
+	c.RebindingTime = time.Duration(aux.RebindingTime)
+	c.QuarantineTime = time.Duration(aux.QuarantineTime)
+	c.OfferTTL = time.Duration(aux.OfferTTL)
+	c.GracePeriod = time.Duration(aux.GracePeriod)
+	return nil
+}
+
+// Duration accepts either a Go duration string ("10m") or a number of
+// seconds in configuration files.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case float64:
+		*d = Duration(time.Duration(v * float64(time.Second)))
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	case nil:
+		*d = 0
+	default:
+		return fmt.Errorf("invalid duration %s", data)
+	}
+	return nil
+}
+
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// fieldDecodeError attributes a decode error of the JSON object in data to
+// the first field that fails to decode on its own.
+func fieldDecodeError(data []byte, err error, decode func([]byte) error) error {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		return err
+	}
+	if len(fields) == 1 {
+		for name := range fields {
+			var fe *FieldError
+			if errors.As(err, &fe) {
+				return fieldError(name+"."+fe.Field, "%s", fe.Msg)
+			}
+			return fieldError(name, "%v", err)
+		}
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		single, _ := json.Marshal(map[string]json.RawMessage{name: fields[name]})
+		if fieldErr := decode(single); fieldErr != nil {
+			return fieldErr
+		}
+	}
+	return err
+}
+
+// LoadConfig reads a YAML or JSON configuration file. The format is chosen
+// by the file extension; files without a known extension are parsed as JSON
+// when they start with '{' and as YAML otherwise.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	cfg, err := ParseConfig(data, configFormat(path, data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func configFormat(path string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return "json"
+	}
+	return "yaml"
+}
+
+// ParseConfig decodes a configuration in the given format ("json" or
+// "yaml"). The result still has to be validated, which also derives
+// unset defaults.
+func ParseConfig(data []byte, format string) (*Config, error) {
+	switch format {
+	case "json":
+	case "yaml":
+		doc, err := yamlsubset.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format %q", format)
+	}
+
+	cfg := &Config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const testYAMLConfig = `
+# comment
+subnet: 192.168.1.0/24
+start: 192.168.1.100
+end: "192.168.1.200"
+router: 192.168.1.1 # trailing comment
+server_ip: 192.168.1.2
+dns:
+  - 8.8.8.8
+  - 8.8.4.4
+domain_name: 'example.com'
+lease: 1h
+renewal_time: 1800
+rebinding_time: 45m
+`
+
+const testJSONConfig = `{
+	"subnet": "192.168.1.0/24",
+	"start": "192.168.1.100",
+	"end": "192.168.1.200",
+	"router": "192.168.1.1",
+	"server_ip": "192.168.1.2",
+	"dns": ["8.8.8.8", "8.8.4.4"],
+	"domain_name": "example.com",
+	"lease": "1h",
+	"renewal_time": 1800,
+	"rebinding_time": "45m"
+}`
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	want := newTestConfig()
+	want.DNS = []net.IP{net.ParseIP("8.8.8.8"), net.ParseIP("8.8.4.4")}
+
+	for name, content := range map[string]string{
+		"config.yaml": testYAMLConfig,
+		"config.json": testJSONConfig,
+		"config":      testJSONConfig,
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := LoadConfig(path)
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if cfg.Subnet.String() != want.Subnet.String() {
+				t.Errorf("Subnet = %s, want %s", &cfg.Subnet, &want.Subnet)
+			}
+			for _, f := range []struct{ got, want net.IP }{
+				{cfg.Start, want.Start}, {cfg.End, want.End}, {cfg.Router, want.Router}, {cfg.ServerIP, want.ServerIP},
+			} {
+				if !f.got.Equal(f.want) {
+					t.Errorf("Got %s, want %s", f.got, f.want)
+				}
+			}
+			if len(cfg.DNS) != 2 || !cfg.DNS[1].Equal(want.DNS[1]) {
+				t.Errorf("DNS = %v, want %v", cfg.DNS, want.DNS)
+			}
+			if cfg.Lease != want.Lease || cfg.RenewalTime != want.RenewalTime || cfg.RebindingTime != want.RebindingTime {
+				t.Errorf("Timers = %s/%s/%s", cfg.RenewalTime, cfg.RebindingTime, cfg.Lease)
+			}
+			if cfg.DomainName != want.DomainName {
+				t.Errorf("DomainName = %q, want %q", cfg.DomainName, want.DomainName)
+			}
+		})
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		format string
+		data   string
+	}{
+		{"unknown field", "yaml", "subnet: 10.0.0.0/8\nstrat: 10.0.0.1\n"},
+		{"bad subnet", "json", `{"subnet": "10.0.0.0"}`},
+		{"bad duration", "yaml", "lease: forever\n"},
+		{"bad indentation", "yaml", "subnet: 10.0.0.0/8\n  start: 10.0.0.1\n"},
+		{"duplicate key", "yaml", "start: 10.0.0.1\nstart: 10.0.0.2\n"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := ParseConfig([]byte(tc.data), tc.format); err == nil {
+				t.Errorf("Expected an error")
+			}
+		})
+	}
+}
+
+func TestParseConfigNamesField(t *testing.T) {
+	_, err := ParseConfig([]byte("subnet: 10.0.0.0/8\nrouter: 10.0.0.300\n"), "yaml")
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Field != "router" {
+		t.Errorf("Expected error for field router, got %v", err)
+	}
+}
+
+func TestParseConfigDefaultTimers(t *testing.T) {
+	cfg, err := ParseConfig([]byte("subnet: 192.168.1.0/24\nstart: 192.168.1.100\nend: 192.168.1.200\nserver_ip: 192.168.1.2\nlease: 8h\n"), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A flag overriding the lease after parsing still changes T1 and T2.
+	cfg.Lease = 2 * time.Hour
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if cfg.RenewalTime != time.Hour || cfg.RebindingTime != 105*time.Minute {
+		t.Errorf("Expected default T1/T2 of 1h/1h45m, got %s/%s", cfg.RenewalTime, cfg.RebindingTime)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(*Config)
+		field  string
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"missing subnet", func(c *Config) { c.Subnet = net.IPNet{} }, "subnet"},
+		{"start outside subnet", func(c *Config) { c.Start = net.ParseIP("192.168.2.100") }, "start"},
+		{"end outside subnet", func(c *Config) { c.End = net.ParseIP("192.168.2.200") }, "end"},
+		{"end before start", func(c *Config) { c.End = net.ParseIP("192.168.1.50") }, "end"},
+		{"router outside subnet", func(c *Config) { c.Router = net.ParseIP("10.0.0.1") }, "router"},
+		{"server inside pool", func(c *Config) { c.ServerIP = net.ParseIP("192.168.1.150") }, "server_ip"},
+		{"server outside subnet", func(c *Config) { c.ServerIP = net.ParseIP("10.0.0.2") }, "server_ip"},
+		{"missing server", func(c *Config) { c.ServerIP = nil }, "server_ip"},
+		{"ipv6 dns", func(c *Config) { c.DNS = []net.IP{net.ParseIP("::1")} }, "dns[0]"},
+		{"zero lease", func(c *Config) { c.Lease = 0 }, "lease"},
+		{"T1 after T2", func(c *Config) { c.RenewalTime = 50 * time.Minute }, "renewal_time"},
+		{"T2 after lease", func(c *Config) { c.RebindingTime = 2 * time.Hour }, "rebinding_time"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newTestConfig()
+			tc.modify(cfg)
+			err := cfg.Validate()
+			if tc.field == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			var fe *FieldError
+			if !errors.As(err, &fe) {
+				t.Fatalf("Expected a FieldError, got %v", err)
+			}
+			if fe.Field != tc.field {
+				t.Errorf("Expected error for %q, got %v", tc.field, err)
+			}
+		})
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	cfg, err := ParseConfig([]byte(testYAMLConfig+`
+options:
+  - code: 42
+    ips: [10.0.0.1, 10.0.0.2]
+  - code: 66
+    text: tftp.example.com
+    always: true
+  - code: 150
+    hex: c0:a8:01:05
+  - code: 26
+    uint16: 1400
+  - code: 119
+    domains: [eng.example.com, example.com]
+  - code: 121
+    routes:
+      - destination: 10.0.0.0/8
+        router: 192.168.1.1
+`), "yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	want := []OptionConfig{
+		{Code: 42, Data: []byte{10, 0, 0, 1, 10, 0, 0, 2}},
+		{Code: 66, Always: true, Data: []byte("tftp.example.com")},
+		{Code: 150, Data: []byte{0xc0, 0xa8, 0x01, 0x05}},
+		{Code: 26, Data: []byte{0x05, 0x78}},
+		{Code: 119, Data: []byte{3, 'e', 'n', 'g', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0xc0, 4}},
+		{Code: 121, Data: []byte{8, 10, 192, 168, 1, 1}},
+	}
+	if !reflect.DeepEqual(cfg.Options, want) {
+		t.Errorf("Options = %+v, want %+v", cfg.Options, want)
+	}
+
+	for _, bad := range []string{
+		"options:\n  - code: 42\n",
+		"options:\n  - code: 42\n    text: a\n    hex: 01\n",
+		"options:\n  - code: 3\n    hex: 0a00\n",
+		"options:\n  - code: 119\n    domains: [bad..name]\n",
+	} {
+		if _, err := ParseConfig([]byte(bad), "yaml"); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+	cfg.Options = append(cfg.Options, OptionConfig{Code: 54, Data: []byte{1, 2, 3, 4}})
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("Expected server managed option 54 to be rejected")
+	}
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"dhcp/transport"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultProbeTimeout = 500 * time.Millisecond
+	defaultAbandonTime  = time.Hour
+	// maxConflictProbes bounds the addresses probed for a single DISCOVER so
+	// a subnet full of static hosts does not stall the client.
+	maxConflictProbes = 5
+)
+
+// ConflictDetection enables probing addresses before they are offered, to
+// catch hosts that use an address of the pool without a lease. Method is
+// "icmp" or "arp". ARP probes on the interface attached to the address and
+// falls back to ICMP for relayed subnets.
+type ConflictDetection struct {
+	Method      string        `json:"method"`
+	Timeout     time.Duration `json:"-"`
+	AbandonTime time.Duration `json:"-"`
+}
+
+func (c *ConflictDetection) UnmarshalJSON(data []byte) error {
+	type plain ConflictDetection
+	aux := struct {
+		*plain
+		Timeout     Duration `json:"timeout"`
+		AbandonTime Duration `json:"abandon_time"`
+	}{plain: (*plain)(c)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return fieldDecodeError(data, err, func(field []byte) error {
+			return new(ConflictDetection).UnmarshalJSON(field)
+		})
+	}
+	c.Timeout = time.Duration(aux.Timeout)
+	c.AbandonTime = time.Duration(aux.AbandonTime)
+	return nil
+}
+
+func (c *ConflictDetection) applyDefaults() {
+	if c.Method == "" {
+		c.Method = "icmp"
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultProbeTimeout
+	}
+	if c.AbandonTime == 0 {
+		c.AbandonTime = defaultAbandonTime
+	}
+}
+
+func (c *ConflictDetection) validate() error {
+	if c.Method != "icmp" && c.Method != "arp" {
+		return fieldError("conflict_detection.method", "must be icmp or arp, got %q", c.Method)
+	}
+	if c.Timeout <= 0 {
+		return fieldError("conflict_detection.timeout", "must be positive")
+	}
+	if c.AbandonTime <= 0 {
+		return fieldError("conflict_detection.abandon_time", "must be positive")
+	}
+	return nil
+}
+
+// newProber builds the probe of method. ARP probes go out on the configured
+// interfaces, or the default one without them.
+func newProber(method string, interfaces []InterfaceConfig) (transport.Prober, error) {
+	if method == "arp" {
+		names := make([]string, len(interfaces))
+		for i, ic := range interfaces {
+			names[i] = ic.Name
+		}
+		return transport.NewARPProber(transport.NewICMPProber(), names...)
+	}
+	return transport.NewICMPProber(), nil
+}
+
+// ProbeStats counts the outcomes of conflict probes.
+type ProbeStats struct {
+	Free   uint64 `json:"free"`
+	InUse  uint64 `json:"in_use"`
+	Failed uint64 `json:"failed"`
+}
+
+type probeCounters struct {
+	free, inUse, failed atomic.Uint64
+}
+
+// ProbeStats returns the conflict probe counters.
+func (s *Server) ProbeStats() ProbeStats {
+	return ProbeStats{
+		Free:   s.probes.free.Load(),
+		InUse:  s.probes.inUse.Load(),
+		Failed: s.probes.failed.Load(),
+	}
+}
+
+// probe reports whether ip is used by another host. A failed probe is
+// logged and treated as free, so a broken probe socket does not stop the
+// server from handing out addresses.
+func (s *Server) probe(ip net.IP) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ConflictDetection.Timeout)
+	defer cancel()
+	start := time.Now()
+	inUse, err := s.prober.Probe(ctx, ip)
+	switch {
+	case err != nil:
+		s.probes.failed.Add(1)
+		slog.Error("Error probing address", "ip", ip, "error", err)
+		return false
+	case inUse:
+		s.probes.inUse.Add(1)
+		slog.Warn("Address is in use by another host", "ip", ip, "took", time.Since(start))
+	default:
+		s.probes.free.Add(1)
+		slog.Debug("Address is free", "ip", ip, "took", time.Since(start))
+	}
+	return inUse
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"dhcp/lease"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+type fakeProber struct {
+	inUse  map[string]bool
+	fail   bool
+	probed []string
+}
+
+func (p *fakeProber) Probe(ctx context.Context, ip net.IP) (bool, error) {
+	p.probed = append(p.probed, ip.String())
+	if p.fail {
+		return false, errors.New("no socket")
+	}
+	return p.inUse[ip.String()], nil
+}
+
+func TestConflictDetection(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.ConflictDetection = &ConflictDetection{Method: "icmp", Timeout: time.Second, AbandonTime: time.Hour}
+	prober := &fakeProber{inUse: map[string]bool{"192.168.1.100": true, "192.168.1.101": true}}
+	s, err := NewServer(cfg, WithTransport(&mockConn{}), WithLeaseStore(lease.NewMemoryStore()), WithProber(prober))
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	conn := s.conn.(*mockConn)
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+
+	s.handleDiscover(newDiscover(mac), nil)
+	offer := conn.sentPacket()
+	if offer == nil || !offer.YIAddr.Equal(net.ParseIP("192.168.1.102")) {
+		t.Fatalf("Expected the first free address 192.168.1.102, got %v", offer)
+	}
+	if want := (ProbeStats{Free: 1, InUse: 2}); s.ProbeStats() != want {
+		t.Errorf("Expected probe stats %+v, got %+v", want, s.ProbeStats())
+	}
+	if len(s.quarantined) != 2 {
+		t.Errorf("Expected 2 quarantined addresses, got %d", len(s.quarantined))
+	}
+
+	// A client with an offer is not probed again.
+	s.handleDiscover(newDiscover(mac), nil)
+	if len(prober.probed) != 3 {
+		t.Errorf("Expected no probe for an existing binding, got %v", prober.probed)
+	}
+
+	s.expireDue(time.Now().Add(2 * time.Hour))
+	if len(s.quarantined) != 0 {
+		t.Errorf("Expected quarantined addresses to be released, got %d", len(s.quarantined))
+	}
+	if !s.scopes[0].pool.Take(net.ParseIP("192.168.1.100")) {
+		t.Errorf("Expected 192.168.1.100 to be back in the pool")
+	}
+
+	// A failing probe does not stop the server from offering addresses.
+	prober.fail = true
+	conn.p = nil
+	s.handleDiscover(newDiscover(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x66}), nil)
+	if conn.sentPacket() == nil {
+		t.Errorf("Expected an offer when the probe fails")
+	}
+	if s.ProbeStats().Failed != 1 {
+		t.Errorf("Expected 1 failed probe, got %+v", s.ProbeStats())
+	}
+}
+
+func TestConflictDetectionGivesUp(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.ConflictDetection = &ConflictDetection{Method: "arp", Timeout: time.Second, AbandonTime: time.Hour}
+	prober := &fakeProber{inUse: make(map[string]bool)}
+	for i := 100; i < 110; i++ {
+		prober.inUse[net.IPv4(192, 168, 1, byte(i)).String()] = true
+	}
+	s, err := NewServer(cfg, WithTransport(&mockConn{}), WithLeaseStore(lease.NewMemoryStore()), WithProber(prober))
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+
+	if offer := offered(s.createOffer(newDiscover(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}), nil)); offer != nil {
+		t.Errorf("Expected no offer, got %s", offer.YIAddr)
+	}
+	if len(prober.probed) != maxConflictProbes {
+		t.Errorf("Expected %d probes, got %d", maxConflictProbes, len(prober.probed))
+	}
+}
+
+func TestParseConflictDetection(t *testing.T) {
+	cfg, err := ParseConfig([]byte(testYAMLConfig+`
+conflict_detection:
+  method: arp
+  timeout: 200ms
+`), "yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	want := ConflictDetection{Method: "arp", Timeout: 200 * time.Millisecond, AbandonTime: defaultAbandonTime}
+	if *cfg.ConflictDetection != want {
+		t.Errorf("Expected %+v, got %+v", want, *cfg.ConflictDetection)
+	}
+
+	cfg.ConflictDetection.Method = "dns"
+	var fe *FieldError
+	if err := cfg.Validate(); !errors.As(err, &fe) || fe.Field != "conflict_detection.method" {
+		t.Errorf("Expected a conflict_detection.method error, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+//go:build unix
+
+package server
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+)
+
+// listenControlSocket listens on the Unix socket at path. The socket is
+// bound in a private directory next to path, restricted to mode 0600 and
+// only then renamed to path, so there is no window in which other users
+// could connect to it.
+func listenControlSocket(path string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".control")
+	if err != nil {
+		return nil, err
+	}
+	// MkdirTemp creates dir with mode 0700.
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "sock")
+	ln, err := net.Listen("unix", tmp)
+	if err != nil {
+		return nil, err
+	}
+	// The listener would remove tmp rather than path when closed.
+	ln.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0o600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return &controlListener{Listener: ln, path: path}, nil
+}
+
+// controlListener removes the control socket when it is closed.
+type controlListener struct {
+	net.Listener
+	path string
+}
+
+func (l *controlListener) Close() error {
+	err := l.Listener.Close()
+	os.Remove(l.path)
+	return err
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"container/heap"
+	"context"
+	"dhcp/lease"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// maxExpiryWait bounds how long the expiry loop sleeps with nothing due.
+const maxExpiryWait = time.Minute
+
+// expiryItem is the time the binding or quarantine of ip ends.
+type expiryItem struct {
+	at time.Time
+	ip uint32
+}
+
+// expiryQueue is a min-heap of expiry times. Items are not removed when a
+// lease is extended or released; stale items are skipped when they come due.
+type expiryQueue []expiryItem
+
+func (q expiryQueue) Len() int           { return len(q) }
+func (q expiryQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+func (q expiryQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *expiryQueue) Push(x any)        { *q = append(*q, x.(expiryItem)) }
+func (q *expiryQueue) Pop() any {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// scheduleExpiry makes the expiry loop look at ip at the given time.
+func (s *Server) scheduleExpiry(ip net.IP, at time.Time) {
+	heap.Push(&s.expiry, expiryItem{at: at, ip: IPToUint32(ip)})
+	select {
+	case s.expiryWake <- struct{}{}:
+	default:
+	}
+}
+
+// expiresAt is when b is reclaimed. Leases are kept for the grace period
+// after they end, so a late client can still renew.
+func (s *Server) expiresAt(b *binding) time.Time {
+	if b.State == LeaseBound {
+		return b.Expiration.Add(s.config.GracePeriod)
+	}
+	return b.Expiration
+}
+
+// bind stores the binding of the client identified by key and schedules its
+// expiry. It has to be called again whenever b.Expiration changes.
+func (s *Server) bind(key clientKey, b *binding) {
+	n := IPToUint32(b.IP)
+	if owner, ok := s.lastOwner[n]; ok && owner != key {
+		// The address goes to another client, the old owner's history entry
+		// no longer helps it.
+		if prev, ok := s.history[owner]; ok && prev.Equal(b.IP) {
+			delete(s.history, owner)
+		}
+		delete(s.lastOwner, n)
+	}
+	if old, ok := s.bindings[key]; ok && !old.IP.Equal(b.IP) && s.byIP[IPToUint32(old.IP)] == key {
+		delete(s.byIP, IPToUint32(old.IP))
+	}
+	s.bindings[key] = b
+	s.byIP[n] = key
+	s.scheduleExpiry(b.IP, s.expiresAt(b))
+}
+
+// unbind removes the binding of key.
+func (s *Server) unbind(key clientKey) {
+	b, ok := s.bindings[key]
+	if !ok {
+		return
+	}
+	delete(s.bindings, key)
+	if n := IPToUint32(b.IP); s.byIP[n] == key {
+		delete(s.byIP, n)
+	}
+}
+
+// remember keeps ip as the address the client identified by key had last,
+// until it is bound to another client.
+func (s *Server) remember(key clientKey, ip net.IP) {
+	s.history[key] = ip
+	s.lastOwner[IPToUint32(ip)] = key
+}
+
+// bindingForIP returns the key and binding holding ip.
+func (s *Server) bindingForIP(ip net.IP) (clientKey, *binding) {
+	key, ok := s.byIP[IPToUint32(ip)]
+	if !ok {
+		return "", nil
+	}
+	return key, s.bindings[key]
+}
+
+// expireDue reclaims the bindings and quarantined addresses that ended by now
+// and returns when the next one is due, or the zero time.
+func (s *Server) expireDue(now time.Time) time.Time {
+	for s.expiry.Len() > 0 {
+		item := s.expiry[0]
+		if item.at.After(now) {
+			return item.at
+		}
+		heap.Pop(&s.expiry)
+		ip := uint32ToIP(item.ip)
+		if q, ok := s.quarantined[item.ip]; ok && !q.Until.After(now) {
+			s.releaseQuarantined(q, now)
+		}
+		if _, b := s.bindingForIP(ip); b != nil && !s.expiresAt(b).After(now) {
+			slog.Info("Lease expired", "ip", ip, "addr", b.MAC.String(), "state", b.State)
+			s.releaseIPLocked(ip, lease.OpExpire)
+		}
+	}
+	return time.Time{}
+}
+
+// runExpiry reclaims bindings as they come due.
+func (s *Server) runExpiry(ctx context.Context) {
+	timer := time.NewTimer(maxExpiryWait)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		next := s.expireDue(time.Now())
+		s.mu.Unlock()
+
+		wait := maxExpiryWait
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.expiryWake:
+		case <-ctx.Done():
+			slog.Info("Stopping lease expiry")
+			return
+		}
+	}
+}
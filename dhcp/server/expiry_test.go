@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"dhcp/lease"
+	"dhcp/protocol"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestExpiryGracePeriod(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.GracePeriod = 5 * time.Minute
+	s := newTestServer(t, cfg, lease.NewMemoryStore())
+	conn := s.conn.(*mockConn)
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	ip := net.ParseIP("192.168.1.120")
+	s.bind(macKey(mac), &binding{IP: ip, MAC: mac, State: LeaseBound, Expiration: time.Now().Add(-time.Minute)})
+
+	s.expireDue(time.Now())
+	if _, ok := s.bindings[macKey(mac)]; !ok {
+		t.Fatalf("Expected the lease to be kept during the grace period")
+	}
+	renew := newDiscover(mac)
+	renew.Options = []byte{protocol.OptionDHCPMessageType, 1, protocol.DHCPREQUEST}
+	renew.CIAddr = ip
+	s.handleRequest(renew, nil)
+	if ack := conn.sentPacket(); ack == nil || ack.DHCPMessageType() != protocol.DHCPACK {
+		t.Fatalf("Expected a late renewal within the grace period to be acknowledged")
+	}
+
+	s.expireDue(time.Now().Add(cfg.Lease + cfg.GracePeriod + time.Second))
+	if _, ok := s.bindings[macKey(mac)]; ok {
+		t.Errorf("Expected the lease to be reclaimed after the grace period")
+	}
+}
+
+func TestExpiredLeaseHistory(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.End = net.ParseIP("192.168.1.103")
+	s := newTestServer(t, cfg, lease.NewMemoryStore())
+	mac := func(i byte) net.HardwareAddr { return net.HardwareAddr{0x02, 0, 0, 0, 0, i} }
+
+	first := offered(s.createOffer(newDiscover(mac(1)), nil)).YIAddr
+	s.expireDue(time.Now().Add(time.Hour))
+	if _, ok := s.history[macKey(mac(1))]; !ok {
+		t.Fatalf("Expected the expired lease to be remembered")
+	}
+
+	// Other clients get never-used addresses before the expired one.
+	for i := byte(2); i <= 4; i++ {
+		if ip := offered(s.createOffer(newDiscover(mac(i)), nil)).YIAddr; ip.Equal(first) {
+			t.Errorf("Expected client %d not to get the expired address %s", i, first)
+		}
+	}
+	if ip := offered(s.createOffer(newDiscover(mac(1)), nil)).YIAddr; !ip.Equal(first) {
+		t.Errorf("Expected the returning client to get %s back, got %s", first, ip)
+	}
+
+	// Once the address goes to someone else the history entry is dropped.
+	s.expireDue(time.Now().Add(time.Hour))
+	s.unbind(macKey(mac(1)))
+	s.bind(macKey(mac(5)), &binding{IP: first, MAC: mac(5), State: LeaseOffered, Expiration: time.Now().Add(time.Minute)})
+	if _, ok := s.history[macKey(mac(1))]; ok {
+		t.Errorf("Expected the history of a reused address to be dropped")
+	}
+}
+
+func TestRunExpiry(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OfferTTL = 20 * time.Millisecond
+	s := newTestServer(t, cfg, lease.NewMemoryStore())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.runExpiry(ctx)
+
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	if offer := offered(s.createOffer(newDiscover(mac), nil)); offer == nil {
+		t.Fatalf("Expected an offer")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.mu.RLock()
+		_, ok := s.bindings[macKey(mac)]
+		s.mu.RUnlock()
+		if !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the offer to expire")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"dhcp/lease"
+	"dhcp/protocol"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"time"
+)
+
+// clientKey identifies the client a binding belongs to. Following RFC 2131
+// section 4.2 and RFC 6842 it is the client identifier (option 61) when the
+// client sends one, and the hardware type and address otherwise. With
+// ignore_client_id only the hardware address is used, e.g. for dual-boot
+// machines whose operating systems send different client identifiers.
+type clientKey string
+
+func clientIDKey(id []byte) clientKey {
+	return clientKey("id:" + hex.EncodeToString(id))
+}
+
+func hardwareKey(htype byte, addr net.HardwareAddr) clientKey {
+	return clientKey(fmt.Sprintf("hw:%d:%x", htype, []byte(addr)))
+}
+
+// clientKeyOf returns the key of the client that sent packet, or "" when the
+// packet carries neither a client identifier nor a hardware address.
+func (s *Server) clientKeyOf(packet *protocol.Packet) clientKey {
+	if !s.ignoreClientID {
+		if id := packet.GetOption(protocol.OptionClientIdentifier); len(id) > 0 {
+			return clientIDKey(id)
+		}
+	}
+	addr := clientHardwareAddr(packet)
+	if len(addr) == 0 {
+		return ""
+	}
+	return hardwareKey(packet.HType, addr)
+}
+
+// recordKey is clientKeyOf for a persisted lease.
+func (s *Server) recordKey(rec lease.Record) clientKey {
+	if !s.ignoreClientID && len(rec.ClientID) > 0 {
+		return clientIDKey(rec.ClientID)
+	}
+	if len(rec.MAC) == 0 {
+		return ""
+	}
+	htype := rec.HType
+	if htype == 0 {
+		htype = protocol.HTypeEthernet
+	}
+	return hardwareKey(htype, rec.MAC)
+}
+
+// newBinding binds ip to the client that sent packet.
+func newBinding(packet *protocol.Packet, ip net.IP, expiration time.Time) *binding {
+	b := &binding{
+		IP:         ip,
+		MAC:        clientHardwareAddr(packet),
+		HType:      packet.HType,
+		State:      LeaseOffered,
+		Expiration: expiration,
+	}
+	if id := packet.GetOption(protocol.OptionClientIdentifier); len(id) > 0 {
+		b.ClientID = id
+	}
+	b.setAgentInfo(packet)
+	b.setHostname(packet)
+	return b
+}
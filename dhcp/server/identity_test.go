@@ -0,0 +1,118 @@
+package server
+
+import (
+	"bytes"
+	"dhcp/lease"
+	"dhcp/protocol"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestClientIdentity(t *testing.T) {
+	dock := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	wifi := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x66}
+	duid := []byte{0xff, 0, 0, 0, 1, 0, 1, 0, 1, 0x2a, 0x3b, 0x4c, 0x5d}
+	withID := func(mac net.HardwareAddr, id []byte) *protocol.Packet {
+		p := newDiscover(mac)
+		p.AddOption(protocol.OptionClientIdentifier, id)
+		return p
+	}
+
+	s := newTestServer(t, newTestConfig(), lease.NewMemoryStore())
+	conn := s.conn.(*mockConn)
+	offer := func(p *protocol.Packet) *protocol.Packet {
+		t.Helper()
+		conn.p = nil
+		s.handleDiscover(p, nil)
+		sent := conn.sentPacket()
+		if sent == nil {
+			t.Fatalf("Expected an offer")
+		}
+		return sent
+	}
+
+	first := offer(withID(dock, duid))
+	if !bytes.Equal(first.GetOption(protocol.OptionClientIdentifier), duid) {
+		t.Errorf("Expected the offer to echo the client identifier")
+	}
+	if second := offer(withID(wifi, duid)); !second.YIAddr.Equal(first.YIAddr) {
+		t.Errorf("Expected the same client identifier to keep %s, got %s", first.YIAddr, second.YIAddr)
+	}
+	if other := offer(withID(dock, []byte{1, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55})); other.YIAddr.Equal(first.YIAddr) {
+		t.Errorf("Expected another client identifier on the same MAC to get its own address")
+	}
+
+	// InfiniBand clients send no hardware address in chaddr (RFC 4390).
+	ib := withID(nil, append([]byte{0xff}, bytes.Repeat([]byte{0xab}, 19)...))
+	ib.HType, ib.HLen = 32, 0
+	if s.clientKeyOf(ib) == "" {
+		t.Fatalf("Expected a key for an InfiniBand client")
+	}
+	offer(ib)
+
+	long := newDiscover(net.HardwareAddr{1, 2, 3, 4, 5, 6, 7, 8})
+	long.HType, long.HLen = 6, 8
+	if a, b := offer(long), offer(long); !a.YIAddr.Equal(b.YIAddr) {
+		t.Errorf("Expected an 8 byte hardware address to keep its binding")
+	}
+	if s.clientKeyOf(&protocol.Packet{HType: 1}) != "" {
+		t.Errorf("Expected no key without client identifier and hardware address")
+	}
+}
+
+func TestIgnoreClientID(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.IgnoreClientID = true
+	s := newTestServer(t, cfg, lease.NewMemoryStore())
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+
+	linux := newDiscover(mac)
+	linux.AddOption(protocol.OptionClientIdentifier, []byte{0xff, 1, 2, 3})
+	windows := newDiscover(mac)
+	windows.AddOption(protocol.OptionClientIdentifier, []byte{1, 0x00, 0x11, 0x22, 0x33, 0x44, 0x55})
+	if a, b := offered(s.createOffer(linux, nil)), offered(s.createOffer(windows, nil)); !a.YIAddr.Equal(b.YIAddr) {
+		t.Errorf("Expected both operating systems to get %s, got %s", a.YIAddr, b.YIAddr)
+	}
+	if _, ok := s.bindings[macKey(mac)]; !ok || len(s.bindings) != 1 {
+		t.Errorf("Expected a single binding keyed by MAC, got %v", s.bindings)
+	}
+}
+
+func TestRestoreClientID(t *testing.T) {
+	now := time.Now()
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	id := []byte{0xff, 1, 2, 3}
+	store := lease.NewMemoryStore(
+		lease.Record{Op: lease.OpAck, IP: net.ParseIP("192.168.1.100"), MAC: mac, HType: 1, ClientID: id, Expiration: now.Add(time.Hour), Time: now},
+		lease.Record{Op: lease.OpAck, IP: net.ParseIP("192.168.1.101"), MAC: mac, Expiration: now.Add(time.Hour), Time: now},
+	)
+	s := newTestServer(t, newTestConfig(), store)
+	if b, ok := s.bindings[clientIDKey(id)]; !ok || !b.IP.Equal(net.ParseIP("192.168.1.100")) {
+		t.Errorf("Expected the lease to be restored under its client identifier, got %v", s.bindings)
+	}
+	if b, ok := s.bindings[macKey(mac)]; !ok || !b.IP.Equal(net.ParseIP("192.168.1.101")) {
+		t.Errorf("Expected the record without htype to be restored as Ethernet, got %v", s.bindings)
+	}
+}
+
+func TestReleaseFromOtherClient(t *testing.T) {
+	s := newTestServer(t, newTestConfig(), lease.NewMemoryStore())
+	owner := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	ip := bindLease(t, s, owner, "")
+	release := func(mac net.HardwareAddr) {
+		p := newDiscover(mac)
+		p.Options = []byte{protocol.OptionDHCPMessageType, 1, protocol.DHCPRELEASE}
+		p.CIAddr = ip
+		s.handleRelease(p)
+	}
+
+	release(net.HardwareAddr{0x02, 0, 0, 0, 0, 2})
+	if _, err := s.Lease(ip); err != nil {
+		t.Errorf("Expected a RELEASE from another client to leave the lease, got %v", err)
+	}
+	release(owner)
+	if _, err := s.Lease(ip); err == nil {
+		t.Errorf("Expected the owner's RELEASE to end the lease")
+	}
+}
@@ -0,0 +1,231 @@
+package server
+
+import (
+	"context"
+	"dhcp/transport"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// interfaceRetryInterval is how often interfaces that are missing or went
+// down are opened again.
+var interfaceRetryInterval = 5 * time.Second
+
+// InterfaceConfig names an interface to serve on and the scopes of the
+// networks attached to it. Unrelayed clients on the interface are served
+// from the first of them, relayed ones from the scope of their
+// relay as usual.
+type InterfaceConfig struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+func (c *Config) validateInterfaces() error {
+	scopes := make(map[string]bool)
+	for _, sc := range c.scopes() {
+		scopes[sc.Name] = true
+	}
+	names := make(map[string]bool)
+	for i, ic := range c.Interfaces {
+		field := fmt.Sprintf("interfaces[%d]", i)
+		if ic.Name == "" {
+			return fieldError(field+".name", "is required")
+		}
+		if names[ic.Name] {
+			return fieldError(field+".name", "interface %q is listed more than once", ic.Name)
+		}
+		names[ic.Name] = true
+		if len(ic.Scopes) == 0 {
+			return fieldError(field+".scopes", "at least one scope is required")
+		}
+		for j, name := range ic.Scopes {
+			if !scopes[name] {
+				return fieldError(fmt.Sprintf("%s.scopes[%d]", field, j), "unknown scope %q", name)
+			}
+		}
+	}
+	return nil
+}
+
+// Listener opens the transport of a configured interface. It fails while
+// the interface does not exist or is down.
+type Listener func(iface string) (transport.Transport, error)
+
+// WithListener replaces how the transports of the configured interfaces
+// are opened.
+func WithListener(l Listener) Option {
+	return func(s *Server) {
+		s.listen = l
+	}
+}
+
+// link is a transport the server reads requests from. Replies to them are
+// sent on the same link.
+type link struct {
+	// name is the interface name, empty for the transport of a server
+	// without configured interfaces.
+	name string
+	t    transport.Transport
+	// scopes name the scopes serving the unrelayed clients of the link.
+	// They are nil for the default link, which serves them from the first
+	// scope. Names are looked up per request as reloads replace scopes.
+	scopes []string
+}
+
+// servesScope reports whether sc is attached to the link.
+func (l *link) servesScope(sc *scope) bool {
+	if l == nil || l.scopes == nil {
+		return true
+	}
+	for _, name := range l.scopes {
+		if name == sc.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// source is where a request came from.
+type source struct {
+	addr *net.UDPAddr
+	link *link
+	// reply is the message type of the reply sent, zero before one was.
+	reply byte
+}
+
+func (src *source) udpAddr() *net.UDPAddr {
+	if src == nil {
+		return nil
+	}
+	return src.addr
+}
+
+func (src *source) linkOf() *link {
+	if src == nil {
+		return nil
+	}
+	return src.link
+}
+
+// replyTransport returns the transport a reply to src is sent on.
+func (s *Server) replyTransport(src *source) transport.Transport {
+	if l := src.linkOf(); l != nil {
+		return l.t
+	}
+	return s.conn
+}
+
+// linkSet tracks the open links of the configured interfaces.
+type linkSet struct {
+	mu    sync.Mutex
+	links map[string]*link
+	// interfaces are the configured interfaces. They only change on
+	// restart.
+	interfaces []InterfaceConfig
+}
+
+// openInterfaces opens the links of configured interfaces that are not open
+// yet and returns the new ones.
+func (s *Server) openInterfaces() []*link {
+	var opened []*link
+	for _, ic := range s.links.interfaces {
+		s.links.mu.Lock()
+		_, open := s.links.links[ic.Name]
+		s.links.mu.Unlock()
+		if open {
+			continue
+		}
+		t, err := s.listen(ic.Name)
+		if err != nil {
+			slog.Debug("Interface not available", "interface", ic.Name, "error", err)
+			continue
+		}
+		l := &link{name: ic.Name, t: t, scopes: ic.Scopes}
+		s.links.mu.Lock()
+		s.links.links[ic.Name] = l
+		s.links.mu.Unlock()
+		slog.Info("Serving interface", "interface", ic.Name, "scopes", ic.Scopes)
+		opened = append(opened, l)
+	}
+	return opened
+}
+
+// closeLink stops serving l, e.g. after its interface went away.
+func (s *Server) closeLink(l *link) {
+	s.links.mu.Lock()
+	if s.links.links[l.name] == l {
+		delete(s.links.links, l.name)
+	}
+	s.links.mu.Unlock()
+	if err := l.t.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		slog.Error("Error closing interface", "interface", l.name, "error", err)
+	}
+}
+
+// Interfaces returns the names of the interfaces currently served.
+func (s *Server) Interfaces() []string {
+	s.links.mu.Lock()
+	defer s.links.mu.Unlock()
+	names := make([]string, 0, len(s.links.links))
+	for _, ic := range s.links.interfaces {
+		if _, ok := s.links.links[ic.Name]; ok {
+			names = append(names, ic.Name)
+		}
+	}
+	return names
+}
+
+func (s *Server) scopeByName(name string) *scope {
+	for _, sc := range s.scopes {
+		if sc.Name == name {
+			return sc
+		}
+	}
+	return nil
+}
+
+// serveInterfaces reads from the configured interfaces until ctx is done.
+// Links whose interface disappears are closed, missing interfaces are
+// opened again every interfaceRetryInterval.
+func (s *Server) serveInterfaces(ctx context.Context, readers *sync.WaitGroup) {
+	start := func(links []*link) {
+		for _, l := range links {
+			readers.Add(1)
+			go func() {
+				defer readers.Done()
+				if err := s.readLink(ctx, l); err != nil {
+					slog.Warn("Interface stopped", "interface", l.name, "error", err)
+					s.closeLink(l)
+				}
+			}()
+		}
+	}
+
+	s.links.mu.Lock()
+	initial := make([]*link, 0, len(s.links.links))
+	for _, l := range s.links.links {
+		initial = append(initial, l)
+	}
+	s.links.mu.Unlock()
+	start(initial)
+
+	ticker := time.NewTicker(interfaceRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			s.links.mu.Lock()
+			for _, l := range s.links.links {
+				l.t.Close()
+			}
+			s.links.mu.Unlock()
+			return
+		case <-ticker.C:
+		}
+		start(s.openInterfaces())
+	}
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"context"
+	"dhcp/lease"
+	"dhcp/protocol"
+	"dhcp/transport"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testLinks hands out the server ends of in-memory networks as interfaces.
+// Interfaces without a network do not exist.
+type testLinks struct {
+	mu       sync.Mutex
+	networks map[string]*transport.MemoryNetwork
+}
+
+func (l *testLinks) listen(iface string) (transport.Transport, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n, ok := l.networks[iface]
+	if !ok {
+		return nil, fmt.Errorf("no such interface %s", iface)
+	}
+	return n.Server(), nil
+}
+
+func (l *testLinks) set(iface string, n *transport.MemoryNetwork) {
+	l.mu.Lock()
+	l.networks[iface] = n
+	l.mu.Unlock()
+}
+
+func newInterfaceTestConfig() *Config {
+	cfg := newScopedTestConfig()
+	cfg.Scopes[1].Name = "office"
+	cfg.Interfaces = []InterfaceConfig{
+		{Name: "eth0", Scopes: []string{defaultScopeName}},
+		{Name: "eth1", Scopes: []string{"lab"}},
+		{Name: "eth2", Scopes: []string{"office", "lab"}},
+	}
+	return cfg
+}
+
+// discoverOn broadcasts a DISCOVER from mac on n and returns the OFFER.
+func discoverOn(t *testing.T, n *transport.MemoryNetwork, mac net.HardwareAddr) *protocol.Packet {
+	t.Helper()
+	c := n.Client(mac)
+	defer c.Close()
+	if _, err := c.WriteTo(newDiscover(mac).Encode(), &net.UDPAddr{IP: net.IPv4bcast, Port: 67}); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1500)
+	n2, _, err := c.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Expected an offer, got %v", err)
+	}
+	offer, err := protocol.Decode(buf[:n2])
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	return offer
+}
+
+func TestServeInterfaces(t *testing.T) {
+	retry := interfaceRetryInterval
+	interfaceRetryInterval = 10 * time.Millisecond
+	t.Cleanup(func() { interfaceRetryInterval = retry })
+
+	eth0, eth1 := transport.NewMemoryNetwork(), transport.NewMemoryNetwork()
+	links := &testLinks{networks: map[string]*transport.MemoryNetwork{"eth0": eth0, "eth1": eth1}}
+	s, err := NewServer(newInterfaceTestConfig(), WithListener(links.listen), WithLeaseStore(lease.NewMemoryStore()))
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Serve(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	if got := s.Interfaces(); len(got) != 2 || got[0] != "eth0" || got[1] != "eth1" {
+		t.Fatalf("Expected eth0 and eth1 to be served, got %v", got)
+	}
+	if offer := discoverOn(t, eth0, net.HardwareAddr{0x02, 0, 0, 0, 0, 1}); !offer.YIAddr.Equal(net.ParseIP("192.168.1.100")) {
+		t.Errorf("Expected 192.168.1.100 on eth0, got %s", offer.YIAddr)
+	}
+	if offer := discoverOn(t, eth1, net.HardwareAddr{0x02, 0, 0, 0, 0, 2}); !offer.YIAddr.Equal(net.ParseIP("10.10.0.100")) {
+		t.Errorf("Expected 10.10.0.100 on eth1, got %s", offer.YIAddr)
+	}
+
+	waitFor := func(what string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	serving := func(iface string) bool {
+		for _, name := range s.Interfaces() {
+			if name == iface {
+				return true
+			}
+		}
+		return false
+	}
+
+	// An interface that shows up later is picked up without a restart.
+	eth2 := transport.NewMemoryNetwork()
+	links.set("eth2", eth2)
+	waitFor("eth2", func() bool { return serving("eth2") })
+	if offer := discoverOn(t, eth2, net.HardwareAddr{0x02, 0, 0, 0, 0, 3}); !offer.YIAddr.Equal(net.ParseIP("10.20.0.100")) {
+		t.Errorf("Expected 10.20.0.100 on eth2, got %s", offer.YIAddr)
+	}
+
+	// One that goes away is dropped and opened again once it is back.
+	links.mu.Lock()
+	delete(links.networks, "eth1")
+	links.mu.Unlock()
+	eth1.Server().Close()
+	waitFor("eth1 to be dropped", func() bool { return !serving("eth1") })
+	eth1 = transport.NewMemoryNetwork()
+	links.set("eth1", eth1)
+	waitFor("eth1 to come back", func() bool { return serving("eth1") })
+	if offer := discoverOn(t, eth1, net.HardwareAddr{0x02, 0, 0, 0, 0, 4}); !offer.YIAddr.Equal(net.ParseIP("10.10.0.101")) {
+		t.Errorf("Expected 10.10.0.101 on eth1, got %s", offer.YIAddr)
+	}
+}
+
+func TestInterfaceScopeSelection(t *testing.T) {
+	links := &testLinks{networks: map[string]*transport.MemoryNetwork{}}
+	s, err := NewServer(newInterfaceTestConfig(), WithListener(links.listen), WithLeaseStore(lease.NewMemoryStore()))
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	eth2 := &link{name: "eth2", scopes: []string{"office", "lab"}}
+
+	request := func(ciaddr string) *protocol.Packet {
+		p := newDiscover(net.HardwareAddr{0x02, 0, 0, 0, 0, 1})
+		p.CIAddr = net.ParseIP(ciaddr)
+		return p
+	}
+	testCases := []struct {
+		name   string
+		packet *protocol.Packet
+		want   string
+	}{
+		{"new client", newDiscover(net.HardwareAddr{0x02, 0, 0, 0, 0, 1}), "office"},
+		{"address on the link", request("10.10.0.150"), "lab"},
+		{"address on another link", request("192.168.1.150"), "office"},
+		{"unknown address", request("172.16.0.1"), ""},
+	}
+	for _, tc := range testCases {
+		var got string
+		if sc := s.selectScope(tc.packet, eth2); sc != nil {
+			got = sc.Name
+		}
+		if got != tc.want {
+			t.Errorf("%s: expected scope %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestValidateInterfaces(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(*Config)
+		field  string
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"missing name", func(c *Config) { c.Interfaces[1].Name = "" }, "interfaces[1].name"},
+		{"duplicate", func(c *Config) { c.Interfaces[2].Name = "eth0" }, "interfaces[2].name"},
+		{"no scopes", func(c *Config) { c.Interfaces[0].Scopes = nil }, "interfaces[0].scopes"},
+		{"unknown scope", func(c *Config) { c.Interfaces[2].Scopes[1] = "guest" }, "interfaces[2].scopes[1]"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newInterfaceTestConfig()
+			tc.modify(cfg)
+			err := cfg.Validate()
+			if tc.field == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			var fe *FieldError
+			if !errors.As(err, &fe) || fe.Field != tc.field {
+				t.Errorf("Expected error for %q, got %v", tc.field, err)
+			}
+		})
+	}
+}
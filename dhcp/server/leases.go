@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"dhcp/lease"
+	"encoding/json"
+	"net"
+	"sort"
+	"time"
+)
+
+type LeaseState string
+
+const (
+	LeaseOffered     LeaseState = "offered"
+	LeaseBound       LeaseState = "bound"
+	LeaseQuarantined LeaseState = "quarantined"
+)
+
+func stateOf(op lease.Op) LeaseState {
+	if op == lease.OpOffer {
+		return LeaseOffered
+	}
+	return LeaseBound
+}
+
+// holdsLease reports whether b is an acknowledged lease of ip that has not
+// expired.
+func (b *binding) holdsLease(ip net.IP) bool {
+	return b.State == LeaseBound && b.IP.Equal(ip) && b.Expiration.After(time.Now())
+}
+
+// Lease is an entry of the lease listing: an address bound to a client or
+// held in quarantine.
+type Lease struct {
+	IP         net.IP
+	MAC        net.HardwareAddr
+	ClientID   []byte
+	Hostname   string
+	Scope      string
+	Expiration time.Time
+	State      LeaseState
+	CircuitID  []byte
+	RemoteID   []byte
+	// OutsidePool flags a binding a reload left outside the pools. It
+	// cannot be renewed.
+	OutsidePool bool
+}
+
+func (l Lease) MarshalJSON() ([]byte, error) {
+	aux := struct {
+		IP          string     `json:"ip"`
+		MAC         string     `json:"mac,omitempty"`
+		ClientID    string     `json:"client_id,omitempty"`
+		Hostname    string     `json:"hostname,omitempty"`
+		Scope       string     `json:"scope,omitempty"`
+		State       LeaseState `json:"state"`
+		Expiration  time.Time  `json:"expiration"`
+		CircuitID   string     `json:"circuit_id,omitempty"`
+		RemoteID    string     `json:"remote_id,omitempty"`
+		OutsidePool bool       `json:"outside_pool,omitempty"`
+	}{
+		IP:          l.IP.String(),
+		MAC:         l.MAC.String(),
+		ClientID:    formatHexBytes(l.ClientID),
+		Hostname:    l.Hostname,
+		Scope:       l.Scope,
+		State:       l.State,
+		Expiration:  l.Expiration,
+		CircuitID:   formatAgentID(l.CircuitID),
+		RemoteID:    formatAgentID(l.RemoteID),
+		OutsidePool: l.OutsidePool,
+	}
+	return json.Marshal(aux)
+}
+
+// Leases returns the current leases ordered by IP.
+func (s *Server) Leases() []Lease {
+	s.mu.RLock()
+	leases := make([]Lease, 0, len(s.bindings)+len(s.quarantined))
+	for _, b := range s.bindings {
+		leases = append(leases, s.leaseOf(b))
+	}
+	for _, q := range s.quarantined {
+		leases = append(leases, s.quarantinedLease(q))
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(leases, func(i, j int) bool {
+		return bytes.Compare(leases[i].IP.To4(), leases[j].IP.To4()) < 0
+	})
+	return leases
+}
+
+func (s *Server) leaseOf(b *binding) Lease {
+	return Lease{
+		IP:          b.IP,
+		MAC:         b.MAC,
+		ClientID:    b.ClientID,
+		Hostname:    b.Hostname,
+		Scope:       s.scopeName(b.IP),
+		Expiration:  b.Expiration,
+		State:       b.State,
+		CircuitID:   b.CircuitID,
+		RemoteID:    b.RemoteID,
+		OutsidePool: b.OutsidePool,
+	}
+}
+
+func (s *Server) quarantinedLease(q *quarantine) Lease {
+	return Lease{IP: q.IP, MAC: q.MAC, Scope: s.scopeName(q.IP), Expiration: q.Until, State: LeaseQuarantined}
+}
+
+func (s *Server) scopeName(ip net.IP) string {
+	if sc := s.scopeForIP(ip); sc != nil {
+		return sc.Name
+	}
+	return ""
+}
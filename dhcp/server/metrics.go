@@ -0,0 +1,361 @@
+package server
+
+import (
+	"context"
+	"dhcp/protocol"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes of a request in dhcp_packets_total. Requests without a reply,
+// DHCPRELEASE and DHCPDECLINE, count as outcomeNone.
+const (
+	outcomeOffer = "offer"
+	outcomeAck   = "ack"
+	outcomeNak   = "nak"
+	outcomeDrop  = "drop"
+	outcomeNone  = "none"
+)
+
+// latencyBuckets are the upper bounds of dhcp_handler_duration_seconds.
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+type packetLabels struct {
+	msgType, outcome string
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets))
+	}
+	for i, le := range latencyBuckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// metrics counts the packets the server handled. Gauges are read from the
+// server state when scraped.
+type metrics struct {
+	mu           sync.Mutex
+	packets      map[packetLabels]uint64
+	decodeErrors map[string]uint64
+	latency      map[string]*histogram
+}
+
+func (m *metrics) countPacket(msgType, outcome string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.packets == nil {
+		m.packets = make(map[packetLabels]uint64)
+	}
+	m.packets[packetLabels{msgType, outcome}]++
+}
+
+// countDecodeError counts an undecodable packet as dropped.
+func (m *metrics) countDecodeError(err error) {
+	m.countPacket("unknown", outcomeDrop)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.decodeErrors == nil {
+		m.decodeErrors = make(map[string]uint64)
+	}
+	m.decodeErrors[decodeErrorReason(err)]++
+}
+
+func (m *metrics) observeLatency(msgType string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.latency == nil {
+		m.latency = make(map[string]*histogram)
+	}
+	h, ok := m.latency[msgType]
+	if !ok {
+		h = &histogram{}
+		m.latency[msgType] = h
+	}
+	h.observe(d.Seconds())
+}
+
+func decodeErrorReason(err error) string {
+	switch {
+	case errors.Is(err, protocol.ErrPacketTooShort):
+		return "too_short"
+	case errors.Is(err, protocol.ErrBadMagicCookie):
+		return "bad_magic_cookie"
+	case errors.Is(err, protocol.ErrInvalidHardwareLength):
+		return "invalid_hardware_length"
+	case errors.Is(err, protocol.ErrTruncatedOption):
+		return "truncated_option"
+	}
+	return "other"
+}
+
+// messageTypeName is the label value of a DHCP message type.
+func messageTypeName(t byte) string {
+	switch t {
+	case protocol.DHCPDISCOVER:
+		return "discover"
+	case protocol.DHCPREQUEST:
+		return "request"
+	case protocol.DHCPDECLINE:
+		return "decline"
+	case protocol.DHCPRELEASE:
+		return "release"
+	case protocol.DHCPINFORM:
+		return "inform"
+	}
+	return "unknown"
+}
+
+// replyOutcome is the outcome of a request answered with reply.
+func replyOutcome(reply byte) string {
+	switch reply {
+	case protocol.DHCPOFFER:
+		return outcomeOffer
+	case protocol.DHCPACK:
+		return outcomeAck
+	case protocol.DHCPNAK:
+		return outcomeNak
+	}
+	return outcomeDrop
+}
+
+// PacketCount is the number of requests of a message type with an outcome.
+type PacketCount struct {
+	Type    string `json:"type"`
+	Outcome string `json:"outcome"`
+	Count   uint64 `json:"count"`
+}
+
+// Stats summarizes the traffic the server handled since it started.
+type Stats struct {
+	Packets       []PacketCount     `json:"packets"`
+	DecodeErrors  map[string]uint64 `json:"decode_errors"`
+	QueueDepth    int               `json:"queue_depth"`
+	QueueCapacity int               `json:"queue_capacity"`
+	Probes        ProbeStats        `json:"probes"`
+	Interfaces    []string          `json:"interfaces,omitempty"`
+}
+
+// Stats returns the packet counters, queue usage and conflict probe
+// counters.
+func (s *Server) Stats() Stats {
+	stats := Stats{
+		Packets:       []PacketCount{},
+		DecodeErrors:  make(map[string]uint64),
+		QueueDepth:    len(s.processChan),
+		QueueCapacity: cap(s.processChan),
+		Probes:        s.ProbeStats(),
+		Interfaces:    s.Interfaces(),
+	}
+	s.metrics.mu.Lock()
+	for _, k := range s.metrics.packetKeys() {
+		stats.Packets = append(stats.Packets, PacketCount{Type: k.msgType, Outcome: k.outcome, Count: s.metrics.packets[k]})
+	}
+	for reason, n := range s.metrics.decodeErrors {
+		stats.DecodeErrors[reason] = n
+	}
+	s.metrics.mu.Unlock()
+	return stats
+}
+
+// packetKeys returns the labels of the packet counters in order. m.mu must
+// be held.
+func (m *metrics) packetKeys() []packetLabels {
+	keys := make([]packetLabels, 0, len(m.packets))
+	for k := range m.packets {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].msgType != keys[j].msgType {
+			return keys[i].msgType < keys[j].msgType
+		}
+		return keys[i].outcome < keys[j].outcome
+	})
+	return keys
+}
+
+// PoolStats is the address and lease usage of a scope, including the pools
+// of its classes.
+type PoolStats struct {
+	Scope        string `json:"scope"`
+	Size         int    `json:"size"`
+	Used         int    `json:"used"`
+	Free         int    `json:"free"`
+	Quarantined  int    `json:"quarantined"`
+	ActiveLeases int    `json:"active_leases"`
+}
+
+// PoolStats returns the usage of every scope in configuration order.
+func (s *Server) PoolStats() []PoolStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	usage := make([]PoolStats, len(s.scopes))
+	index := make(map[*scope]int, len(s.scopes))
+	for i, sc := range s.scopes {
+		index[sc] = i
+		u := &usage[i]
+		u.Scope = sc.Name
+		stats := sc.pool.Stats()
+		for _, cl := range sc.classes {
+			if cl.pool != nil {
+				cs := cl.pool.Stats()
+				stats.Size += cs.Size
+				stats.Free += cs.Free
+				stats.Allocated += cs.Allocated
+			}
+		}
+		u.Size, u.Free, u.Used = stats.Size, stats.Free, stats.Allocated
+	}
+	now := time.Now()
+	for _, b := range s.bindings {
+		if sc := s.scopeForIP(b.IP); sc != nil && b.State == LeaseBound && b.Expiration.After(now) {
+			usage[index[sc]].ActiveLeases++
+		}
+	}
+	for _, q := range s.quarantined {
+		if sc := s.scopeForIP(q.IP); sc != nil && sc.inPool(q.IP) {
+			// Quarantined addresses stay taken in their pool.
+			usage[index[sc]].Quarantined++
+			usage[index[sc]].Used--
+		}
+	}
+	return usage
+}
+
+// MetricsHandler serves the server metrics in the Prometheus text format.
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		var b strings.Builder
+		s.writeMetrics(&b)
+		fmt.Fprint(w, b.String())
+	})
+}
+
+func (s *Server) writeMetrics(b *strings.Builder) {
+	p := promWriter{b}
+
+	s.metrics.mu.Lock()
+	p.header("dhcp_packets_total", "counter", "DHCP requests by message type and outcome.")
+	for _, k := range s.metrics.packetKeys() {
+		p.sample("dhcp_packets_total", float64(s.metrics.packets[k]), "type", k.msgType, "outcome", k.outcome)
+	}
+
+	p.header("dhcp_decode_errors_total", "counter", "Packets dropped because they could not be decoded, by reason.")
+	for _, reason := range sortedKeys(s.metrics.decodeErrors) {
+		p.sample("dhcp_decode_errors_total", float64(s.metrics.decodeErrors[reason]), "reason", reason)
+	}
+
+	p.header("dhcp_handler_duration_seconds", "histogram", "Time spent handling a request, by message type.")
+	for _, msgType := range sortedKeys(s.metrics.latency) {
+		h := s.metrics.latency[msgType]
+		for i, le := range latencyBuckets {
+			p.sample("dhcp_handler_duration_seconds_bucket", float64(h.counts[i]), "type", msgType, "le", formatFloat(le))
+		}
+		p.sample("dhcp_handler_duration_seconds_bucket", float64(h.count), "type", msgType, "le", "+Inf")
+		p.sample("dhcp_handler_duration_seconds_sum", h.sum, "type", msgType)
+		p.sample("dhcp_handler_duration_seconds_count", float64(h.count), "type", msgType)
+	}
+	s.metrics.mu.Unlock()
+
+	p.header("dhcp_queue_depth", "gauge", "Requests read but not yet handled.")
+	p.sample("dhcp_queue_depth", float64(len(s.processChan)))
+	p.header("dhcp_queue_capacity", "gauge", "Requests that can be queued before reading blocks.")
+	p.sample("dhcp_queue_capacity", float64(cap(s.processChan)))
+
+	usage := s.PoolStats()
+	gauges := []struct {
+		name, help string
+		value      func(u PoolStats) int
+	}{
+		{"dhcp_pool_size", "Addresses in the pools of a scope.", func(u PoolStats) int { return u.Size }},
+		{"dhcp_pool_used", "Addresses offered, leased or reserved.", func(u PoolStats) int { return u.Used }},
+		{"dhcp_pool_free", "Addresses that can be allocated.", func(u PoolStats) int { return u.Free }},
+		{"dhcp_pool_quarantined", "Addresses held back after a conflict or decline.", func(u PoolStats) int { return u.Quarantined }},
+		{"dhcp_leases_active", "Bound leases that have not expired.", func(u PoolStats) int { return u.ActiveLeases }},
+	}
+	for _, g := range gauges {
+		p.header(g.name, "gauge", g.help)
+		for _, u := range usage {
+			p.sample(g.name, float64(g.value(u)), "scope", u.Scope)
+		}
+	}
+
+	probes := s.ProbeStats()
+	p.header("dhcp_conflict_probes_total", "counter", "Conflict probes by result.")
+	p.sample("dhcp_conflict_probes_total", float64(probes.Free), "result", "free")
+	p.sample("dhcp_conflict_probes_total", float64(probes.InUse), "result", "in_use")
+	p.sample("dhcp_conflict_probes_total", float64(probes.Failed), "result", "failed")
+}
+
+// serveMetrics serves /metrics on addr until ctx is done.
+func (s *Server) serveMetrics(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.MetricsHandler())
+	serveHTTP(ctx, "metrics", addr, mux)
+}
+
+// promWriter writes the Prometheus text exposition format.
+type promWriter struct {
+	b *strings.Builder
+}
+
+func (p promWriter) header(name, typ, help string) {
+	fmt.Fprintf(p.b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes a sample of name with the label name and value pairs in
+// labels.
+func (p promWriter) sample(name string, value float64, labels ...string) {
+	p.b.WriteString(name)
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i == 0 {
+			p.b.WriteByte('{')
+		} else {
+			p.b.WriteByte(',')
+		}
+		fmt.Fprintf(p.b, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+	}
+	if len(labels) > 0 {
+		p.b.WriteByte('}')
+	}
+	p.b.WriteByte(' ')
+	p.b.WriteString(formatFloat(value))
+	p.b.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
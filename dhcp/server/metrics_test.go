@@ -0,0 +1,138 @@
+package server
+
+import (
+	"context"
+	"dhcp/lease"
+	"dhcp/transport"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// scrape returns the metrics served at addr by sample, e.g.
+// `dhcp_pool_free{scope="default"}`.
+func scrape(addr string) (map[string]string, error) {
+	resp, err := http.Get("http://" + addr + "/metrics")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		return nil, fmt.Errorf("unexpected content type %q", ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	samples := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			return nil, fmt.Errorf("malformed sample %q", line)
+		}
+		samples[line[:i]] = line[i+1:]
+	}
+	return samples, nil
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	cfg := newTestConfig()
+	cfg.MetricsAddr = addr
+	cfg.QuarantineTime = time.Hour
+	network := transport.NewMemoryNetwork()
+	s, err := NewServer(cfg, WithTransport(network.Server()), WithLeaseStore(lease.NewMemoryStore()))
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	s.mu.Lock()
+	s.quarantineLocked(net.ParseIP("192.168.1.150"), nil, lease.OpDecline, time.Hour)
+	s.mu.Unlock()
+	if !s.scopes[0].pool.Take(net.ParseIP("192.168.1.150")) {
+		t.Fatalf("Expected the quarantined address to be free in the pool")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Serve(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	offer := discoverOn(t, network, mac)
+	c := network.Client(mac)
+	defer c.Close()
+	bcast := &net.UDPAddr{IP: net.IPv4bcast, Port: 67}
+	c.WriteTo(newSelectingRequest(mac, offer.YIAddr).Encode(), bcast)
+	c.WriteTo([]byte{1, 2, 3}, bcast)
+	c.WriteTo(newSelectingRequest(mac, net.ParseIP("192.168.1.199")).Encode(), bcast)
+
+	want := map[string]string{
+		`dhcp_packets_total{type="discover",outcome="offer"}`:             "1",
+		`dhcp_packets_total{type="request",outcome="ack"}`:                "1",
+		`dhcp_packets_total{type="request",outcome="nak"}`:                "1",
+		`dhcp_packets_total{type="unknown",outcome="drop"}`:               "1",
+		`dhcp_decode_errors_total{reason="too_short"}`:                    "1",
+		`dhcp_handler_duration_seconds_count{type="request"}`:             "2",
+		`dhcp_handler_duration_seconds_bucket{type="discover",le="+Inf"}`: "1",
+		`dhcp_queue_depth`:                          "0",
+		`dhcp_queue_capacity`:                       "100",
+		`dhcp_pool_size{scope="default"}`:           "101",
+		`dhcp_pool_used{scope="default"}`:           "1",
+		`dhcp_pool_free{scope="default"}`:           "99",
+		`dhcp_pool_quarantined{scope="default"}`:    "1",
+		`dhcp_leases_active{scope="default"}`:       "1",
+		`dhcp_conflict_probes_total{result="free"}`: "0",
+	}
+	// Requests are handled asynchronously and the endpoint may not be up
+	// yet, so scrape until both requests are counted.
+	var samples map[string]string
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		var err error
+		samples, err = scrape(addr)
+		if err == nil && samples[`dhcp_handler_duration_seconds_count{type="request"}`] == "2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out scraping metrics: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for sample, value := range want {
+		if samples[sample] != value {
+			t.Errorf("Expected %s %s, got %q", sample, value, samples[sample])
+		}
+	}
+}
+
+func TestPromWriter(t *testing.T) {
+	var b strings.Builder
+	p := promWriter{&b}
+	p.header("dhcp_test", "gauge", "A test.")
+	p.sample("dhcp_test", 0.25, "scope", "a \"b\"\\c\n")
+	p.sample("dhcp_test", 3)
+	want := "# HELP dhcp_test A test.\n# TYPE dhcp_test gauge\n" +
+		`dhcp_test{scope="a \"b\"\\c\n"} 0.25` + "\ndhcp_test 3\n"
+	if b.String() != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, b.String())
+	}
+}
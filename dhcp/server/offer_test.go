@@ -0,0 +1,114 @@
+package server
+
+import (
+	"dhcp/lease"
+	"dhcp/protocol"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func newSelectingRequest(mac net.HardwareAddr, ip net.IP) *protocol.Packet {
+	p := newDiscover(mac)
+	p.Options = []byte{protocol.OptionDHCPMessageType, 1, protocol.DHCPREQUEST}
+	p.SIAddr = net.ParseIP("192.168.1.2")
+	p.AddOption(protocol.OptionRequestedIPAddress, ip.To4())
+	p.AddOption(protocol.OptionServerIdentifier, net.ParseIP("192.168.1.2").To4())
+	return p
+}
+
+// offered drops the fresh flag of createOffer.
+func offered(offer *protocol.Packet, _ bool) *protocol.Packet {
+	return offer
+}
+
+func TestOfferTTL(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.OfferTTL = 30 * time.Second
+	store := lease.NewMemoryStore()
+	s := newTestServer(t, cfg, store)
+	conn := s.conn.(*mockConn)
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+
+	s.handleDiscover(newDiscover(mac), nil)
+	offer := conn.sentPacket()
+	if lt, _ := offer.GetDurationOption(protocol.OptionIPAddressLeaseTime); lt != cfg.Lease {
+		t.Errorf("Expected the offer to announce the full lease, got %s", lt)
+	}
+	b := s.bindings[macKey(mac)]
+	if b.State != LeaseOffered || time.Until(b.Expiration) > cfg.OfferTTL {
+		t.Fatalf("Expected an offer held for %s, got %s until %s", cfg.OfferTTL, b.State, b.Expiration)
+	}
+
+	s.expireDue(time.Now().Add(time.Minute))
+	if len(s.bindings) != 0 || !s.scopes[0].pool.Take(offer.YIAddr) {
+		t.Fatalf("Expected the unrequested offer to return to the pool")
+	}
+	s.scopes[0].pool.Release(offer.YIAddr)
+
+	s.handleDiscover(newDiscover(mac), nil)
+	offer = conn.sentPacket()
+	s.handleRequest(newSelectingRequest(mac, offer.YIAddr), nil)
+	if ack := conn.sentPacket(); ack.DHCPMessageType() != protocol.DHCPACK {
+		t.Fatalf("Expected an ACK, got %d", ack.DHCPMessageType())
+	}
+	b = s.bindings[macKey(mac)]
+	if b.State != LeaseBound || time.Until(b.Expiration) < cfg.Lease-time.Minute {
+		t.Errorf("Expected the offer to become a full lease, got %s until %s", b.State, b.Expiration)
+	}
+	if leases := s.Leases(); len(leases) != 1 || leases[0].State != LeaseBound {
+		t.Errorf("Expected a bound lease in the listing, got %+v", leases)
+	}
+
+	expiration := b.Expiration
+	s.handleDiscover(newDiscover(mac), nil)
+	if b = s.bindings[macKey(mac)]; b.State != LeaseBound || !b.Expiration.Equal(expiration) {
+		t.Errorf("Expected a rediscover not to shorten the lease, got %s until %s", b.State, b.Expiration)
+	}
+	s.expireDue(time.Now().Add(time.Minute))
+	if _, ok := s.bindings[macKey(mac)]; !ok {
+		t.Errorf("Expected the bound lease to outlive the offer TTL")
+	}
+}
+
+func TestOfferFloodReclaimsExpiredOffers(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.End = net.ParseIP("192.168.1.102")
+	s := newTestServer(t, cfg, lease.NewMemoryStore())
+
+	for i := byte(0); i < 3; i++ {
+		if offered(s.createOffer(newDiscover(net.HardwareAddr{0x02, 0, 0, 0, 0, i}), nil)) == nil {
+			t.Fatalf("Expected an offer for client %d", i)
+		}
+	}
+	late := net.HardwareAddr{0x02, 0, 0, 0, 0, 9}
+	if offered(s.createOffer(newDiscover(late), nil)) != nil {
+		t.Fatalf("Expected the pool to be exhausted")
+	}
+
+	b := s.bindings[macKey(net.HardwareAddr{0x02, 0, 0, 0, 0, 1})]
+	b.Expiration = time.Now().Add(-time.Second)
+	s.scheduleExpiry(b.IP, b.Expiration)
+	if offer := offered(s.createOffer(newDiscover(late), nil)); offer == nil || !offer.YIAddr.Equal(net.ParseIP("192.168.1.101")) {
+		t.Errorf("Expected the expired offer to be reused, got %v", offer)
+	}
+}
+
+func TestOfferSendFailureKeepsLease(t *testing.T) {
+	s := newTestServer(t, newTestConfig(), lease.NewMemoryStore())
+	conn := s.conn.(*mockConn)
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	ip := bindLease(t, s, mac, "")
+
+	conn.err = errors.New("send failed")
+	s.handleDiscover(newDiscover(mac), nil)
+	if l, err := s.Lease(ip); err != nil || l.State != LeaseBound {
+		t.Errorf("Expected the bound lease to survive a failed offer, got %+v, %v", l, err)
+	}
+
+	s.handleDiscover(newDiscover(net.HardwareAddr{0x02, 0, 0, 0, 0, 2}), nil)
+	if got := s.PoolStats(); got[0].Used != 1 {
+		t.Errorf("Expected the address allocated for the failed offer to be released, got %+v", got)
+	}
+}
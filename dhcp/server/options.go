@@ -0,0 +1,168 @@
+package server
+
+import (
+	"dhcp/protocol"
+	"fmt"
+	"net"
+	"time"
+)
+
+// OptionConfig is an additional option of the served scope. It is sent to
+// clients that ask for it in their parameter request list, or to every
+// client when Always is set. The value is given as exactly one of "ips",
+// "text", "uint8", "uint16", "uint32", "duration", "domains", "routes" or
+// "hex" in configuration files.
+type OptionConfig struct {
+	Code   byte   `json:"code"`
+	Always bool   `json:"always"`
+	Data   []byte `json:"-"`
+}
+
+func (o *OptionConfig) UnmarshalJSON(data []byte) error {
+	type plain OptionConfig
+	aux := struct {
+		*plain
+		IPs      []net.IP      `json:"ips"`
+		Text     *string       `json:"text"`
+		Uint8    *uint8        `json:"uint8"`
+		Uint16   *uint16       `json:"uint16"`
+		Uint32   *uint32       `json:"uint32"`
+		Duration *Duration     `json:"duration"`
+		Domains  []string      `json:"domains"`
+		Routes   []RouteConfig `json:"routes"`
+		Hex      *string       `json:"hex"`
+	}{plain: (*plain)(o)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return fieldDecodeError(data, err, func(field []byte) error {
+			return new(OptionConfig).UnmarshalJSON(field)
+		})
+	}
+
+	values := 0
+	if aux.IPs != nil {
+		values++
+		for i, ip := range aux.IPs {
+			if err := validateIPv4(fmt.Sprintf("ips[%d]", i), ip); err != nil {
+				return err
+			}
+		}
+		o.Data = protocol.EncodeIPs(aux.IPs)
+	}
+	if aux.Text != nil {
+		values++
+		o.Data = protocol.EncodeString(*aux.Text)
+	}
+	if aux.Uint8 != nil {
+		values++
+		o.Data = protocol.EncodeUint8(*aux.Uint8)
+	}
+	if aux.Uint16 != nil {
+		values++
+		o.Data = protocol.EncodeUint16(*aux.Uint16)
+	}
+	if aux.Uint32 != nil {
+		values++
+		o.Data = protocol.EncodeUint32(*aux.Uint32)
+	}
+	if aux.Duration != nil {
+		values++
+		o.Data = protocol.EncodeDuration(time.Duration(*aux.Duration))
+	}
+	if aux.Domains != nil {
+		values++
+		b, err := protocol.EncodeDomainList(aux.Domains)
+		if err != nil {
+			return fieldError("domains", "%v", err)
+		}
+		o.Data = b
+	}
+	if aux.Routes != nil {
+		values++
+		routes := make([]protocol.Route, len(aux.Routes))
+		for i, r := range aux.Routes {
+			routes[i] = protocol.Route{Destination: r.Destination, Router: r.Router}
+		}
+		b, err := protocol.EncodeClasslessRoutes(routes)
+		if err != nil {
+			return fieldError("routes", "%v", err)
+		}
+		o.Data = b
+	}
+	if aux.Hex != nil {
+		values++
+		b, err := parseHexBytes(*aux.Hex)
+		if err != nil {
+			return fieldError("hex", "%v", err)
+		}
+		o.Data = b
+	}
+	if values != 1 {
+		return fieldError("code", "option %d needs exactly one value", o.Code)
+	}
+	if _, err := protocol.ParseOptionValue(o.Code, o.Data); err != nil {
+		return fieldError("code", "%v", err)
+	}
+	return nil
+}
+
+// RouteConfig is a classless static route in configuration files.
+type RouteConfig struct {
+	Destination net.IPNet `json:"-"`
+	Router      net.IP    `json:"router"`
+}
+
+func (r *RouteConfig) UnmarshalJSON(data []byte) error {
+	type plain RouteConfig
+	aux := struct {
+		*plain
+		Destination string `json:"destination"`
+	}{plain: (*plain)(r)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return fieldDecodeError(data, err, func(field []byte) error {
+			return new(RouteConfig).UnmarshalJSON(field)
+		})
+	}
+	_, dest, err := net.ParseCIDR(aux.Destination)
+	if err != nil {
+		return fieldError("destination", "%v", err)
+	}
+	r.Destination = *dest
+	return nil
+}
+
+// reservedOptionCodes are managed by the server and cannot be configured.
+var reservedOptionCodes = map[byte]bool{
+	protocol.OptionPad:                  true,
+	protocol.OptionEnd:                  true,
+	protocol.OptionRequestedIPAddress:   true,
+	protocol.OptionOverload:             true,
+	protocol.OptionDHCPMessageType:      true,
+	protocol.OptionServerIdentifier:     true,
+	protocol.OptionParameterRequestList: true,
+	protocol.OptionMaxMessageSize:       true,
+}
+
+func validateOptions(field string, options []OptionConfig) error {
+	seen := make(map[byte]bool)
+	for i, o := range options {
+		f := fmt.Sprintf("%s[%d].code", field, i)
+		if reservedOptionCodes[o.Code] {
+			return fieldError(f, "option %d is managed by the server", o.Code)
+		}
+		if seen[o.Code] {
+			return fieldError(f, "option %d is configured more than once", o.Code)
+		}
+		seen[o.Code] = true
+	}
+	return nil
+}
+
+func replyExtras(options []OptionConfig) (extra []protocol.Option, always []byte) {
+	for _, o := range options {
+		extra = append(extra, protocol.Option{Code: o.Code, Data: o.Data})
+		if o.Always {
+			always = append(always, o.Code)
+		}
+	}
+	return extra, always
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"dhcp/lease"
+	"dhcp/protocol"
+	"log/slog"
+	"net"
+	"time"
+)
+
+const defaultQuarantineTime = time.Hour
+
+// quarantine is an address kept out of the pool because a client declined
+// it or a probe found it in use.
+type quarantine struct {
+	IP net.IP
+	// MAC is the client that declined the address, nil for probe conflicts.
+	MAC   net.HardwareAddr
+	Op    lease.Op
+	Until time.Time
+}
+
+func (c *Config) quarantineTime() time.Duration {
+	if c.QuarantineTime == 0 {
+		return defaultQuarantineTime
+	}
+	return c.QuarantineTime
+}
+
+// handleDecline quarantines an address the client found in use. As RFC 2131
+// section 4.3.3 describes, the address is in option 50 and ciaddr is zero.
+func (s *Server) handleDecline(packet *protocol.Packet) {
+	ip, err := packet.GetIPOption(protocol.OptionRequestedIPAddress)
+	if err != nil {
+		slog.Debug("Ignoring DHCPDECLINE without requested address", "addr", packet.CHAddr.String())
+		return
+	}
+	if id, err := packet.GetIPOption(protocol.OptionServerIdentifier); err == nil {
+		if sc := s.scopeForIP(ip); sc != nil && !id.Equal(sc.ServerIP) {
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.clientKeyOf(packet)
+	b, ok := s.bindings[key]
+	if !ok || !b.IP.Equal(ip) {
+		slog.Warn("Ignoring DHCPDECLINE for an address not bound to the client", "ip", ip, "addr", packet.CHAddr.String())
+		return
+	}
+	s.unbind(key)
+	if s.reservations.forIP(ip) != nil {
+		// The reservation stays, the conflicting host has to be fixed.
+		slog.Warn("Client declined its reserved address", "ip", ip, "addr", packet.CHAddr.String())
+		if err := s.persist(lease.OpRelease, b); err != nil {
+			slog.Error("Error persisting lease change", "op", lease.OpRelease, "ip", ip, "error", err)
+		}
+		return
+	}
+	s.quarantineLocked(ip, b.MAC, lease.OpDecline, s.config.quarantineTime())
+}
+
+// quarantineLocked keeps ip, which must not be in the free pool, out of it
+// for d.
+func (s *Server) quarantineLocked(ip net.IP, mac net.HardwareAddr, op lease.Op, d time.Duration) {
+	now := time.Now()
+	q := &quarantine{IP: ip, MAC: mac, Op: op, Until: now.Add(d)}
+	if err := s.store.Append(lease.Record{Op: op, IP: ip, MAC: mac, Expiration: q.Until, Time: now}); err != nil {
+		slog.Error("Error persisting quarantine", "ip", ip, "error", err)
+	}
+	delete(s.allocated, IPToUint32(ip))
+	s.quarantined[IPToUint32(ip)] = q
+	s.scheduleExpiry(ip, q.Until)
+	slog.Warn("Quarantined address", "ip", ip, "reason", op, "until", q.Until.Format(time.RFC3339))
+}
+
+// releaseQuarantined returns a quarantined address whose hold-down has
+// passed to its pool.
+func (s *Server) releaseQuarantined(q *quarantine, now time.Time) {
+	if err := s.store.Append(lease.Record{Op: lease.OpExpire, IP: q.IP, Time: now}); err != nil {
+		slog.Error("Error persisting lease change", "op", lease.OpExpire, "ip", q.IP, "error", err)
+	}
+	delete(s.quarantined, IPToUint32(q.IP))
+	if sc := s.scopeForIP(q.IP); sc != nil {
+		sc.poolFor(q.IP).Release(q.IP)
+	}
+	slog.Info("Released quarantined address", "ip", q.IP)
+}
+
+// restoreQuarantine takes a persisted quarantined address out of the pool
+// again. It reports whether the quarantine is still in effect.
+func (s *Server) restoreQuarantine(rec lease.Record) bool {
+	if !rec.Expiration.After(time.Now()) || s.reservations.forIP(rec.IP) != nil {
+		return false
+	}
+	sc := s.scopeForIP(rec.IP)
+	if sc == nil || !sc.poolFor(rec.IP).Take(rec.IP) {
+		slog.Warn("Ignoring persisted quarantine outside of the pool", "ip", rec.IP)
+		return false
+	}
+	s.quarantined[IPToUint32(rec.IP)] = &quarantine{IP: rec.IP, MAC: rec.MAC, Op: rec.Op, Until: rec.Expiration}
+	s.scheduleExpiry(rec.IP, rec.Expiration)
+	return true
+}
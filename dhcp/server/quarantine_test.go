@@ -0,0 +1,71 @@
+package server
+
+import (
+	"dhcp/lease"
+	"dhcp/protocol"
+	"net"
+	"testing"
+	"time"
+)
+
+func newDecline(mac net.HardwareAddr, ip string) *protocol.Packet {
+	p := newDiscover(mac)
+	p.Options = []byte{protocol.OptionDHCPMessageType, 1, protocol.DHCPDECLINE}
+	p.AddOption(protocol.OptionRequestedIPAddress, net.ParseIP(ip).To4())
+	p.AddOption(protocol.OptionServerIdentifier, net.ParseIP("192.168.1.2").To4())
+	return p
+}
+
+func TestDeclineQuarantinesAddress(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.QuarantineTime = 10 * time.Minute
+	store := lease.NewMemoryStore()
+	s := newTestServer(t, cfg, store)
+	conn := s.conn.(*mockConn)
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+
+	s.handleDiscover(newDiscover(mac), nil)
+	offered := conn.sentPacket().YIAddr.String()
+
+	s.handleDecline(newDecline(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x66}, offered))
+	if len(s.quarantined) != 0 {
+		t.Fatalf("Expected a DECLINE from another client to be ignored")
+	}
+	s.handleDecline(newDecline(mac, offered))
+	if _, ok := s.bindings[macKey(mac)]; ok {
+		t.Errorf("Expected the binding to be removed")
+	}
+
+	leases := s.Leases()
+	if len(leases) != 1 || leases[0].State != LeaseQuarantined || leases[0].IP.String() != offered || leases[0].MAC.String() != mac.String() {
+		t.Fatalf("Expected %s to be listed as quarantined, got %+v", offered, leases)
+	}
+	if until := time.Until(leases[0].Expiration); until < 9*time.Minute || until > 10*time.Minute {
+		t.Errorf("Expected a 10m hold-down, got %s", until)
+	}
+
+	s.handleDiscover(newDiscover(mac), nil)
+	if ip := conn.sentPacket().YIAddr.String(); ip == offered {
+		t.Errorf("Expected the quarantined address not to be offered again")
+	}
+
+	restarted := newTestServer(t, cfg, store)
+	if _, ok := restarted.quarantined[IPToUint32(net.ParseIP(offered))]; !ok {
+		t.Fatalf("Expected the quarantine to survive a restart")
+	}
+	if restarted.scopes[0].pool.Take(net.ParseIP(offered)) {
+		t.Errorf("Expected the restored quarantined address to be out of the pool")
+	}
+
+	s.expireDue(time.Now().Add(time.Hour))
+	if len(s.quarantined) != 0 || !s.scopes[0].pool.Take(net.ParseIP(offered)) {
+		t.Errorf("Expected the address to return to the pool after the hold-down")
+	}
+	released := false
+	for _, rec := range store.Records() {
+		released = released || rec.Op == lease.OpExpire && rec.IP.String() == offered
+	}
+	if !released {
+		t.Errorf("Expected the release from quarantine to be persisted")
+	}
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"dhcp/pool"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IPRange is an inclusive range of addresses. In configuration files it is
+// either an object with start and end, or a string holding a single address
+// or two addresses separated by a dash ("10.0.0.10-10.0.0.19").
+type IPRange struct {
+	Start net.IP `json:"start"`
+	End   net.IP `json:"end"`
+}
+
+func (r *IPRange) UnmarshalJSON(data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) != nil {
+		type plain IPRange
+		return decodeStrict(data, (*plain)(r))
+	}
+	start, end, found := strings.Cut(s, "-")
+	if !found {
+		end = start
+	}
+	r.Start = net.ParseIP(strings.TrimSpace(start))
+	r.End = net.ParseIP(strings.TrimSpace(end))
+	if r.Start == nil || r.End == nil {
+		return fmt.Errorf("invalid address range %q", s)
+	}
+	return nil
+}
+
+func (r IPRange) String() string {
+	if r.Start.Equal(r.End) {
+		return r.Start.String()
+	}
+	return r.Start.String() + "-" + r.End.String()
+}
+
+func (r IPRange) contains(ip net.IP) bool {
+	return ipInRange(ip, r.Start, r.End)
+}
+
+func (r IPRange) overlaps(o IPRange) bool {
+	return IPToUint32(r.Start) <= IPToUint32(o.End) && IPToUint32(o.Start) <= IPToUint32(r.End)
+}
+
+func (r IPRange) validate(field string) error {
+	if err := validateIPv4(field+".start", r.Start); err != nil {
+		return err
+	}
+	if err := validateIPv4(field+".end", r.End); err != nil {
+		return err
+	}
+	if IPToUint32(r.Start) > IPToUint32(r.End) {
+		return fieldError(field+".end", "%s is before start %s", r.End, r.Start)
+	}
+	return nil
+}
+
+// poolRanges returns the dynamic ranges of the scope: start and end, if
+// set, followed by ranges.
+func (sc *ScopeConfig) poolRanges() []IPRange {
+	var all []IPRange
+	if sc.Start != nil || sc.End != nil {
+		all = append(all, IPRange{Start: sc.Start, End: sc.End})
+	}
+	return append(all, sc.Ranges...)
+}
+
+// inPool reports whether ip is handed out from the scope's dynamic ranges.
+func (sc *ScopeConfig) inPool(ip net.IP) bool {
+	for _, r := range sc.Exclude {
+		if r.contains(ip) {
+			return false
+		}
+	}
+	for _, r := range sc.poolRanges() {
+		if r.contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeFor returns the dynamic range that contains all of r.
+func (sc *ScopeConfig) rangeFor(r IPRange) (IPRange, bool) {
+	for _, pr := range sc.poolRanges() {
+		if pr.contains(r.Start) && pr.contains(r.End) {
+			return pr, true
+		}
+	}
+	return IPRange{}, false
+}
+
+func (sc *ScopeConfig) validateRanges(prefix string) error {
+	if sc.Start == nil && sc.End == nil && len(sc.Ranges) == 0 {
+		return fieldError(prefix+"start", "is required unless ranges are set")
+	}
+	var seen []IPRange
+	if sc.Start != nil || sc.End != nil {
+		if err := validateIPv4(prefix+"start", sc.Start); err != nil {
+			return err
+		}
+		if err := validateIPv4(prefix+"end", sc.End); err != nil {
+			return err
+		}
+		if !sc.Subnet.Contains(sc.Start) {
+			return fieldError(prefix+"start", "%s is outside subnet %s", sc.Start, &sc.Subnet)
+		}
+		if !sc.Subnet.Contains(sc.End) {
+			return fieldError(prefix+"end", "%s is outside subnet %s", sc.End, &sc.Subnet)
+		}
+		if IPToUint32(sc.Start) > IPToUint32(sc.End) {
+			return fieldError(prefix+"end", "%s is before start %s", sc.End, sc.Start)
+		}
+		seen = append(seen, IPRange{Start: sc.Start, End: sc.End})
+	}
+	for i, r := range sc.Ranges {
+		field := fmt.Sprintf("%sranges[%d]", prefix, i)
+		if err := r.validate(field); err != nil {
+			return err
+		}
+		if !sc.Subnet.Contains(r.Start) || !sc.Subnet.Contains(r.End) {
+			return fieldError(field, "%s is outside subnet %s", r, &sc.Subnet)
+		}
+		for _, other := range seen {
+			if r.overlaps(other) {
+				return fieldError(field, "%s overlaps range %s", r, other)
+			}
+		}
+		seen = append(seen, r)
+	}
+	for i, r := range sc.Exclude {
+		if err := r.validate(fmt.Sprintf("%sexclude[%d]", prefix, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newPool returns the pool of the scope's dynamic ranges without the
+// excluded addresses and the ranges in carve, which are served by classes.
+func (sc *ScopeConfig) newPool(carve []IPRange) (*pool.IPPool, error) {
+	var ranges, exclude []pool.Range
+	for _, r := range sc.poolRanges() {
+		ranges = append(ranges, pool.Range{Start: r.Start, End: r.End})
+	}
+	for _, r := range append(append([]IPRange(nil), sc.Exclude...), carve...) {
+		exclude = append(exclude, pool.Range{Start: r.Start, End: r.End})
+	}
+	return pool.New(ranges, exclude...)
+}
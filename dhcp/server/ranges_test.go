@@ -0,0 +1,137 @@
+package server
+
+import (
+	"dhcp/lease"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestParseRanges(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+subnet: 192.168.1.0/24
+ranges:
+  - start: 192.168.1.10
+    end: 192.168.1.19
+  - 192.168.1.100-192.168.1.200
+exclude: [192.168.1.150, 192.168.1.160-192.168.1.169]
+router: 192.168.1.1
+server_ip: 192.168.1.2
+lease: 1h
+`), "yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	want := []string{"192.168.1.10-192.168.1.19", "192.168.1.100-192.168.1.200"}
+	if len(cfg.Ranges) != len(want) {
+		t.Fatalf("Expected %d ranges, got %v", len(want), cfg.Ranges)
+	}
+	for i, r := range cfg.Ranges {
+		if r.String() != want[i] {
+			t.Errorf("Expected range %s, got %s", want[i], r)
+		}
+	}
+	if len(cfg.Exclude) != 2 || cfg.Exclude[0].String() != "192.168.1.150" || cfg.Exclude[1].String() != "192.168.1.160-192.168.1.169" {
+		t.Errorf("Unexpected exclusions %v", cfg.Exclude)
+	}
+
+	if _, err := ParseConfig([]byte("exclude: [192.168.1.300]\n"), "yaml"); err == nil {
+		t.Errorf("Expected an error for an invalid exclusion")
+	}
+}
+
+func TestValidateRanges(t *testing.T) {
+	r := func(start, end string) IPRange {
+		return IPRange{Start: net.ParseIP(start), End: net.ParseIP(end)}
+	}
+	testCases := []struct {
+		name   string
+		modify func(*Config)
+		field  string
+	}{
+		{"ranges only", func(c *Config) {
+			c.Start, c.End = nil, nil
+			c.Ranges = []IPRange{r("192.168.1.10", "192.168.1.20")}
+		}, ""},
+		{"no range", func(c *Config) { c.Start, c.End = nil, nil }, "start"},
+		{"overlapping ranges", func(c *Config) {
+			c.Ranges = []IPRange{r("192.168.1.10", "192.168.1.20"), r("192.168.1.20", "192.168.1.30")}
+		}, "ranges[1]"},
+		{"overlapping start and end", func(c *Config) {
+			c.Ranges = []IPRange{r("192.168.1.200", "192.168.1.210")}
+		}, "ranges[0]"},
+		{"range outside subnet", func(c *Config) {
+			c.Ranges = []IPRange{r("192.168.1.250", "192.168.2.10")}
+		}, "ranges[0]"},
+		{"reversed range", func(c *Config) {
+			c.Ranges = []IPRange{r("192.168.1.20", "192.168.1.10")}
+		}, "ranges[0].end"},
+		{"reversed exclusion", func(c *Config) {
+			c.Exclude = []IPRange{r("192.168.1.120", "192.168.1.110")}
+		}, "exclude[0].end"},
+		{"server in excluded hole", func(c *Config) {
+			c.ServerIP = net.ParseIP("192.168.1.150")
+			c.Exclude = []IPRange{r("192.168.1.150", "192.168.1.150")}
+		}, ""},
+		{"server in second range", func(c *Config) {
+			c.Ranges = []IPRange{r("192.168.1.2", "192.168.1.9")}
+		}, "server_ip"},
+		{"scope range outside subnet", func(c *Config) {
+			c.Scopes[0].Ranges = []IPRange{r("10.10.1.1", "10.10.1.9")}
+		}, "scopes[0].ranges[0]"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newScopedTestConfig()
+			tc.modify(cfg)
+			err := cfg.Validate()
+			if tc.field == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			var fe *FieldError
+			if !errors.As(err, &fe) || fe.Field != tc.field {
+				t.Errorf("Expected error for %q, got %v", tc.field, err)
+			}
+		})
+	}
+}
+
+func TestAllocateFromRanges(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.Start, cfg.End = net.ParseIP("192.168.1.100"), net.ParseIP("192.168.1.102")
+	cfg.Ranges = []IPRange{{Start: net.ParseIP("192.168.1.10"), End: net.ParseIP("192.168.1.11")}}
+	cfg.Exclude = []IPRange{
+		{Start: net.ParseIP("192.168.1.101"), End: net.ParseIP("192.168.1.101")},
+		{Start: net.ParseIP("192.168.1.11"), End: net.ParseIP("192.168.1.11")},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	s := newTestServer(t, cfg, lease.NewMemoryStore())
+
+	got := make(map[string]bool)
+	for i := byte(0); i < 4; i++ {
+		offer := offered(s.createOffer(newDiscover(net.HardwareAddr{0x02, 0, 0, 0, 0, i}), nil))
+		if offer == nil {
+			break
+		}
+		got[offer.YIAddr.String()] = true
+	}
+	for _, ip := range []string{"192.168.1.10", "192.168.1.100", "192.168.1.102"} {
+		if !got[ip] {
+			t.Errorf("Expected %s to be offered, got %v", ip, got)
+		}
+	}
+	if len(got) != 3 {
+		t.Errorf("Expected excluded addresses to stay out of the pool, got %v", got)
+	}
+	if stats := s.scopes[0].pool.Stats(); stats.Size != 3 || stats.Free != 0 {
+		t.Errorf("Expected a fully used pool of 3, got %+v", stats)
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"dhcp/lease"
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"time"
+)
+
+var ErrNoConfigSource = errors.New("server has no configuration source to reload from")
+
+// WithConfigSource makes ReloadConfig read the configuration with load,
+// e.g. from the file the server was started with.
+func WithConfigSource(load func() (*Config, error)) Option {
+	return func(s *Server) {
+		s.loadConfig = load
+	}
+}
+
+// ReloadConfig reads the configuration from the configuration source and
+// applies it with Reload.
+func (s *Server) ReloadConfig() error {
+	if s.loadConfig == nil {
+		return ErrNoConfigSource
+	}
+	cfg, err := s.loadConfig()
+	if err != nil {
+		return err
+	}
+	return s.Reload(cfg)
+}
+
+// Reload replaces the configuration of the running server with cfg. An
+// invalid configuration is rejected and the current one stays in effect.
+// Settings that need a restart keep their current value.
+//
+// Bindings are kept. Their addresses are taken out of the new pools, and
+// bindings whose address is outside of them, or reserved for another
+// client now, are flagged as OutsidePool. Reservations added at runtime are
+// kept unless they conflict with the configured ones.
+func (s *Server) Reload(cfg *Config) error {
+	// Requests in flight finish with the old configuration first.
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if changed := cfg.keepRestartSettings(s.config); len(changed) > 0 {
+		slog.Warn("Ignoring changed settings that need a restart", "settings", changed)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	scopes, classes, err := newScopes(cfg, s.mtu)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := s.keepAdded(cfg)
+	for _, r := range added {
+		if sc := scopeContaining(scopes, r.IP); sc != nil {
+			sc.poolFor(r.IP).Take(r.IP)
+		}
+	}
+	reservations := newReservationTable(append(append([]Reservation(nil), cfg.Reservations...), added...))
+	allocated := make(map[uint32]bool)
+	outside := 0
+	for _, b := range s.bindings {
+		fromPool, ok := claimAddress(b, scopes, reservations)
+		if fromPool {
+			allocated[IPToUint32(b.IP)] = true
+		}
+		if !ok && !b.OutsidePool {
+			slog.Warn("Lease is outside the pools after reload", "ip", b.IP, "mac", b.MAC.String(), "state", b.State)
+		}
+		b.OutsidePool = !ok
+		if !ok {
+			outside++
+		}
+	}
+	now := time.Now()
+	for _, q := range s.quarantined {
+		if reservations.forIP(q.IP) != nil {
+			s.releaseQuarantined(q, now)
+		} else if sc := scopeContaining(scopes, q.IP); sc != nil {
+			sc.poolFor(q.IP).Take(q.IP)
+		}
+	}
+
+	s.config = cfg
+	s.scopes = scopes
+	s.classes = classes
+	s.reservations = reservations
+	s.added = added
+	s.allocated = allocated
+	slog.Info("Reloaded configuration", "scopes", len(scopes), "leases", len(s.bindings), "outside_pool", outside)
+	return nil
+}
+
+// keepAdded returns the reservations added at runtime that still fit in cfg.
+// The others are dropped and recorded as removed.
+func (s *Server) keepAdded(cfg *Config) []Reservation {
+	c := *cfg
+	var kept []Reservation
+	for _, r := range s.added {
+		c.Reservations = append(append(append([]Reservation(nil), cfg.Reservations...), kept...), r)
+		err := c.validateReservations()
+		if err == nil {
+			kept = append(kept, r)
+			continue
+		}
+		slog.Warn("Dropping added reservation that conflicts with the configuration", "ip", r.IP, "mac", r.MAC.String(), "error", err)
+		if err := s.store.Append(lease.Record{Op: lease.OpUnreserve, IP: r.IP, Time: time.Now()}); err != nil {
+			slog.Error("Error persisting dropped reservation", "ip", r.IP, "error", err)
+		}
+	}
+	return kept
+}
+
+// claimAddress takes the address of b out of the new pools. It reports
+// whether the address came from a pool, and whether b may keep it: it is
+// reserved for the client of b or was free in its pool.
+func claimAddress(b *binding, scopes []*scope, reservations *reservationTable) (fromPool, ok bool) {
+	if r := reservations.forIP(b.IP); r != nil {
+		return false, r.matches(b)
+	}
+	sc := scopeContaining(scopes, b.IP)
+	if sc == nil || !sc.poolFor(b.IP).Take(b.IP) {
+		return false, false
+	}
+	return true, true
+}
+
+// keepRestartSettings copies the settings that only take effect on restart
+// from old to c and returns the names of those that differed.
+func (c *Config) keepRestartSettings(old *Config) []string {
+	var changed []string
+	keepSetting(&changed, "interfaces", &c.Interfaces, old.Interfaces)
+	keepSetting(&changed, "lease_file", &c.LeaseFile, old.LeaseFile)
+	keepSetting(&changed, "ignore_client_id", &c.IgnoreClientID, old.IgnoreClientID)
+	keepSetting(&changed, "conflict_detection", &c.ConflictDetection, old.ConflictDetection)
+	keepSetting(&changed, "metrics_addr", &c.MetricsAddr, old.MetricsAddr)
+	keepSetting(&changed, "admin", &c.Admin, old.Admin)
+	keepSetting(&changed, "control_socket", &c.ControlSocket, old.ControlSocket)
+	return changed
+}
+
+func keepSetting[T any](changed *[]string, name string, setting *T, old T) {
+	if !reflect.DeepEqual(*setting, old) {
+		*changed = append(*changed, name)
+	}
+	*setting = old
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"dhcp/lease"
+	"dhcp/protocol"
+	"dhcp/transport"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func newRenewal(mac net.HardwareAddr, ip net.IP) *protocol.Packet {
+	renew := newDiscover(mac)
+	renew.Options = []byte{protocol.OptionDHCPMessageType, 1, protocol.DHCPREQUEST}
+	renew.CIAddr = ip
+	return renew
+}
+
+func TestReload(t *testing.T) {
+	s := newTestServer(t, newTestConfig(), lease.NewMemoryStore())
+	conn := s.conn.(*mockConn)
+	dropped := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	kept := net.HardwareAddr{0x02, 0, 0, 0, 0, 2}
+	droppedIP := bindLease(t, s, dropped, "")
+	keptIP := bindLease(t, s, kept, "")
+
+	cfg := newTestConfig()
+	cfg.Start = net.ParseIP("192.168.1.101")
+	cfg.End = net.ParseIP("192.168.1.150")
+	cfg.DNS = []net.IP{net.ParseIP("1.1.1.1")}
+	cfg.MetricsAddr = "127.0.0.1:9167"
+	if err := s.Reload(cfg); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if s.config.MetricsAddr != "" {
+		t.Errorf("Expected metrics_addr to keep its value until restart, got %q", s.config.MetricsAddr)
+	}
+
+	s.handleRequest(newRenewal(kept, keptIP), nil)
+	ack := conn.sentPacket()
+	if ack == nil || ack.DHCPMessageType() != protocol.DHCPACK {
+		t.Fatalf("Expected the lease inside the new range to be renewed, got %v", ack)
+	}
+	if dns := ack.GetOption(protocol.OptionDomainNameServer); !net.IP(dns).Equal(net.ParseIP("1.1.1.1")) {
+		t.Errorf("Expected the reloaded DNS server, got %v", dns)
+	}
+	if s.scopes[0].pool.Take(keptIP) {
+		t.Errorf("Expected %s to stay taken in the new pool", keptIP)
+	}
+
+	l, err := s.Lease(droppedIP)
+	if err != nil || !l.OutsidePool {
+		t.Errorf("Expected %s to be flagged outside the pool, got %+v, %v", droppedIP, l, err)
+	}
+	s.handleRequest(newRenewal(dropped, droppedIP), nil)
+	if nak := conn.sentPacket(); nak == nil || nak.DHCPMessageType() != protocol.DHCPNAK {
+		t.Errorf("Expected the renewal outside the new range to be refused, got %v", nak)
+	}
+	s.handleDiscover(newDiscover(dropped), nil)
+	if offer := conn.sentPacket(); offer == nil || offer.YIAddr.Equal(droppedIP) || offer.YIAddr.Equal(keptIP) {
+		t.Errorf("Expected a new address from the new range, got %v", offer)
+	}
+
+	if got := s.PoolStats(); got[0].Size != 50 || got[0].Used != 2 {
+		t.Errorf("Unexpected pool usage after reload %+v", got)
+	}
+}
+
+func TestReloadInvalidConfig(t *testing.T) {
+	s := newTestServer(t, newTestConfig(), lease.NewMemoryStore())
+	ip := bindLease(t, s, net.HardwareAddr{0x02, 0, 0, 0, 0, 1}, "")
+	old, scopes := s.config, s.scopes
+
+	cfg := newTestConfig()
+	cfg.End = net.ParseIP("192.168.1.50")
+	var fe *FieldError
+	if err := s.Reload(cfg); !errors.As(err, &fe) {
+		t.Fatalf("Expected a field error, got %v", err)
+	}
+	if s.config != old || s.scopes[0] != scopes[0] {
+		t.Errorf("Expected the old configuration to stay in effect")
+	}
+	if l, err := s.Lease(ip); err != nil || l.OutsidePool {
+		t.Errorf("Expected the lease to be untouched, got %+v, %v", l, err)
+	}
+}
+
+func TestReloadReservations(t *testing.T) {
+	s := newTestServer(t, newTestConfig(), lease.NewMemoryStore())
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	other := net.HardwareAddr{0x02, 0, 0, 0, 0, 2}
+	ip := bindLease(t, s, mac, "")
+	otherIP := bindLease(t, s, other, "")
+
+	// The address of mac is reserved for it, that of other for a new host.
+	cfg := newTestConfig()
+	cfg.Reservations = []Reservation{
+		{MAC: mac, IP: ip},
+		{MAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 3}, IP: otherIP},
+	}
+	if err := s.Reload(cfg); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if l, _ := s.Lease(ip); l.OutsidePool {
+		t.Errorf("Expected the lease of the reserved client to be kept")
+	}
+	if l, _ := s.Lease(otherIP); !l.OutsidePool {
+		t.Errorf("Expected the lease reserved for another client to be flagged")
+	}
+
+	// Dropping the reservations puts the addresses back under the pool.
+	if err := s.Reload(newTestConfig()); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if l, _ := s.Lease(otherIP); l.OutsidePool {
+		t.Errorf("Expected the flag to be cleared")
+	}
+	s.releaseIP(ip, lease.OpRelease)
+	if !s.scopes[0].pool.Take(ip) {
+		t.Errorf("Expected %s to go back to the pool once released", ip)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	s := newTestServer(t, newTestConfig(), lease.NewMemoryStore())
+	if err := s.ReloadConfig(); !errors.Is(err, ErrNoConfigSource) {
+		t.Errorf("Expected ErrNoConfigSource, got %v", err)
+	}
+	loaded := newTestConfig()
+	loaded.DomainName = "reloaded.example.com"
+	WithConfigSource(func() (*Config, error) { return loaded, nil })(s)
+	if err := s.ReloadConfig(); err != nil {
+		t.Fatalf("ReloadConfig: %v", err)
+	}
+	if s.scopes[0].replyOptions.DomainName != "reloaded.example.com" {
+		t.Errorf("Expected the reply options to be swapped, got %q", s.scopes[0].replyOptions.DomainName)
+	}
+}
+
+// TestReloadWhileServing is meant for the race detector: packets are read
+// and handled while the configuration is swapped.
+func TestReloadWhileServing(t *testing.T) {
+	network := transport.NewMemoryNetwork()
+	s, err := NewServer(newTestConfig(), WithTransport(network.Server()), WithLeaseStore(lease.NewMemoryStore()))
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan struct{})
+	go func() {
+		s.Serve(ctx)
+		close(served)
+	}()
+	defer func() {
+		cancel()
+		<-served
+	}()
+
+	reloaded := make(chan struct{})
+	go func() {
+		defer close(reloaded)
+		for i := 0; i < 50; i++ {
+			cfg := newTestConfig()
+			cfg.Lease = time.Duration(i+1) * time.Hour
+			cfg.RenewalTime, cfg.RebindingTime = 0, 0
+			if err := s.Reload(cfg); err != nil {
+				t.Errorf("Reload: %v", err)
+				return
+			}
+		}
+	}()
+	for i := byte(1); i <= 20; i++ {
+		discoverOn(t, network, net.HardwareAddr{0x02, 0, 0, 0, 0, i})
+	}
+	<-reloaded
+}
+
+func TestReloadKeepsAddedReservations(t *testing.T) {
+	store := lease.NewMemoryStore()
+	s := newTestServer(t, newTestConfig(), store)
+	conn := s.conn.(*mockConn)
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+	kept, dropped := net.ParseIP("192.168.1.150"), net.ParseIP("192.168.1.151")
+	if err := s.AddReservation(Reservation{MAC: mac, IP: kept, Hostname: "printer"}); err != nil {
+		t.Fatalf("AddReservation: %v", err)
+	}
+	if err := s.AddReservation(Reservation{MAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 2}, IP: dropped}); err != nil {
+		t.Fatalf("AddReservation: %v", err)
+	}
+
+	// The configuration now reserves one of the addresses for another host.
+	cfg := newTestConfig()
+	cfg.Reservations = []Reservation{{MAC: net.HardwareAddr{0x02, 0, 0, 0, 0, 3}, IP: dropped}}
+	if err := s.Reload(cfg); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	got := s.Reservations()
+	if len(got) != 2 || got[0].MAC.String() != "02:00:00:00:00:03" || !got[1].IP.Equal(kept) {
+		t.Fatalf("Expected the configured and the kept reservation, got %+v", got)
+	}
+	if s.scopes[0].pool.Take(kept) {
+		t.Errorf("Expected %s to stay out of the new pool", kept)
+	}
+	s.handleDiscover(newDiscover(mac), nil)
+	if offer := conn.sentPacket(); offer == nil || !offer.YIAddr.Equal(kept) {
+		t.Errorf("Expected the kept reservation %s to be offered, got %v", kept, offer)
+	}
+
+	records, err := lease.Load(store)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for _, rec := range records {
+		if rec.Op == lease.OpReserve && !rec.IP.Equal(kept) {
+			t.Errorf("Expected the dropped reservation of %s to be removed from the store", rec.IP)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package server
+
+import (
+	"bytes"
+	"dhcp/lease"
+	"dhcp/protocol"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+)
+
+// Reservation pins a client, identified by its MAC address, its client
+// identifier (option 61) or the switch port it is relayed from (option 82
+// circuit and remote id), to a fixed address.
+type Reservation struct {
+	MAC       net.HardwareAddr `json:"-"`
+	ClientID  []byte           `json:"-"`
+	CircuitID []byte           `json:"-"`
+	RemoteID  []byte           `json:"-"`
+	IP        net.IP           `json:"ip"`
+	Hostname  string           `json:"hostname"`
+	Options   HostOptions      `json:"options"`
+}
+
+// HostOptions override the configured reply options for a single host.
+type HostOptions struct {
+	Router     net.IP   `json:"router"`
+	DNS        []net.IP `json:"dns"`
+	DomainName string   `json:"domain_name"`
+}
+
+func (r *Reservation) UnmarshalJSON(data []byte) error {
+	type plain Reservation
+	aux := struct {
+		*plain
+		MAC       string  `json:"mac"`
+		ClientID  string  `json:"client_id"`
+		CircuitID *string `json:"circuit_id"`
+		RemoteID  *string `json:"remote_id"`
+	}{plain: (*plain)(r)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return fieldDecodeError(data, err, func(field []byte) error {
+			return new(Reservation).UnmarshalJSON(field)
+		})
+	}
+	if aux.MAC != "" {
+		mac, err := net.ParseMAC(aux.MAC)
+		if err != nil {
+			return fieldError("mac", "%v", err)
+		}
+		r.MAC = mac
+	}
+	if aux.ClientID != "" {
+		id, err := parseHexBytes(aux.ClientID)
+		if err != nil {
+			return fieldError("client_id", "%v", err)
+		}
+		r.ClientID = id
+	}
+	var err error
+	if r.CircuitID, err = parseAgentID("circuit_id", aux.CircuitID); err != nil {
+		return err
+	}
+	r.RemoteID, err = parseAgentID("remote_id", aux.RemoteID)
+	return err
+}
+
+func (r Reservation) MarshalJSON() ([]byte, error) {
+	type plain Reservation
+	aux := struct {
+		plain
+		MAC       string `json:"mac,omitempty"`
+		ClientID  string `json:"client_id,omitempty"`
+		CircuitID string `json:"circuit_id,omitempty"`
+		RemoteID  string `json:"remote_id,omitempty"`
+	}{
+		plain:     plain(r),
+		MAC:       r.MAC.String(),
+		ClientID:  formatHexBytes(r.ClientID),
+		CircuitID: formatAgentID(r.CircuitID),
+		RemoteID:  formatAgentID(r.RemoteID),
+	}
+	return json.Marshal(aux)
+}
+
+// formatHexBytes writes b the way parseHexBytes reads it, as colon
+// separated hex octets.
+func formatHexBytes(b []byte) string {
+	return net.HardwareAddr(b).String()
+}
+
+// parseHexBytes accepts hex octets either separated by ':' or '-' (as in
+// "01:00:11:22:33:44:55") or written as one contiguous string.
+func parseHexBytes(s string) ([]byte, error) {
+	if strings.ContainsAny(s, ":-") {
+		parts := strings.FieldsFunc(s, func(r rune) bool { return r == ':' || r == '-' })
+		for i, part := range parts {
+			if len(part) == 1 {
+				parts[i] = "0" + part
+			}
+		}
+		s = strings.Join(parts, "")
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hex string %q", s)
+	}
+	return b, nil
+}
+
+func (c *Config) validateReservations() error {
+	ips := make(map[uint32]bool)
+	macs := make(map[string]bool)
+	ids := make(map[string]bool)
+	ports := make(map[string]bool)
+	for i, r := range c.Reservations {
+		field := fmt.Sprintf("reservations[%d]", i)
+		if r.MAC == nil && len(r.ClientID) == 0 && r.CircuitID == nil && r.RemoteID == nil {
+			return fieldError(field, "mac, client_id, circuit_id or remote_id is required")
+		}
+		if err := validateIPv4(field+".ip", r.IP); err != nil {
+			return err
+		}
+		if !c.servesIP(r.IP) {
+			return fieldError(field+".ip", "%s is outside every configured subnet", r.IP)
+		}
+		if c.isServerIP(r.IP) {
+			return fieldError(field+".ip", "%s is the server address", r.IP)
+		}
+		if ips[IPToUint32(r.IP)] {
+			return fieldError(field+".ip", "%s is reserved more than once", r.IP)
+		}
+		ips[IPToUint32(r.IP)] = true
+		if r.MAC != nil {
+			if macs[r.MAC.String()] {
+				return fieldError(field+".mac", "%s is reserved more than once", r.MAC)
+			}
+			macs[r.MAC.String()] = true
+		}
+		if len(r.ClientID) > 0 {
+			if ids[string(r.ClientID)] {
+				return fieldError(field+".client_id", "%x is reserved more than once", r.ClientID)
+			}
+			ids[string(r.ClientID)] = true
+		}
+		if r.CircuitID != nil || r.RemoteID != nil {
+			port := fmt.Sprintf("%x/%x", r.CircuitID, r.RemoteID)
+			if ports[port] {
+				return fieldError(field+".circuit_id", "relay agent ids are reserved more than once")
+			}
+			ports[port] = true
+		}
+		if r.Options.Router != nil {
+			if err := validateIPv4(field+".options.router", r.Options.Router); err != nil {
+				return err
+			}
+		}
+		for j, ip := range r.Options.DNS {
+			if err := validateIPv4(fmt.Sprintf("%s.options.dns[%d]", field, j), ip); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type reservationTable struct {
+	list       []Reservation
+	byClientID map[string]*Reservation
+	byMAC      map[string]*Reservation
+	byIP       map[uint32]*Reservation
+	// byAgent holds reservations of switch ports in configuration order.
+	byAgent []*Reservation
+}
+
+func newReservationTable(list []Reservation) *reservationTable {
+	t := &reservationTable{
+		list:       list,
+		byClientID: make(map[string]*Reservation),
+		byMAC:      make(map[string]*Reservation),
+		byIP:       make(map[uint32]*Reservation),
+	}
+	for i := range list {
+		r := &list[i]
+		if len(r.ClientID) > 0 {
+			t.byClientID[string(r.ClientID)] = r
+		}
+		if r.MAC != nil {
+			t.byMAC[r.MAC.String()] = r
+		}
+		if r.CircuitID != nil || r.RemoteID != nil {
+			t.byAgent = append(t.byAgent, r)
+		}
+		t.byIP[IPToUint32(r.IP)] = r
+	}
+	return t
+}
+
+// lookup matches the client identifier first, then the hardware address and
+// finally the relay agent ids of the switch port.
+func (t *reservationTable) lookup(packet *protocol.Packet) *Reservation {
+	if id := packet.GetOption(protocol.OptionClientIdentifier); len(id) > 0 {
+		if r, ok := t.byClientID[string(id)]; ok {
+			return r
+		}
+	}
+	if r, ok := t.byMAC[clientHardwareAddr(packet).String()]; ok {
+		return r
+	}
+	if info, err := packet.GetRelayAgentInfoOption(); err == nil {
+		for _, r := range t.byAgent {
+			if matchesAgent(info, r.CircuitID, r.RemoteID) {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// lookupBinding is lookup for the client of a binding.
+func (t *reservationTable) lookupBinding(b *binding) *Reservation {
+	if len(b.ClientID) > 0 {
+		if r, ok := t.byClientID[string(b.ClientID)]; ok {
+			return r
+		}
+	}
+	if r, ok := t.byMAC[b.MAC.String()]; ok {
+		return r
+	}
+	for _, r := range t.byAgent {
+		if (r.CircuitID == nil || bytes.Equal(r.CircuitID, b.CircuitID)) &&
+			(r.RemoteID == nil || bytes.Equal(r.RemoteID, b.RemoteID)) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (t *reservationTable) forIP(ip net.IP) *Reservation {
+	return t.byIP[IPToUint32(ip)]
+}
+
+// clientHardwareAddr trims CHAddr to the hardware address length the client
+// announced.
+func clientHardwareAddr(packet *protocol.Packet) net.HardwareAddr {
+	if n := int(packet.HLen); n > 0 && n <= len(packet.CHAddr) {
+		return packet.CHAddr[:n]
+	}
+	return packet.CHAddr
+}
+
+// reservationFor returns the reservation of the client if its address
+// belongs to sc.
+func (s *Server) reservationFor(sc *scope, packet *protocol.Packet) *Reservation {
+	r := s.reservations.lookup(packet)
+	if r == nil || !sc.Subnet.Contains(r.IP) {
+		return nil
+	}
+	return r
+}
+
+// replyOptionsFor applies the options of the client's class and the per-host
+// overrides of r, if any, to the options of sc.
+func (s *Server) replyOptionsFor(sc *scope, packet *protocol.Packet, r *Reservation) *protocol.ReplyOptions {
+	options := sc.replyOptions
+	if cl := s.classFor(packet); cl != nil && len(cl.extra) > 0 {
+		o := *options
+		o.Extra = append(append([]protocol.Option(nil), o.Extra...), cl.extra...)
+		o.Always = append(append([]byte(nil), o.Always...), cl.always...)
+		options = &o
+	}
+	if r == nil {
+		return options
+	}
+	o := *options
+	o.Hostname = r.Hostname
+	if r.Options.Router != nil {
+		o.Router = r.Options.Router
+	}
+	if len(r.Options.DNS) > 0 {
+		o.DNS = r.Options.DNS
+	}
+	if r.Options.DomainName != "" {
+		o.DomainName = r.Options.DomainName
+	}
+	return &o
+}
+
+// reservedBinding returns the binding of the client for its reserved address,
+// creating a new one when the client has none. The new binding is not stored
+// yet. It returns nil if another client holds the address.
+func (s *Server) reservedBinding(sc *scope, packet *protocol.Packet, r *Reservation) (*binding, bool) {
+	key := s.clientKeyOf(packet)
+	if k, b := s.bindingForIP(r.IP); b != nil && k != key {
+		slog.Warn("Reserved address is bound to another client", "ip", r.IP, "client", b.MAC.String())
+		return nil, false
+	}
+	if b, ok := s.bindings[key]; ok {
+		if b.IP.Equal(r.IP) {
+			return b, false
+		}
+		s.releaseIPLocked(b.IP, lease.OpRelease)
+	}
+	return newBinding(packet, r.IP, time.Now().Add(s.config.offerTTL())), true
+}
+
+func (s *Server) createReservedOffer(sc *scope, packet *protocol.Packet, r *Reservation) *protocol.Packet {
+	b, _ := s.reservedBinding(sc, packet, r)
+	if b == nil {
+		return nil
+	}
+	if b.holdsLease(r.IP) {
+		return packet.ToOffer(r.IP, s.replyOptionsFor(sc, packet, r))
+	}
+	offered := *b
+	offered.State = LeaseOffered
+	offered.Expiration = time.Now().Add(s.config.offerTTL())
+	offered.setAgentInfo(packet)
+	offered.setHostname(packet)
+	if err := s.persist(lease.OpOffer, &offered); err != nil {
+		slog.Error("Error persisting offer", "error", err)
+		return nil
+	}
+	s.bind(s.clientKeyOf(packet), &offered)
+	slog.Info("Offering reserved IP", "ip", r.IP, "addr", packet.CHAddr.String())
+	return packet.ToOffer(r.IP, s.replyOptionsFor(sc, packet, r))
+}
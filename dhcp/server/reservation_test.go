@@ -0,0 +1,143 @@
+package server
+
+import (
+	"dhcp/lease"
+	"dhcp/protocol"
+	"net"
+	"testing"
+	"time"
+)
+
+func newDiscover(mac net.HardwareAddr, options ...byte) *protocol.Packet {
+	return &protocol.Packet{
+		Op:      protocol.BOOTREQUEST,
+		HType:   1,
+		HLen:    6,
+		XId:     1,
+		CIAddr:  net.IPv4zero,
+		SIAddr:  net.IPv4zero,
+		GIAddr:  net.IPv4zero,
+		CHAddr:  mac,
+		Options: append([]byte{protocol.OptionDHCPMessageType, 1, protocol.DHCPDISCOVER}, options...),
+	}
+}
+
+func TestReservations(t *testing.T) {
+	reservedMAC := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	clientID := []byte{0x00, 'p', 'r', 'i', 'n', 't', 'e', 'r'}
+	cfg := newTestConfig()
+	cfg.End = net.ParseIP("192.168.1.102")
+	cfg.Reservations = []Reservation{
+		{
+			MAC:      reservedMAC,
+			IP:       net.ParseIP("192.168.1.101"),
+			Hostname: "ap-1",
+			Options:  HostOptions{DNS: []net.IP{net.ParseIP("10.0.0.53")}},
+		},
+		{ClientID: clientID, IP: net.ParseIP("192.168.1.50")},
+	}
+	s := newTestServer(t, cfg, lease.NewMemoryStore())
+	conn := s.conn.(*mockConn)
+
+	s.handleDiscover(newDiscover(reservedMAC), nil)
+	offer := conn.sentPacket()
+	if offer == nil || !offer.YIAddr.Equal(net.ParseIP("192.168.1.101")) {
+		t.Fatalf("Expected offer of the reserved address, got %v", offer)
+	}
+	if got := string(offer.GetOption(protocol.OptionHostname)); got != "ap-1" {
+		t.Errorf("Expected hostname ap-1, got %q", got)
+	}
+	if got := net.IP(offer.GetOption(protocol.OptionDomainNameServer)); !got.Equal(net.ParseIP("10.0.0.53")) {
+		t.Errorf("Expected DNS override 10.0.0.53, got %s", got)
+	}
+
+	for i, want := range []string{"192.168.1.100", "192.168.1.102", ""} {
+		conn.p = nil
+		s.handleDiscover(newDiscover(net.HardwareAddr{0x00, 0x00, 0x00, 0x00, 0x01, byte(i)}), nil)
+		offer := conn.sentPacket()
+		switch {
+		case want == "" && offer != nil:
+			t.Errorf("Expected no offer once the pool is exhausted, got %s", offer.YIAddr)
+		case want != "" && (offer == nil || !offer.YIAddr.Equal(net.ParseIP(want))):
+			t.Errorf("Expected offer of %s, got %v", want, offer)
+		}
+	}
+
+	request := newDiscover(net.HardwareAddr{0x00, 0x99, 0x99, 0x99, 0x99, 0x99})
+	request.Options = nil
+	request.AddOption(protocol.OptionDHCPMessageType, []byte{protocol.DHCPREQUEST})
+	request.AddOption(protocol.OptionClientIdentifier, clientID)
+	request.AddOption(protocol.OptionRequestedIPAddress, net.ParseIP("192.168.1.50").To4())
+	s.handleRequest(request, nil)
+	ack := conn.sentPacket()
+	if ack == nil || ack.DHCPMessageType() != protocol.DHCPACK || !ack.YIAddr.Equal(net.ParseIP("192.168.1.50")) {
+		t.Errorf("Expected INIT-REBOOT ACK for the client-id reservation, got %v", ack)
+	}
+}
+
+func TestParseReservations(t *testing.T) {
+	cfg, err := ParseConfig([]byte(testYAMLConfig+`
+reservations:
+  - mac: 00:11:22:33:44:55
+    ip: 192.168.1.10
+    hostname: printer
+    options:
+      router: 192.168.1.254
+  - client_id: 01:00:11:22:33:44:66
+    ip: 192.168.1.11
+`), "yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if len(cfg.Reservations) != 2 {
+		t.Fatalf("Expected 2 reservations, got %d", len(cfg.Reservations))
+	}
+	r := cfg.Reservations[0]
+	if r.MAC.String() != "00:11:22:33:44:55" || r.Hostname != "printer" || !r.Options.Router.Equal(net.ParseIP("192.168.1.254")) {
+		t.Errorf("Unexpected reservation %+v", r)
+	}
+	if got := cfg.Reservations[1].ClientID; string(got) != "\x01\x00\x11\x22\x33\x44\x66" {
+		t.Errorf("Unexpected client id %x", got)
+	}
+
+	cfg.Reservations[1].IP = cfg.Reservations[0].IP
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("Expected duplicate reserved address to be rejected")
+	}
+}
+
+func TestRestoreReservedLeases(t *testing.T) {
+	clientID := []byte{0x00, 'p', 'r', 'i', 'n', 't', 'e', 'r'}
+	cfg := newTestConfig()
+	cfg.Reservations = []Reservation{
+		{ClientID: clientID, IP: net.ParseIP("192.168.1.50")},
+		{CircuitID: []byte("Gi1/0/9"), IP: net.ParseIP("192.168.1.51")},
+	}
+	now := time.Now()
+	ack := func(ip string, mac byte, clientID, circuitID []byte) lease.Record {
+		return lease.Record{Op: lease.OpAck, IP: net.ParseIP(ip), MAC: net.HardwareAddr{0x02, 0, 0, 0, 0, mac},
+			ClientID: clientID, CircuitID: circuitID, Expiration: now.Add(time.Hour), Time: now}
+	}
+	testCases := []struct {
+		name     string
+		rec      lease.Record
+		restored bool
+	}{
+		{"client id of the reservation", ack("192.168.1.50", 1, clientID, nil), true},
+		{"other client on a client id reservation", ack("192.168.1.50", 2, []byte{0x00, 'x'}, nil), false},
+		{"client without id on a client id reservation", ack("192.168.1.50", 3, nil, nil), false},
+		{"port of the reservation", ack("192.168.1.51", 4, nil, []byte("Gi1/0/9")), true},
+		{"other port on a port reservation", ack("192.168.1.51", 5, nil, []byte("Gi1/0/1")), false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t, cfg, lease.NewMemoryStore(tc.rec))
+			if _, b := s.bindingForIP(tc.rec.IP); (b != nil) != tc.restored {
+				t.Errorf("Expected restored %v, got %+v", tc.restored, b)
+			}
+		})
+	}
+}
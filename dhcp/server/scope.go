@@ -0,0 +1,350 @@
+package server
+
+import (
+	"dhcp/pool"
+	"dhcp/protocol"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+)
+
+const defaultScopeName = "default"
+
+// ScopeConfig describes an additional subnet served through relay agents.
+// DNS, domain name, server address, lease times and options that are not set
+// are inherited from the top-level configuration.
+//
+// ServerIP is the server identifier of the scope. Clients answer to it, so
+// a scope on another interface needs the address the server has there.
+type ScopeConfig struct {
+	Name          string         `json:"name"`
+	Subnet        net.IPNet      `json:"-"`
+	Start         net.IP         `json:"start"`
+	End           net.IP         `json:"end"`
+	Ranges        []IPRange      `json:"ranges"`
+	Exclude       []IPRange      `json:"exclude"`
+	Router        net.IP         `json:"router"`
+	DNS           []net.IP       `json:"dns"`
+	DomainName    string         `json:"domain_name"`
+	ServerIP      net.IP         `json:"server_ip"`
+	Lease         time.Duration  `json:"-"`
+	RenewalTime   time.Duration  `json:"-"`
+	RebindingTime time.Duration  `json:"-"`
+	Options       []OptionConfig `json:"options"`
+}
+
+func (sc *ScopeConfig) UnmarshalJSON(data []byte) error {
+	type plain ScopeConfig
+	aux := struct {
+		*plain
+		Subnet        string   `json:"subnet"`
+		Lease         Duration `json:"lease"`
+		RenewalTime   Duration `json:"renewal_time"`
+		RebindingTime Duration `json:"rebinding_time"`
+	}{plain: (*plain)(sc)}
+	if err := decodeStrict(data, &aux); err != nil {
+		return fieldDecodeError(data, err, func(field []byte) error {
+			return new(ScopeConfig).UnmarshalJSON(field)
+		})
+	}
+	if aux.Subnet != "" {
+		_, subnet, err := net.ParseCIDR(aux.Subnet)
+		if err != nil {
+			return fieldError("subnet", "%v", err)
+		}
+		sc.Subnet = *subnet
+	}
+	sc.Lease = time.Duration(aux.Lease)
+	sc.RenewalTime = time.Duration(aux.RenewalTime)
+	sc.RebindingTime = time.Duration(aux.RebindingTime)
+	return nil
+}
+
+// scopes returns the top-level scope followed by the configured ones, with
+// inherited settings filled in.
+func (c *Config) scopes() []ScopeConfig {
+	all := []ScopeConfig{{
+		Name:          defaultScopeName,
+		Subnet:        c.Subnet,
+		Start:         c.Start,
+		End:           c.End,
+		Ranges:        c.Ranges,
+		Exclude:       c.Exclude,
+		Router:        c.Router,
+		DNS:           c.DNS,
+		DomainName:    c.DomainName,
+		ServerIP:      c.ServerIP,
+		Lease:         c.Lease,
+		RenewalTime:   c.RenewalTime,
+		RebindingTime: c.RebindingTime,
+		Options:       c.Options,
+	}}
+	for _, sc := range c.Scopes {
+		if sc.Name == "" {
+			sc.Name = sc.Subnet.String()
+		}
+		if sc.DNS == nil {
+			sc.DNS = c.DNS
+		}
+		if sc.DomainName == "" {
+			sc.DomainName = c.DomainName
+		}
+		if sc.ServerIP == nil {
+			sc.ServerIP = c.ServerIP
+		}
+		if sc.Lease == 0 {
+			sc.Lease, sc.RenewalTime, sc.RebindingTime = c.Lease, c.RenewalTime, c.RebindingTime
+		} else {
+			if sc.RenewalTime == 0 {
+				sc.RenewalTime = sc.Lease / 2
+			}
+			if sc.RebindingTime == 0 {
+				sc.RebindingTime = sc.Lease * 7 / 8
+			}
+		}
+		sc.Options = mergeOptions(c.Options, sc.Options)
+		all = append(all, sc)
+	}
+	return all
+}
+
+// mergeOptions returns base with the options of override replacing those
+// with the same code.
+func mergeOptions(base, override []OptionConfig) []OptionConfig {
+	merged := append([]OptionConfig(nil), override...)
+	for _, o := range base {
+		found := false
+		for _, m := range override {
+			if m.Code == o.Code {
+				found = true
+				break
+			}
+		}
+		if !found {
+			merged = append(merged, o)
+		}
+	}
+	return merged
+}
+
+// validate checks a resolved scope. prefix is prepended to field names.
+func (sc *ScopeConfig) validate(prefix string) error {
+	if sc.Subnet.IP.To4() == nil || len(sc.Subnet.Mask) == 0 {
+		return fieldError(prefix+"subnet", "must be an IPv4 network in CIDR notation")
+	}
+	if err := sc.validateRanges(prefix); err != nil {
+		return err
+	}
+	if sc.Router != nil {
+		if err := validateIPv4(prefix+"router", sc.Router); err != nil {
+			return err
+		}
+		if !sc.Subnet.Contains(sc.Router) {
+			return fieldError(prefix+"router", "%s is outside subnet %s", sc.Router, &sc.Subnet)
+		}
+	}
+	if sc.ServerIP != nil {
+		if err := validateIPv4(prefix+"server_ip", sc.ServerIP); err != nil {
+			return err
+		}
+	}
+	for i, ip := range sc.DNS {
+		if err := validateIPv4(fmt.Sprintf("%sdns[%d]", prefix, i), ip); err != nil {
+			return err
+		}
+	}
+	if sc.Lease <= 0 {
+		return fieldError(prefix+"lease", "must be positive")
+	}
+	if sc.RenewalTime <= 0 {
+		return fieldError(prefix+"renewal_time", "must be positive")
+	}
+	if sc.RenewalTime >= sc.RebindingTime {
+		return fieldError(prefix+"renewal_time", "%s must be shorter than rebinding_time %s", sc.RenewalTime, sc.RebindingTime)
+	}
+	if sc.RebindingTime >= sc.Lease {
+		return fieldError(prefix+"rebinding_time", "%s must be shorter than lease %s", sc.RebindingTime, sc.Lease)
+	}
+	return validateOptions(prefix+"options", sc.Options)
+}
+
+func (c *Config) validateScopes() error {
+	all := c.scopes()
+	names := make(map[string]bool)
+	for i := range all {
+		prefix := ""
+		if i > 0 {
+			prefix = fmt.Sprintf("scopes[%d].", i-1)
+		}
+		if err := all[i].validate(prefix); err != nil {
+			return err
+		}
+		if names[all[i].Name] {
+			return fieldError(prefix+"name", "scope %q is defined more than once", all[i].Name)
+		}
+		names[all[i].Name] = true
+		for j := 0; j < i; j++ {
+			if all[j].Subnet.Contains(all[i].Subnet.IP) || all[i].Subnet.Contains(all[j].Subnet.IP) {
+				return fieldError(prefix+"subnet", "%s overlaps scope %q", &all[i].Subnet, all[j].Name)
+			}
+		}
+	}
+	for i := range all {
+		prefix := ""
+		if i > 0 {
+			prefix = fmt.Sprintf("scopes[%d].", i-1)
+		}
+		for _, sc := range all {
+			if sc.inPool(all[i].ServerIP) {
+				return fieldError(prefix+"server_ip", "%s is inside the pool of scope %q", all[i].ServerIP, sc.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// scope is the runtime state of one subnet.
+type scope struct {
+	ScopeConfig
+	pool         *pool.IPPool
+	replyOptions *protocol.ReplyOptions
+	// classes are the classes with a range inside the pool.
+	classes []*class
+}
+
+// poolFor returns the pool ip is allocated from: the pool of the class whose
+// range contains it, or the scope pool.
+func (sc *scope) poolFor(ip net.IP) *pool.IPPool {
+	for _, cl := range sc.classes {
+		if ipInRange(ip, cl.Start, cl.End) {
+			return cl.pool
+		}
+	}
+	return sc.pool
+}
+
+func newScope(sc ScopeConfig, classes []IPRange, mtu int) (*scope, error) {
+	ipPool, err := sc.newPool(classes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create IP pool for scope %q: %w", sc.Name, err)
+	}
+	extra, always := replyExtras(sc.Options)
+	return &scope{
+		ScopeConfig: sc,
+		pool:        ipPool,
+		replyOptions: &protocol.ReplyOptions{
+			LeaseTime:     sc.Lease,
+			RenewalTime:   sc.RenewalTime,
+			RebindingTime: sc.RebindingTime,
+			SubnetMask:    sc.Subnet.Mask,
+			Router:        sc.Router,
+			DNS:           sc.DNS,
+			ServerIP:      sc.ServerIP,
+			DomainName:    sc.DomainName,
+			Extra:         extra,
+			Always:        always,
+			MTU:           mtu,
+		},
+	}, nil
+}
+
+// newScopes builds the scopes and classes of cfg. Reserved addresses are
+// taken out of the pools.
+func newScopes(cfg *Config, mtu int) ([]*scope, []*class, error) {
+	var scopes []*scope
+	for _, sc := range cfg.scopes() {
+		scope, err := newScope(sc, classRanges(sc, cfg.Classes), mtu)
+		if err != nil {
+			return nil, nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+	classes, err := newClasses(scopes, cfg.Classes)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, r := range cfg.Reservations {
+		if sc := scopeContaining(scopes, r.IP); sc != nil {
+			sc.poolFor(r.IP).Take(r.IP)
+		}
+	}
+	return scopes, classes, nil
+}
+
+// scopeForIP returns the scope whose subnet contains ip, or nil.
+func (s *Server) scopeForIP(ip net.IP) *scope {
+	return scopeContaining(s.scopes, ip)
+}
+
+func scopeContaining(scopes []*scope, ip net.IP) *scope {
+	if isZeroIP(ip) {
+		return nil
+	}
+	for _, sc := range scopes {
+		if sc.Subnet.Contains(ip) {
+			return sc
+		}
+	}
+	return nil
+}
+
+// selectScope picks the subnet a request is served from. Following RFC 3527
+// and RFC 3011, the relay's link-selection sub-option overrides the
+// client's subnet selection option, which overrides giaddr. Unrelayed
+// clients that already have an address are served from its subnet, all
+// others from the first scope of the link the request arrived on. It
+// returns nil when the request is for a subnet the server does not serve.
+func (s *Server) selectScope(packet *protocol.Packet, l *link) *scope {
+	if info, err := packet.GetRelayAgentInfoOption(); err == nil {
+		if link := info.LinkSelection(); link != nil {
+			return s.scopeForIP(link)
+		}
+	}
+	if subnet, err := packet.GetIPOption(protocol.OptionSubnetSelection); err == nil {
+		return s.scopeForIP(subnet)
+	}
+	if !isZeroIP(packet.GIAddr) {
+		return s.scopeForIP(packet.GIAddr)
+	}
+	if !isZeroIP(packet.CIAddr) {
+		// An address from a scope that is not on this link is answered
+		// from the link's scope, which NAKs it.
+		if sc := s.scopeForIP(packet.CIAddr); sc == nil || l.servesScope(sc) {
+			return sc
+		}
+		return s.scopeByName(l.scopes[0])
+	}
+	if l != nil && len(l.scopes) > 0 {
+		return s.scopeByName(l.scopes[0])
+	}
+	return s.scopes[0]
+}
+
+// scopeFor is selectScope with logging for requests that are dropped.
+func (s *Server) scopeFor(packet *protocol.Packet, src *source) *scope {
+	sc := s.selectScope(packet, src.linkOf())
+	if sc == nil {
+		slog.Debug("No scope for request", "giaddr", packet.GIAddr, "ciaddr", packet.CIAddr, "addr", packet.CHAddr.String())
+	}
+	return sc
+}
+
+func (c *Config) servesIP(ip net.IP) bool {
+	for _, sc := range c.scopes() {
+		if sc.Subnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// isServerIP reports whether ip is the server address of a scope.
+func (c *Config) isServerIP(ip net.IP) bool {
+	for _, sc := range c.scopes() {
+		if ip.Equal(sc.ServerIP) {
+			return true
+		}
+	}
+	return false
+}
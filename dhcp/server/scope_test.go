@@ -0,0 +1,245 @@
+package server
+
+import (
+	"dhcp/lease"
+	"dhcp/protocol"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func newScopedTestConfig() *Config {
+	cfg := newTestConfig()
+	_, lab, _ := net.ParseCIDR("10.10.0.0/24")
+	_, office, _ := net.ParseCIDR("10.20.0.0/24")
+	cfg.Scopes = []ScopeConfig{
+		{
+			Name:   "lab",
+			Subnet: *lab,
+			Start:  net.ParseIP("10.10.0.100"),
+			End:    net.ParseIP("10.10.0.200"),
+			Router: net.ParseIP("10.10.0.1"),
+			Lease:  2 * time.Hour,
+		},
+		{
+			Subnet: *office,
+			Start:  net.ParseIP("10.20.0.100"),
+			End:    net.ParseIP("10.20.0.200"),
+			Router: net.ParseIP("10.20.0.1"),
+		},
+	}
+	return cfg
+}
+
+func TestParseScopes(t *testing.T) {
+	cfg, err := ParseConfig([]byte(testYAMLConfig+`
+scopes:
+  - name: lab
+    subnet: 10.10.0.0/24
+    start: 10.10.0.100
+    end: 10.10.0.200
+    router: 10.10.0.1
+    lease: 2h
+  - subnet: 10.20.0.0/24
+    start: 10.20.0.100
+    end: 10.20.0.200
+    dns: [10.20.0.53]
+`), "yaml")
+	if err != nil {
+		t.Fatalf("ParseConfig: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	scopes := cfg.scopes()
+	if len(scopes) != 3 {
+		t.Fatalf("Expected 3 scopes, got %d", len(scopes))
+	}
+	lab, office := scopes[1], scopes[2]
+	if lab.RenewalTime != time.Hour || lab.RebindingTime != 105*time.Minute {
+		t.Errorf("Expected lab timers derived from its lease, got %s and %s", lab.RenewalTime, lab.RebindingTime)
+	}
+	if len(lab.DNS) != 2 || lab.DomainName != "example.com" {
+		t.Errorf("Expected lab to inherit DNS and domain name, got %v and %q", lab.DNS, lab.DomainName)
+	}
+	if office.Name != "10.20.0.0/24" || office.Lease != time.Hour {
+		t.Errorf("Expected office to be named after its subnet with the default lease, got %q and %s", office.Name, office.Lease)
+	}
+	if len(office.DNS) != 1 || !office.DNS[0].Equal(net.ParseIP("10.20.0.53")) {
+		t.Errorf("Expected office DNS 10.20.0.53, got %v", office.DNS)
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	testCases := []struct {
+		name   string
+		modify func(*Config)
+		field  string
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"start outside subnet", func(c *Config) { c.Scopes[0].Start = net.ParseIP("10.11.0.100") }, "scopes[0].start"},
+		{"router outside subnet", func(c *Config) { c.Scopes[1].Router = net.ParseIP("10.10.0.1") }, "scopes[1].router"},
+		{"overlapping subnets", func(c *Config) {
+			_, n, _ := net.ParseCIDR("10.0.0.0/8")
+			c.Scopes[1].Subnet = *n
+		}, "scopes[1].subnet"},
+		{"duplicate name", func(c *Config) { c.Scopes[1].Name = "lab" }, "scopes[1].name"},
+		{"server inside scope pool", func(c *Config) { c.ServerIP = net.ParseIP("10.10.0.150") }, "server_ip"},
+		{"scope server inside another pool", func(c *Config) { c.Scopes[0].ServerIP = net.ParseIP("192.168.1.150") }, "scopes[0].server_ip"},
+		{"reservation of a scope server", func(c *Config) {
+			c.Scopes[0].ServerIP = net.ParseIP("10.10.0.2")
+			c.Reservations = []Reservation{{MAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, IP: net.ParseIP("10.10.0.2")}}
+		}, "reservations[0].ip"},
+		{"reservation outside every scope", func(c *Config) {
+			c.Reservations = []Reservation{{MAC: net.HardwareAddr{0, 1, 2, 3, 4, 5}, IP: net.ParseIP("10.30.0.5")}}
+		}, "reservations[0].ip"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newScopedTestConfig()
+			tc.modify(cfg)
+			err := cfg.Validate()
+			if tc.field == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			var fe *FieldError
+			if !errors.As(err, &fe) || fe.Field != tc.field {
+				t.Errorf("Expected error for %q, got %v", tc.field, err)
+			}
+		})
+	}
+}
+
+func TestScopeSelection(t *testing.T) {
+	s := newTestServer(t, newScopedTestConfig(), lease.NewMemoryStore())
+	conn := s.conn.(*mockConn)
+
+	relayed := func(mac byte, giaddr string, options ...protocol.Option) *protocol.Packet {
+		p := newDiscover(net.HardwareAddr{0x02, 0, 0, 0, 0, mac})
+		p.GIAddr = net.ParseIP(giaddr)
+		p.Hops = 1
+		for _, o := range options {
+			p.AddOption(o.Code, o.Data)
+		}
+		return p
+	}
+	linkSelection := protocol.RelayAgentInfo{
+		{Code: protocol.AgentCircuitID, Data: []byte("port1")},
+		{Code: protocol.AgentLinkSelection, Data: []byte{10, 20, 0, 0}},
+	}.Encode()
+
+	testCases := []struct {
+		name    string
+		packet  *protocol.Packet
+		subnet  string
+		router  string
+		dest    string
+		noReply bool
+	}{
+		{"local client", newDiscover(net.HardwareAddr{0x02, 0, 0, 0, 0, 1}), "192.168.1.0/24", "192.168.1.1", "255.255.255.255:68", false},
+		{"giaddr", relayed(2, "10.10.0.1"), "10.10.0.0/24", "10.10.0.1", "10.10.0.1:67", false},
+		{"subnet selection option", relayed(3, "10.10.0.1", protocol.Option{Code: protocol.OptionSubnetSelection, Data: []byte{10, 20, 0, 0}}),
+			"10.20.0.0/24", "10.20.0.1", "10.10.0.1:67", false},
+		{"link selection sub-option", relayed(4, "10.10.0.1", protocol.Option{Code: protocol.OptionDHCPAgentOptions, Data: linkSelection}),
+			"10.20.0.0/24", "10.20.0.1", "10.10.0.1:67", false},
+		{"unknown relay", relayed(5, "172.16.0.1"), "", "", "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn.p, conn.addr = nil, nil
+			s.handleDiscover(tc.packet, nil)
+			offer := conn.sentPacket()
+			if tc.noReply {
+				if offer != nil {
+					t.Errorf("Expected no offer, got %s", offer.YIAddr)
+				}
+				return
+			}
+			if offer == nil {
+				t.Fatalf("Expected an offer")
+			}
+			_, subnet, _ := net.ParseCIDR(tc.subnet)
+			if !subnet.Contains(offer.YIAddr) {
+				t.Errorf("Expected an address in %s, got %s", tc.subnet, offer.YIAddr)
+			}
+			if router, _ := offer.GetIPsOption(protocol.OptionRouter); len(router) != 1 || !router[0].Equal(net.ParseIP(tc.router)) {
+				t.Errorf("Expected router %s, got %v", tc.router, router)
+			}
+			if conn.addr.String() != tc.dest {
+				t.Errorf("Expected offer sent to %s, got %s", tc.dest, conn.addr)
+			}
+		})
+	}
+
+	offer := s.bindings[macKey(net.HardwareAddr{0x02, 0, 0, 0, 0, 2})]
+	request := relayed(2, "10.10.0.1")
+	request.Options = nil
+	request.AddOption(protocol.OptionDHCPMessageType, []byte{protocol.DHCPREQUEST})
+	request.AddOption(protocol.OptionRequestedIPAddress, protocol.EncodeIP(offer.IP))
+	request.AddOption(protocol.OptionServerIdentifier, protocol.EncodeIP(s.config.ServerIP))
+	request.SIAddr = s.config.ServerIP
+	s.handleRequest(request, nil)
+	ack := conn.sentPacket()
+	if ack == nil || ack.DHCPMessageType() != protocol.DHCPACK {
+		t.Fatalf("Expected a DHCPACK for the relayed request, got %v", ack)
+	}
+	if d, _ := ack.GetDurationOption(protocol.OptionIPAddressLeaseTime); d != 2*time.Hour {
+		t.Errorf("Expected the lab lease time of 2h, got %s", d)
+	}
+
+	reboot := relayed(1, "10.10.0.1")
+	reboot.Options = nil
+	reboot.AddOption(protocol.OptionDHCPMessageType, []byte{protocol.DHCPREQUEST})
+	reboot.AddOption(protocol.OptionRequestedIPAddress, []byte{192, 168, 1, 100})
+	s.handleRequest(reboot, nil)
+	nak := conn.sentPacket()
+	if nak == nil || nak.DHCPMessageType() != protocol.DHCPNAK {
+		t.Fatalf("Expected a DHCPNAK for an address from another subnet, got %v", nak)
+	}
+	if !nak.IsBroadcast() || conn.addr.String() != "10.10.0.1:67" {
+		t.Errorf("Expected a NAK with the broadcast flag sent to the relay, got flags %#x to %s", nak.Flags, conn.addr)
+	}
+}
+
+func TestScopeServerIP(t *testing.T) {
+	cfg := newScopedTestConfig()
+	cfg.Scopes[0].ServerIP = net.ParseIP("10.10.0.2")
+	s := newTestServer(t, cfg, lease.NewMemoryStore())
+	conn := s.conn.(*mockConn)
+	mac := net.HardwareAddr{0x02, 0, 0, 0, 0, 1}
+
+	discover := newDiscover(mac)
+	discover.GIAddr = net.ParseIP("10.10.0.1")
+	s.handleDiscover(discover, nil)
+	offer := conn.sentPacket()
+	if offer == nil {
+		t.Fatalf("Expected an offer")
+	}
+	if id, _ := offer.GetIPOption(protocol.OptionServerIdentifier); !id.Equal(net.ParseIP("10.10.0.2")) || !offer.SIAddr.Equal(id) {
+		t.Errorf("Expected the server identifier of the scope, got %s and siaddr %s", id, offer.SIAddr)
+	}
+
+	request := func(id net.IP) *protocol.Packet {
+		p := newDiscover(mac)
+		p.GIAddr = net.ParseIP("10.10.0.1")
+		p.SIAddr = id
+		p.Options = nil
+		p.AddOption(protocol.OptionDHCPMessageType, []byte{protocol.DHCPREQUEST})
+		p.AddOption(protocol.OptionRequestedIPAddress, protocol.EncodeIP(offer.YIAddr))
+		p.AddOption(protocol.OptionServerIdentifier, protocol.EncodeIP(id))
+		return p
+	}
+	conn.p = nil
+	s.handleRequest(request(s.config.ServerIP), nil)
+	if reply := conn.sentPacket(); reply != nil {
+		t.Errorf("Expected no reply to a request for another server identifier, got %v", reply)
+	}
+	s.handleRequest(request(net.ParseIP("10.10.0.2")), nil)
+	if ack := conn.sentPacket(); ack == nil || ack.DHCPMessageType() != protocol.DHCPACK {
+		t.Errorf("Expected a DHCPACK for the scope's server identifier, got %v", ack)
+	}
+}
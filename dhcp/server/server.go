@@ -2,7 +2,7 @@ package server
 
 import (
 	"context"
-	"dhcp/pool"
+	"dhcp/lease"
 	"dhcp/protocol"
 	"dhcp/transport"
 	"errors"
@@ -21,10 +21,11 @@ const (
 	INIT_REBOOT
 	RENEWING
 	REBINDING
-	InvalidState         = -1
-	defaultMTU           = 1500
-	defaultReadTimeout   = 500 * time.Millisecond
-	leaseCleanupInterval = 1 * time.Minute
+	InvalidState       = -1
+	defaultMTU         = 1500
+	defaultReadTimeout = 500 * time.Millisecond
+	defaultOfferTTL    = 1 * time.Minute
+	defaultLeaseFile   = "dhcpd.leases"
 )
 
 var bufPool = sync.Pool{
@@ -34,51 +35,105 @@ var bufPool = sync.Pool{
 }
 
 type Server struct {
+	// reloadMu is held for reading while a request is handled and for
+	// writing while a reload swaps the configuration, so a request sees
+	// one configuration throughout.
+	reloadMu    sync.RWMutex
 	mu          sync.RWMutex
-	bindings    map[uint64]*binding
+	bindings    map[clientKey]*binding
 	allocated   map[uint32]bool
-	ipPool      *pool.IPPool
+	scopes      []*scope
 	config      *Config
-	conn        net.PacketConn
+	conn        transport.Transport
 	wg          sync.WaitGroup
 	processChan chan *input
 	mtu         int
-
-	cachedReplyOptions *protocol.ReplyOptions
+	store       lease.Store
+
+	reservations *reservationTable
+	classes      []*class
+	// added are the reservations added at runtime, which reloads keep.
+	added []Reservation
+
+	// byIP indexes bindings by address. history and lastOwner remember the
+	// last address of clients whose lease ended, bounded to one client per
+	// address.
+	byIP       map[uint32]clientKey
+	history    map[clientKey]net.IP
+	lastOwner  map[uint32]clientKey
+	expiry     expiryQueue
+	expiryWake chan struct{}
+
+	// ignoreClientID is the ignore_client_id setting, which only changes on
+	// restart. Packets are keyed before reloadMu is held, so it is not read
+	// from config.
+	ignoreClientID bool
+
+	prober      transport.Prober
+	probes      probeCounters
+	quarantined map[uint32]*quarantine
+
+	listen Listener
+	links  linkSet
+
+	metrics metrics
+
+	// loadConfig reads the configuration for ReloadConfig.
+	loadConfig func() (*Config, error)
 }
 
 type input struct {
 	data []byte
 	addr *net.UDPAddr
+	info *transport.PacketInfo
+	link *link
+	// buf is returned to bufPool once data has been decoded.
+	buf []byte
 }
 
-type Config struct {
-	Start         net.IP
-	End           net.IP
-	Subnet        net.IPNet
-	Lease         time.Duration
-	RenewalTime   time.Duration
-	RebindingTime time.Duration
-	DNS           []net.IP
-	Router        net.IP
-	ServerIP      net.IP
-	DomainName    string
+type binding struct {
+	IP       net.IP
+	MAC      net.HardwareAddr
+	HType    byte
+	ClientID []byte
+	// State is LeaseOffered until the client requests the address.
+	State LeaseState
+	// Expiration is when the binding ends: the offer TTL after an OFFER and
+	// the lease length after an ACK.
+	Expiration time.Time
+	// CircuitID and RemoteID record the switch port the client was last
+	// relayed from.
+	CircuitID []byte
+	RemoteID  []byte
+	// Hostname is the host name the client last sent.
+	Hostname string
+	// OutsidePool is set when a reload left IP outside the pools, or
+	// reserved it for another client. The client keeps the address until
+	// the binding ends but cannot renew it.
+	OutsidePool bool
 }
 
-func (c *Config) Validate() error {
-	if c.Lease <= 0 {
-		return errors.New("lease duration must be positive")
-	}
-	if !c.Subnet.Contains(c.ServerIP) {
-		return errors.New("server IP must be within subnet")
+// setHostname records the host name option of packet, keeping the previous
+// one when the client sent none.
+func (b *binding) setHostname(packet *protocol.Packet) {
+	if name, err := packet.GetStringOption(protocol.OptionHostname); err == nil && name != "" {
+		b.Hostname = name
 	}
-	return nil
 }
 
-type binding struct {
-	IP         net.IP
-	MAC        net.HardwareAddr
-	Expiration time.Time
+// setAgentInfo records the relay agent ids of packet, keeping the previous
+// ones for unrelayed renewals.
+func (b *binding) setAgentInfo(packet *protocol.Packet) {
+	info, err := packet.GetRelayAgentInfoOption()
+	if err != nil {
+		return
+	}
+	if id := info.CircuitID(); id != nil {
+		b.CircuitID = id
+	}
+	if id := info.RemoteID(); id != nil {
+		b.RemoteID = id
+	}
 }
 
 type Offer struct {
@@ -87,50 +142,222 @@ type Offer struct {
 	ServerIP  net.IP
 }
 
-func NewServer(cfg *Config) (*Server, error) {
+type Option func(*Server)
+
+// WithProber replaces the conflict probe built from the conflict_detection
+// configuration. It is only used when conflict detection is enabled.
+func WithProber(p transport.Prober) Option {
+	return func(s *Server) {
+		s.prober = p
+	}
+}
+
+// WithLeaseStore replaces the default on-disk lease journal.
+func WithLeaseStore(store lease.Store) Option {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// WithTransport makes the server use t instead of opening its own socket.
+func WithTransport(t transport.Transport) Option {
+	return func(s *Server) {
+		s.conn = t
+	}
+}
+
+// WithConn makes the server serve on conn as a UDP transport.
+func WithConn(conn net.PacketConn) Option {
+	return WithTransport(transport.NewUDPTransport(conn))
+}
+
+func NewServer(cfg *Config, opts ...Option) (*Server, error) {
 	if err := cfg.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	ipPool, err := pool.NewIPPool(cfg.Start, cfg.End)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create IP pool: %w", err)
+	s := &Server{
+		bindings:     make(map[clientKey]*binding),
+		allocated:    make(map[uint32]bool),
+		byIP:         make(map[uint32]clientKey),
+		history:      make(map[clientKey]net.IP),
+		lastOwner:    make(map[uint32]clientKey),
+		expiryWake:   make(chan struct{}, 1),
+		quarantined:  make(map[uint32]*quarantine),
+		config:       cfg,
+		processChan:  make(chan *input, 100),
+		reservations: newReservationTable(cfg.Reservations),
+
+		ignoreClientID: cfg.IgnoreClientID,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 
-	s := &Server{
-		bindings:    make(map[uint64]*binding),
-		allocated:   make(map[uint32]bool),
-		ipPool:      ipPool,
-		config:      cfg,
-		processChan: make(chan *input, 100),
+	var err error
+	if cfg.ConflictDetection == nil {
+		s.prober = nil
+	} else if s.prober == nil {
+		if s.prober, err = newProber(cfg.ConflictDetection.Method, cfg.Interfaces); err != nil {
+			return nil, fmt.Errorf("failed to create conflict probe: %w", err)
+		}
 	}
 	s.mtu, err = transport.GetMTU()
 	if err != nil {
 		slog.Error("Error getting MTU, using default", "error", err, "defaultMTU", defaultMTU)
 		s.mtu = defaultMTU
 	}
+	if s.scopes, s.classes, err = newScopes(cfg, s.mtu); err != nil {
+		return nil, err
+	}
 
-	conn, err := transport.BuildConn()
-	if err != nil {
-		return nil, fmt.Errorf("failed to build connection: %w", err)
+	if s.store == nil {
+		path := cfg.LeaseFile
+		if path == "" {
+			path = defaultLeaseFile
+		}
+		s.store, err = lease.OpenJournal(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = s.restoreLeases(); err != nil {
+		s.store.Close()
+		return nil, fmt.Errorf("failed to restore leases: %w", err)
+	}
+
+	if len(cfg.Interfaces) > 0 {
+		if s.listen == nil {
+			s.listen = transport.ListenInterface
+		}
+		s.links.links = make(map[string]*link)
+		s.links.interfaces = cfg.Interfaces
+		if len(s.openInterfaces()) == 0 {
+			slog.Warn("None of the configured interfaces is available yet", "retry", interfaceRetryInterval)
+		}
+	} else if s.conn == nil {
+		conn, err := transport.BuildConn()
+		if err != nil {
+			s.store.Close()
+			return nil, fmt.Errorf("failed to build connection: %w", err)
+		}
+		s.conn = conn
 	}
-	s.conn = conn
 
 	return s, nil
 }
 
+// restoreLeases rebuilds bindings and the pool free list from the lease store.
+// Leases that do not fit the configuration are not restored but kept in the
+// store, so they come back once the configuration is fixed.
+func (s *Server) restoreLeases() error {
+	records, err := lease.Load(s.store)
+	if err != nil {
+		return err
+	}
+
+	restored := make(map[clientKey]lease.Record)
+	var held, skipped []lease.Record
+	for _, rec := range records {
+		if rec.Op == lease.OpReserve {
+			if s.restoreReservation(rec) {
+				held = append(held, rec)
+			}
+			continue
+		}
+		if rec.Op.Quarantined() {
+			if s.restoreQuarantine(rec) {
+				held = append(held, rec)
+			}
+			continue
+		}
+		key := s.recordKey(rec)
+		if key == "" {
+			slog.Warn("Ignoring persisted lease without client identity", "ip", rec.IP)
+			continue
+		}
+		if prev, ok := restored[key]; ok {
+			if prev.Time.After(rec.Time) {
+				continue
+			}
+			s.releaseAllocated(prev.IP)
+		}
+		b := &binding{
+			IP:         rec.IP,
+			MAC:        rec.MAC,
+			HType:      rec.HType,
+			ClientID:   rec.ClientID,
+			State:      stateOf(rec.Op),
+			Expiration: rec.Expiration,
+			CircuitID:  rec.CircuitID,
+			RemoteID:   rec.RemoteID,
+			Hostname:   rec.Hostname,
+		}
+		if r := s.reservations.forIP(rec.IP); r != nil {
+			if s.reservations.lookupBinding(b) != r {
+				slog.Warn("Ignoring persisted lease of a reserved address", "ip", rec.IP, "mac", rec.MAC.String())
+				skipped = append(skipped, rec)
+				continue
+			}
+		} else if sc := s.scopeForIP(rec.IP); sc == nil || !sc.poolFor(rec.IP).Take(rec.IP) {
+			slog.Warn("Ignoring persisted lease outside of the pool", "ip", rec.IP, "mac", rec.MAC.String())
+			skipped = append(skipped, rec)
+			continue
+		} else {
+			s.allocated[IPToUint32(rec.IP)] = true
+		}
+		restored[key] = rec
+		s.bind(key, b)
+	}
+	slog.Info("Restored leases", "count", len(s.bindings), "quarantined", len(s.quarantined), "skipped", len(skipped))
+
+	if c, ok := s.store.(lease.Compacter); ok {
+		active := make([]lease.Record, 0, len(restored)+len(held)+len(skipped))
+		active = append(append(active, held...), skipped...)
+		for _, rec := range restored {
+			active = append(active, rec)
+		}
+		if err := c.Compact(active); err != nil {
+			slog.Error("Error compacting lease store", "error", err)
+		}
+	}
+	return nil
+}
+
+// persist writes the binding state change to the lease store. It must be
+// called before any reply that depends on the change is sent.
+func (s *Server) persist(op lease.Op, b *binding) error {
+	return s.store.Append(lease.Record{
+		Op:         op,
+		IP:         b.IP,
+		MAC:        b.MAC,
+		HType:      b.HType,
+		ClientID:   b.ClientID,
+		Expiration: b.Expiration,
+		Time:       time.Now(),
+		CircuitID:  b.CircuitID,
+		RemoteID:   b.RemoteID,
+		Hostname:   b.Hostname,
+	})
+}
+
 func (s *Server) Run() {
 	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 	withCancel, cancelFunc := context.WithCancel(context.Background())
-	runAsync(withCancel, &s.wg, s.run)
+	s.run(withCancel)
 
-	select {
-	case <-sig:
-		slog.Info("Received signal, stopping server")
-		cancelFunc()
-		close(s.processChan)
+	for received := range sig {
+		if received != syscall.SIGHUP {
+			break
+		}
+		slog.Info("Received SIGHUP, reloading configuration")
+		if err := s.ReloadConfig(); err != nil {
+			slog.Error("Error reloading configuration", "error", err)
+		}
 	}
+	slog.Info("Received signal, stopping server")
+	cancelFunc()
 	slog.Info("waiting for all goroutines to finish")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -149,13 +376,45 @@ func (s *Server) Run() {
 		slog.Error("Timed out waiting for goroutines to complete")
 	}
 
+	if err := s.store.Close(); err != nil {
+		slog.Error("Error closing lease store", "error", err)
+	}
 	slog.Info("Server stopped")
 }
 
+// Serve handles requests on the server's transport until ctx is done. Run
+// does the same until the process is signalled.
+func (s *Server) Serve(ctx context.Context) {
+	s.run(ctx)
+	<-ctx.Done()
+	s.wg.Wait()
+}
+
+// run starts serving. The listeners are set up from the configuration here,
+// as a later reload replaces it.
 func (s *Server) run(ctx context.Context) {
+	s.mu.RLock()
+	cfg := s.config
+	s.mu.RUnlock()
 	runAsync(ctx, &s.wg, s.processPackets)
-	runAsync(ctx, &s.wg, s.cleanupExpiredLeases)
+	runAsync(ctx, &s.wg, s.runExpiry)
 	runAsync(ctx, &s.wg, s.startReadConn)
+	if cfg.MetricsAddr != "" {
+		runAsync(ctx, &s.wg, func(ctx context.Context) {
+			s.serveMetrics(ctx, cfg.MetricsAddr)
+		})
+	}
+	if cfg.Admin != nil {
+		admin := s.AdminHandler()
+		runAsync(ctx, &s.wg, func(ctx context.Context) {
+			serveHTTP(ctx, "admin API", cfg.Admin.Addr, admin)
+		})
+	}
+	if cfg.ControlSocket != "" {
+		runAsync(ctx, &s.wg, func(ctx context.Context) {
+			s.serveControlSocket(ctx, cfg.ControlSocket)
+		})
+	}
 }
 
 func runAsync(ctx context.Context, wg *sync.WaitGroup, f func(ctx context.Context)) {
@@ -166,194 +425,331 @@ func runAsync(ctx context.Context, wg *sync.WaitGroup, f func(ctx context.Contex
 	}()
 }
 
+// startReadConn reads requests from all links until ctx is done. It is the
+// only sender on processChan and closes it once the readers stopped.
 func (s *Server) startReadConn(ctx context.Context) {
+	var readers sync.WaitGroup
+	defer func() {
+		readers.Wait()
+		close(s.processChan)
+	}()
+	if len(s.links.interfaces) > 0 {
+		s.serveInterfaces(ctx, &readers)
+		return
+	}
+	if err := s.readLink(ctx, &link{t: s.conn}); err != nil {
+		slog.Error("Stopped reading requests", "error", err)
+	}
+}
+
+// readLink queues the requests read from l until ctx is done. It returns an
+// error when l cannot be read from anymore, e.g. because its interface went
+// away.
+func (s *Server) readLink(ctx context.Context, l *link) error {
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return nil
 		default:
-			_ = s.conn.SetReadDeadline(time.Now().Add(defaultReadTimeout))
-			buf := bufPool.Get().([]byte)
-			n, addr, err := s.conn.ReadFrom(buf)
-			if err != nil {
-				if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-					continue
-				}
-				slog.Error("error reading packet:", "error", err)
-			}
-
-			upeer, ok := addr.(*net.UDPAddr)
-			if !ok {
-				slog.Error("Invalid UDP address", "addr", addr)
+		}
+		_ = l.t.SetReadDeadline(time.Now().Add(defaultReadTimeout))
+		buf := bufPool.Get().([]byte)
+		n, info, err := l.t.ReadPacket(buf)
+		if err != nil {
+			bufPool.Put(buf)
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
 				continue
 			}
-
-			s.processChan <- &input{data: buf[:n], addr: upeer}
-			bufPool.Put(buf)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, net.ErrClosed) || errors.Is(err, syscall.ENETDOWN) || errors.Is(err, syscall.ENXIO) || errors.Is(err, syscall.ENODEV) {
+				return err
+			}
+			slog.Error("error reading packet:", "error", err, "interface", l.name)
+			continue
 		}
+
+		s.processChan <- &input{data: buf[:n], addr: info.Src, info: info, link: l, buf: buf}
 	}
 }
 
 func (s *Server) processPackets(ctx context.Context) {
 	for i := range s.processChan {
 		packet, err := protocol.Decode(i.data)
+		if i.buf != nil {
+			bufPool.Put(i.buf)
+		}
 		if err != nil {
-			slog.Error("Error decoding packet", "error", err)
+			slog.Error("Error decoding packet", "error", err, "addr", i.addr)
+			s.metrics.countDecodeError(err)
+			continue
+		}
+		if packet.Op != protocol.BOOTREQUEST || s.clientKeyOf(packet) == "" {
+			slog.Debug("Dropping packet", "op", packet.Op, "hlen", packet.HLen, "addr", i.addr)
+			s.metrics.countPacket(messageTypeName(packet.DHCPMessageType()), outcomeDrop)
 			continue
 		}
 		runAsync(ctx, &s.wg, func(ctx context.Context) {
-			slog.Info("Processing packet", "packet", packet, "addr", i.addr)
-			s.handlePacket(packet, i.addr)
+			if i.info != nil {
+				slog.Debug("Processing packet", "packet", packet, "addr", i.addr,
+					"src_mac", i.info.SrcMAC.String(), "ifindex", i.info.IfIndex, "vlan", i.info.VLAN)
+			} else {
+				slog.Debug("Processing packet", "packet", packet, "addr", i.addr)
+			}
+			s.handlePacket(packet, &source{addr: i.addr, link: i.link})
 		})
 	}
 }
 
-func (s *Server) handlePacket(packet *protocol.Packet, addr *net.UDPAddr) {
-	slog.Info("Received packet", "packet", packet, "addr", addr)
-	switch packet.DHCPMessageType() {
+func (s *Server) handlePacket(packet *protocol.Packet, src *source) {
+	if src == nil {
+		src = &source{}
+	}
+	start := time.Now()
+	msgType := packet.DHCPMessageType()
+	slog.Debug("Received packet", "packet", packet, "addr", src.udpAddr())
+	s.reloadMu.RLock()
+	switch msgType {
 	case protocol.DHCPDISCOVER:
-		s.handleDiscover(packet, addr)
+		s.handleDiscover(packet, src)
 	case protocol.DHCPREQUEST:
-		s.handleRequest(packet, addr)
+		s.handleRequest(packet, src)
 	case protocol.DHCPRELEASE:
 		s.handleRelease(packet)
 	case protocol.DHCPDECLINE:
 		s.handleDecline(packet)
+	case protocol.DHCPINFORM:
+		s.handleInform(packet, src)
 	}
+	s.reloadMu.RUnlock()
+
+	outcome := replyOutcome(src.reply)
+	if msgType == protocol.DHCPRELEASE || msgType == protocol.DHCPDECLINE {
+		outcome = outcomeNone
+	}
+	s.metrics.countPacket(messageTypeName(msgType), outcome)
+	s.metrics.observeLatency(messageTypeName(msgType), time.Since(start))
+}
+
+// sendReply sends reply to src on the link the request arrived on.
+func (s *Server) sendReply(src *source, reply *protocol.Packet) error {
+	if err := protocol.SendPacket(s.replyTransport(src), reply, src.udpAddr()); err != nil {
+		return err
+	}
+	if src != nil {
+		src.reply = reply.DHCPMessageType()
+	}
+	return nil
 }
 
-func (s *Server) handleDiscover(packet *protocol.Packet, addr *net.UDPAddr) {
-	offer := s.createOffer(packet)
+func (s *Server) handleDiscover(packet *protocol.Packet, src *source) {
+	offer, fresh := s.createOffer(packet, src)
 	if offer == nil {
 		slog.Debug("No IP available for offer")
 		return
 	}
-	err := protocol.SendPacket(s.conn, offer, addr)
+	err := s.sendReply(src, offer)
 	if err != nil {
-		s.releaseIP(offer.YIAddr)
+		// Only an address allocated for this offer goes back, an existing
+		// lease or reservation of the client stays.
+		if fresh {
+			s.releaseIP(offer.YIAddr, lease.OpRelease)
+		}
 		slog.Error("Error sending offer", "error", err)
 	}
 }
 
-func (s *Server) createOffer(packet *protocol.Packet) *protocol.Packet {
-	ip := s.ipPool.Allocate()
-	if ip == nil {
-		return nil
+// createOffer builds the offer for the client. fresh reports whether the
+// address was newly allocated from the pool for it.
+func (s *Server) createOffer(packet *protocol.Packet, src *source) (offer *protocol.Packet, fresh bool) {
+	sc := s.scopeFor(packet, src)
+	if sc == nil {
+		return nil, false
 	}
-
-	slog.Info("Allocated IP", "ip", ip)
-	offer := packet.ToOffer(ip, s.createReplyOptions())
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.bindings[MACToUint64(packet.CHAddr)] = &binding{
-		IP:         ip,
-		MAC:        packet.CHAddr,
-		Expiration: time.Now().Add(s.config.Lease),
+	if r := s.reservationFor(sc, packet); r != nil {
+		return s.createReservedOffer(sc, packet, r), false
 	}
-	s.allocated[IPToUint32(ip)] = true
-	slog.Info("Offering IP", "app", ip, "addr", packet.CHAddr.String())
-	return offer
-}
 
-func (s *Server) handleRelease(packet *protocol.Packet) {
-	s.releaseIP(packet.CIAddr)
-}
-
-func (s *Server) handleDecline(packet *protocol.Packet) {
-	s.releaseIP(packet.CIAddr)
-}
-
-func (s *Server) releaseIP(ip net.IP) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	key := s.clientKeyOf(packet)
+	for probes := 0; ; probes++ {
+		if b, ok := s.bindings[key]; ok {
+			if sc.Subnet.Contains(b.IP) && !b.OutsidePool {
+				return s.offerIP(sc, packet, b.IP, false), false
+			}
+			// The client moved to another subnet or its address is no
+			// longer part of the pool.
+			s.releaseIPLocked(b.IP, lease.OpRelease)
+		}
 
-	ipUint := IPToUint32(ip)
-	if _, exists := s.allocated[ipUint]; exists {
-		delete(s.allocated, ipUint)
-		s.ipPool.Release(ip)
-	}
+		ip := s.selectAddress(sc, packet)
+		if ip == nil {
+			// Offers nobody requested may not have been reclaimed yet.
+			s.expireDue(time.Now())
+			if ip = s.selectAddress(sc, packet); ip == nil {
+				return nil, false
+			}
+		}
+		if s.prober == nil {
+			slog.Info("Allocated IP", "ip", ip, "scope", sc.Name)
+			offer := s.offerIP(sc, packet, ip, true)
+			return offer, offer != nil
+		}
+		if probes == maxConflictProbes {
+			slog.Warn("Giving up after probing addresses in use", "count", probes, "scope", sc.Name)
+			sc.poolFor(ip).Release(ip)
+			return nil, false
+		}
 
-	for mac, b := range s.bindings {
-		if b.IP.Equal(ip) {
-			delete(s.bindings, mac)
-			break
+		// ip is out of the pool, so other clients cannot get it while the
+		// lock is released for the probe.
+		s.mu.Unlock()
+		inUse := s.probe(ip)
+		s.mu.Lock()
+		switch _, bound := s.bindings[key]; {
+		case inUse:
+			s.quarantineLocked(ip, nil, lease.OpConflict, s.config.ConflictDetection.AbandonTime)
+		case bound:
+			// Another DISCOVER of the client was answered in the meantime.
+			sc.poolFor(ip).Release(ip)
+		default:
+			slog.Info("Allocated IP", "ip", ip, "scope", sc.Name)
+			offer := s.offerIP(sc, packet, ip, true)
+			return offer, offer != nil
 		}
 	}
 }
 
-func (s *Server) setupListener() (*net.UDPConn, error) {
-	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: 67})
-	if err != nil {
-		return nil, err
+// selectAddress picks a new address for a client without a binding following
+// RFC 2131 section 4.3.1: the client's previous address, then the requested
+// address (option 50), then the next free one. Members of a class with a
+// range in sc only get addresses from that range.
+func (s *Server) selectAddress(sc *scope, packet *protocol.Packet) net.IP {
+	ipPool := sc.pool
+	if cl := s.classFor(packet); cl != nil && cl.pool != nil && sc.Subnet.Contains(cl.Start) {
+		ipPool = cl.pool
+	}
+	key := s.clientKeyOf(packet)
+	if prev, ok := s.history[key]; ok {
+		delete(s.history, key)
+		if ipPool.Take(prev) {
+			return prev
+		}
+	}
+	if requested, err := packet.GetIPOption(protocol.OptionRequestedIPAddress); err == nil {
+		if ipPool.Take(requested) {
+			return requested
+		}
 	}
-	slog.Info("Listening on", "addr", conn.LocalAddr())
-	return conn, nil
+	return ipPool.Allocate()
 }
 
-func (s *Server) cleanupExpiredLeases(ctx context.Context) {
-	ticker := time.NewTicker(leaseCleanupInterval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			now := time.Now()
-			s.mu.Lock()
-			for mac, b := range s.bindings {
-				if b.Expiration.Before(now) {
-					s.releaseIP(b.IP)
-					delete(s.bindings, mac)
-				}
-			}
-			s.mu.Unlock()
-		case <-ctx.Done():
-			slog.Info("Stopping lease cleanup")
-			return
+// offerIP binds ip to the client for the offer TTL and builds the offer.
+// fromPool reports whether ip was just taken from the pool and has to go back
+// on failure.
+func (s *Server) offerIP(sc *scope, packet *protocol.Packet, ip net.IP, fromPool bool) *protocol.Packet {
+	if b := s.bindings[s.clientKeyOf(packet)]; b != nil && b.holdsLease(ip) {
+		// A bound client that rediscovers keeps its lease.
+		return packet.ToOffer(ip, s.replyOptionsFor(sc, packet, nil))
+	}
+	b := newBinding(packet, ip, time.Now().Add(s.config.offerTTL()))
+	if err := s.persist(lease.OpOffer, b); err != nil {
+		slog.Error("Error persisting offer", "error", err)
+		if fromPool {
+			sc.poolFor(ip).Release(ip)
 		}
+		return nil
+	}
+	s.bind(s.clientKeyOf(packet), b)
+	if fromPool {
+		s.allocated[IPToUint32(ip)] = true
 	}
+	slog.Info("Offering IP", "app", ip, "addr", packet.CHAddr.String(),
+		"circuit_id", formatAgentID(b.CircuitID), "remote_id", formatAgentID(b.RemoteID))
+	return packet.ToOffer(ip, s.replyOptionsFor(sc, packet, nil))
 }
 
-func (s *Server) createReplyOptions() *protocol.ReplyOptions {
-	s.mu.RLock()
-	if s.cachedReplyOptions != nil {
-		defer s.mu.RUnlock()
-		return s.cachedReplyOptions
+// handleInform sends configuration to a client with an externally configured
+// address. No lease is checked or created.
+func (s *Server) handleInform(packet *protocol.Packet, src *source) {
+	if isZeroIP(packet.CIAddr) {
+		slog.Debug("Ignoring DHCPINFORM without client address", "addr", packet.CHAddr.String())
+		return
 	}
+	sc := s.scopeFor(packet, src)
+	if sc == nil {
+		return
+	}
+
+	s.mu.RLock()
+	r := s.reservationFor(sc, packet)
 	s.mu.RUnlock()
 
-	options := &protocol.ReplyOptions{
-		LeaseTime:     s.config.Lease,
-		RenewalTime:   s.config.RenewalTime,
-		RebindingTime: s.config.RebindingTime,
-		SubnetMask:    s.config.Subnet.Mask,
-		Router:        s.config.Router,
-		DNS:           s.config.DNS,
-		ServerIP:      s.config.ServerIP,
-		DomainName:    s.config.DomainName,
+	ack := packet.ToInformAck(s.replyOptionsFor(sc, packet, r))
+	if err := s.sendReply(src, ack); err != nil {
+		slog.Error("Error sending inform ack", "error", err)
 	}
+}
 
+// handleRelease ends the lease of ciaddr. Only the client holding the
+// address may release it.
+func (s *Server) handleRelease(packet *protocol.Packet) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.cachedReplyOptions = options
-	return options
+	key, b := s.bindingForIP(packet.CIAddr)
+	if b == nil || key != s.clientKeyOf(packet) {
+		slog.Warn("Ignoring DHCPRELEASE for an address not bound to the client", "ip", packet.CIAddr, "addr", packet.CHAddr.String())
+		return
+	}
+	s.releaseIPLocked(packet.CIAddr, lease.OpRelease)
 }
 
-func (s *Server) createAckOrNak(packet *protocol.Packet) *protocol.Packet {
+func (s *Server) releaseIP(ip net.IP, op lease.Op) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.releaseIPLocked(ip, op)
+}
+
+func (s *Server) releaseIPLocked(ip net.IP, op lease.Op) {
+	if key, b := s.bindingForIP(ip); b != nil {
+		if err := s.persist(op, b); err != nil {
+			slog.Error("Error persisting lease change", "op", op, "ip", ip, "error", err)
+		}
+		s.unbind(key)
+		s.remember(key, b.IP)
+	}
+	s.releaseAllocated(ip)
+}
 
-	b, exists := s.bindings[MACToUint64(packet.CHAddr)]
-	if !exists || !b.IP.Equal(packet.CIAddr) {
-		slog.Error("Invalid request", "packet", packet)
-		return packet.ToNak(s.createReplyOptions())
+// releaseAllocated returns ip to its pool if it was allocated from one.
+// Reserved addresses never are.
+func (s *Server) releaseAllocated(ip net.IP) {
+	ipUint := IPToUint32(ip)
+	if _, exists := s.allocated[ipUint]; exists {
+		delete(s.allocated, ipUint)
+		if sc := s.scopeForIP(ip); sc != nil {
+			sc.poolFor(ip).Release(ip)
+		}
 	}
+}
 
-	b.Expiration = time.Now().Add(s.config.Lease)
-	slog.Info("Acknowledging IP", "ip", b.IP)
-	return packet.ToAck(b.IP, s.createReplyOptions())
+func (s *Server) createAckOrNak(packet *protocol.Packet, src *source) *protocol.Packet {
+	sc := s.scopeFor(packet, src)
+	if sc == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buildResponseToBinding(sc, packet, packet.CIAddr)
 }
 
-func (s *Server) handleRequest(packet *protocol.Packet, addr *net.UDPAddr) {
+func (s *Server) handleRequest(packet *protocol.Packet, src *source) {
+	sc := s.scopeFor(packet, src)
+	if sc == nil {
+		return
+	}
 	state := determineClientState(packet)
 	var response *protocol.Packet
 	switch state {
@@ -361,25 +757,25 @@ func (s *Server) handleRequest(packet *protocol.Packet, addr *net.UDPAddr) {
 		s.mu.Lock()
 		defer s.mu.Unlock()
 
-		requestedIP := packet.GetOption(protocol.OptionRequestedIPAddress)
-		serverIdentifier := packet.GetOption(protocol.OptionServerIdentifier)
+		requestedIP, _ := packet.GetIPOption(protocol.OptionRequestedIPAddress)
+		serverIdentifier, _ := packet.GetIPOption(protocol.OptionServerIdentifier)
 
-		if !net.IP(serverIdentifier).Equal(s.config.ServerIP) {
+		if !serverIdentifier.Equal(sc.ServerIP) {
 			// Client has selected a different server
 			return
 		}
-		response = s.buildResponseToBinding(packet, requestedIP)
+		response = s.buildResponseToBinding(sc, packet, requestedIP)
 
 	case INIT_REBOOT:
 		s.mu.Lock()
 		defer s.mu.Unlock()
-		requestedIP := packet.GetOption(protocol.OptionRequestedIPAddress)
-		response = s.buildResponseToBinding(packet, requestedIP)
+		requestedIP, _ := packet.GetIPOption(protocol.OptionRequestedIPAddress)
+		response = s.buildResponseToBinding(sc, packet, requestedIP)
 
 	case RENEWING, REBINDING:
 		s.mu.Lock()
 		defer s.mu.Unlock()
-		response = s.buildResponseToBinding(packet, packet.CIAddr)
+		response = s.buildResponseToBinding(sc, packet, packet.CIAddr)
 
 	default:
 		slog.Error("Invalid DHCPREQUEST state")
@@ -389,26 +785,74 @@ func (s *Server) handleRequest(packet *protocol.Packet, addr *net.UDPAddr) {
 		slog.Error("Error creating response")
 		return
 	}
-	err := protocol.SendPacket(s.conn, response, addr)
+	err := s.sendReply(src, response)
 	if err != nil {
 		slog.Error("Error sending response", "error", err)
 	}
 }
 
-func (s *Server) buildResponseToBinding(packet *protocol.Packet, ip net.IP) (response *protocol.Packet) {
-	b, exists := s.bindings[MACToUint64(packet.CHAddr)]
+func (s *Server) buildResponseToBinding(sc *scope, packet *protocol.Packet, ip net.IP) (response *protocol.Packet) {
+	if !sc.Subnet.Contains(ip) {
+		// The client is on another network than its address belongs to.
+		return packet.ToNak(sc.replyOptions)
+	}
+	if r := s.reservationFor(sc, packet); r != nil {
+		return s.buildResponseToReservation(sc, packet, ip, r)
+	}
+
+	b, exists := s.bindings[s.clientKeyOf(packet)]
 	isWrongBind := !exists || !b.IP.Equal(ip)
-	expiredBind := b.Expiration.Before(time.Now())
+	expiredBind := exists && s.expiresAt(b).Before(time.Now())
 
 	switch {
 	case isWrongBind:
-		return packet.ToNak(s.createReplyOptions())
+		return packet.ToNak(sc.replyOptions)
 	case expiredBind:
-		return packet.ToNak(s.createReplyOptions())
+		return packet.ToNak(sc.replyOptions)
+	case b.OutsidePool:
+		// The client has to get an address from the current pool.
+		slog.Info("Refusing renewal of an address outside the pool", "ip", ip, "addr", packet.CHAddr.String())
+		return packet.ToNak(sc.replyOptions)
 	default:
-		b.Expiration = time.Now().Add(s.config.Lease)
-		return packet.ToAck(b.IP, s.createReplyOptions())
+		return s.ackBinding(sc, packet, b, nil)
+	}
+}
+
+// buildResponseToReservation acknowledges a reserved client for its reserved
+// address even when it has no binding, e.g. after an INIT-REBOOT.
+func (s *Server) buildResponseToReservation(sc *scope, packet *protocol.Packet, ip net.IP, r *Reservation) *protocol.Packet {
+	if !ip.Equal(r.IP) {
+		return packet.ToNak(sc.replyOptions)
+	}
+	b, created := s.reservedBinding(sc, packet, r)
+	if b == nil {
+		return packet.ToNak(sc.replyOptions)
+	}
+	if created {
+		s.bind(s.clientKeyOf(packet), b)
 	}
+	response := s.ackBinding(sc, packet, b, r)
+	if response == nil && created {
+		s.unbind(s.clientKeyOf(packet))
+	}
+	return response
+}
+
+// ackBinding extends b by a full lease and builds the ACK once the change is
+// persisted.
+func (s *Server) ackBinding(sc *scope, packet *protocol.Packet, b *binding, r *Reservation) *protocol.Packet {
+	renewed := *b
+	renewed.Expiration = time.Now().Add(sc.Lease)
+	renewed.State = LeaseBound
+	renewed.setAgentInfo(packet)
+	renewed.setHostname(packet)
+	if err := s.persist(lease.OpAck, &renewed); err != nil {
+		slog.Error("Error persisting ack", "ip", b.IP, "error", err)
+		return nil
+	}
+	*b = renewed
+	s.scheduleExpiry(b.IP, s.expiresAt(b))
+	return packet.ToAck(b.IP, s.replyOptionsFor(sc, packet, r))
 }
 
 func isZeroIP(ip net.IP) bool {
@@ -421,7 +865,8 @@ func determineClientState(packet *protocol.Packet) int {
 	}
 
 	emptyServer := isZeroIP(packet.SIAddr)
-	hasRequestedIP := packet.GetOption(protocol.OptionRequestedIPAddress) != nil
+	_, err := packet.GetIPOption(protocol.OptionRequestedIPAddress)
+	hasRequestedIP := err == nil
 	clientIPZero := isZeroIP(packet.CIAddr)
 	isBroadcast := packet.IsBroadcast()
 
@@ -440,9 +885,6 @@ func determineClientState(packet *protocol.Packet) int {
 		return InvalidState
 	}
 }
-func MACToUint64(mac net.HardwareAddr) uint64 {
-	return uint64(mac[0])<<40 | uint64(mac[1])<<32 | uint64(mac[2])<<24 | uint64(mac[3])<<16 | uint64(mac[4])<<8 | uint64(mac[5])
-}
 
 func IPToUint32(ip net.IP) uint32 {
 	ip = ip.To4()
@@ -1,23 +1,32 @@
 package server
 
 import (
+	"dhcp/lease"
 	"dhcp/protocol"
+	"dhcp/transport"
 	"fmt"
 	"net"
 	"testing"
 	"time"
 )
 
+// mockConn is a transport that remembers the last packet written to it.
 type mockConn struct {
-	p []byte
+	p    []byte
+	addr net.Addr
+	err  error
 }
 
-func (m *mockConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
-	return 0, nil, nil
+func (m *mockConn) ReadPacket(p []byte) (int, *transport.PacketInfo, error) {
+	return 0, nil, net.ErrClosed
 }
 
 func (m *mockConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	if m.err != nil {
+		return 0, m.err
+	}
 	m.p = p
+	m.addr = addr
 	return 0, nil
 }
 
@@ -25,22 +34,10 @@ func (m *mockConn) Close() error {
 	return nil
 }
 
-func (m *mockConn) LocalAddr() net.Addr {
-	return nil
-}
-
-func (m *mockConn) SetDeadline(t time.Time) error {
-	return nil
-}
-
 func (m *mockConn) SetReadDeadline(t time.Time) error {
 	return nil
 }
 
-func (m *mockConn) SetWriteDeadline(t time.Time) error {
-	return nil
-}
-
 func (m *mockConn) sentPacket() *protocol.Packet {
 	if m.p == nil {
 		return nil
@@ -49,8 +46,23 @@ func (m *mockConn) sentPacket() *protocol.Packet {
 	return decode
 }
 
-func TestHandleRequest(t *testing.T) {
-	cfg := &Config{
+func newTestServer(t *testing.T, cfg *Config, store lease.Store) *Server {
+	t.Helper()
+	s, err := NewServer(cfg, WithTransport(&mockConn{}), WithLeaseStore(store))
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	return s
+}
+
+// macKey is the binding key of an Ethernet client without a client
+// identifier.
+func macKey(mac net.HardwareAddr) clientKey {
+	return hardwareKey(protocol.HTypeEthernet, mac)
+}
+
+func newTestConfig() *Config {
+	return &Config{
 		Start:         net.ParseIP("192.168.1.100"),
 		End:           net.ParseIP("192.168.1.200"),
 		Subnet:        net.IPNet{IP: net.ParseIP("192.168.1.0"), Mask: net.IPv4Mask(255, 255, 255, 0)},
@@ -62,7 +74,10 @@ func TestHandleRequest(t *testing.T) {
 		ServerIP:      net.ParseIP("192.168.1.2"),
 		DomainName:    "example.com",
 	}
+}
 
+func TestHandleRequest(t *testing.T) {
+	cfg := newTestConfig()
 	mockAddr := &net.UDPAddr{IP: net.ParseIP("192.168.1.5"), Port: 68}
 
 	createPacket := func(messageType byte, clientIP net.IP, requestedIP net.IP, serverIP net.IP) *protocol.Packet {
@@ -108,11 +123,11 @@ func TestHandleRequest(t *testing.T) {
 			expectedState:  SELECTING,
 			expectResponse: true,
 			setup: func(s *Server) {
-				s.bindings[MACToUint64(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55})] = &binding{
+				s.bind(macKey(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}), &binding{
 					IP:         net.ParseIP("192.168.1.100"),
 					MAC:        net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
 					Expiration: time.Now().Add(time.Hour),
-				}
+				})
 			},
 			additionalCheck: func(t *testing.T, p *protocol.Packet) {
 				if p.DHCPMessageType() != protocol.DHCPACK {
@@ -132,11 +147,11 @@ func TestHandleRequest(t *testing.T) {
 			expectedState:  INIT_REBOOT,
 			expectResponse: true,
 			setup: func(s *Server) {
-				s.bindings[MACToUint64(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55})] = &binding{
+				s.bind(macKey(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}), &binding{
 					IP:         net.ParseIP("192.168.1.100"),
 					MAC:        net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
 					Expiration: time.Now().Add(time.Hour),
-				}
+				})
 			},
 			additionalCheck: func(t *testing.T, p *protocol.Packet) {
 				if p.DHCPMessageType() != protocol.DHCPACK {
@@ -150,11 +165,11 @@ func TestHandleRequest(t *testing.T) {
 			expectedState:  RENEWING,
 			expectResponse: true,
 			setup: func(s *Server) {
-				s.bindings[MACToUint64(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55})] = &binding{
+				s.bind(macKey(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}), &binding{
 					IP:         net.ParseIP("192.168.1.100"),
 					MAC:        net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
 					Expiration: time.Now().Add(time.Hour),
-				}
+				})
 			},
 			additionalCheck: func(t *testing.T, p *protocol.Packet) {
 				if p.DHCPMessageType() != protocol.DHCPACK {
@@ -168,11 +183,11 @@ func TestHandleRequest(t *testing.T) {
 			expectedState:  REBINDING,
 			expectResponse: true,
 			setup: func(s *Server) {
-				s.bindings[MACToUint64(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55})] = &binding{
+				s.bind(macKey(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}), &binding{
 					IP:         net.ParseIP("192.168.1.100"),
 					MAC:        net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
 					Expiration: time.Now().Add(time.Hour),
-				}
+				})
 			},
 			additionalCheck: func(t *testing.T, p *protocol.Packet) {
 				if p.DHCPMessageType() != protocol.DHCPACK {
@@ -214,11 +229,11 @@ func TestHandleRequest(t *testing.T) {
 			expectedState:  RENEWING,
 			expectResponse: true,
 			setup: func(s *Server) {
-				s.bindings[MACToUint64(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55})] = &binding{
+				s.bind(macKey(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}), &binding{
 					IP:         net.ParseIP("192.168.1.100"),
 					MAC:        net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
 					Expiration: time.Now().Add(-time.Hour),
-				}
+				})
 			},
 			additionalCheck: func(t *testing.T, p *protocol.Packet) {
 				if p.DHCPMessageType() != protocol.DHCPNAK {
@@ -232,11 +247,11 @@ func TestHandleRequest(t *testing.T) {
 			expectedState:  REBINDING,
 			expectResponse: true,
 			setup: func(s *Server) {
-				s.bindings[MACToUint64(net.HardwareAddr{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})] = &binding{
+				s.bind(macKey(net.HardwareAddr{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}), &binding{
 					IP:         net.ParseIP("192.168.1.100"),
 					MAC:        net.HardwareAddr{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
 					Expiration: time.Now().Add(time.Hour),
-				}
+				})
 			},
 			additionalCheck: func(t *testing.T, p *protocol.Packet) {
 				if p.DHCPMessageType() != protocol.DHCPNAK {
@@ -252,11 +267,12 @@ func TestHandleRequest(t *testing.T) {
 			setup: func(s *Server) {
 				for i := 100; i <= 200; i++ {
 					ip := net.ParseIP(fmt.Sprintf("192.168.1.%d", i))
-					s.bindings[uint64(i)] = &binding{
+					mac := net.HardwareAddr{0x00, 0x00, 0x00, 0x00, 0x00, byte(i)}
+					s.bind(macKey(mac), &binding{
 						IP:         ip,
-						MAC:        net.HardwareAddr{0x00, 0x00, 0x00, 0x00, 0x00, byte(i)},
+						MAC:        mac,
 						Expiration: time.Now().Add(time.Hour),
-					}
+					})
 				}
 			},
 			additionalCheck: func(t *testing.T, p *protocol.Packet) {
@@ -271,11 +287,11 @@ func TestHandleRequest(t *testing.T) {
 			expectedState:  INIT_REBOOT,
 			expectResponse: true,
 			setup: func(s *Server) {
-				s.bindings[MACToUint64(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55})] = &binding{
+				s.bind(macKey(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}), &binding{
 					IP:         net.ParseIP("192.168.1.100"), // Different from requested IP
 					MAC:        net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55},
 					Expiration: time.Now().Add(time.Hour),
-				}
+				})
 			},
 			additionalCheck: func(t *testing.T, p *protocol.Packet) {
 				if p.DHCPMessageType() != protocol.DHCPNAK {
@@ -287,15 +303,13 @@ func TestHandleRequest(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			server, _ := NewServer(cfg)
-			server.conn.Close()
-			server.conn = &mockConn{}
+			server := newTestServer(t, cfg, lease.NewMemoryStore())
 
 			if tc.setup != nil {
 				tc.setup(server)
 			}
 
-			server.handleRequest(tc.packet, mockAddr)
+			server.handleRequest(tc.packet, &source{addr: mockAddr})
 			sentPacket := server.conn.(*mockConn).sentPacket()
 
 			if tc.expectResponse && sentPacket == nil {
@@ -310,3 +324,207 @@ func TestHandleRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestRestoreLeases(t *testing.T) {
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	other := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x66}
+	now := time.Now()
+	store := lease.NewMemoryStore(
+		lease.Record{Op: lease.OpOffer, IP: net.ParseIP("192.168.1.100"), MAC: mac, Expiration: now.Add(time.Minute), Time: now},
+		lease.Record{Op: lease.OpAck, IP: net.ParseIP("192.168.1.100"), MAC: mac, Expiration: now.Add(time.Hour), Time: now},
+		lease.Record{Op: lease.OpAck, IP: net.ParseIP("192.168.1.101"), MAC: other, Expiration: now.Add(time.Hour), Time: now},
+		lease.Record{Op: lease.OpRelease, IP: net.ParseIP("192.168.1.101"), MAC: other, Time: now},
+	)
+
+	s := newTestServer(t, newTestConfig(), store)
+
+	b, ok := s.bindings[macKey(mac)]
+	if !ok || !b.IP.Equal(net.ParseIP("192.168.1.100")) {
+		t.Fatalf("Expected binding for %s to be restored, got %+v", mac, b)
+	}
+	if _, ok := s.bindings[macKey(other)]; ok {
+		t.Errorf("Released lease should not be restored")
+	}
+	if ip := s.scopes[0].pool.Allocate(); !ip.Equal(net.ParseIP("192.168.1.101")) {
+		t.Errorf("Expected pool to skip the restored address, got %s", ip)
+	}
+	if got := len(store.Records()); got != 1 {
+		t.Errorf("Expected store to be compacted to 1 record, got %d", got)
+	}
+}
+
+func TestRestoreKeepsSkippedLeases(t *testing.T) {
+	store := lease.NewMemoryStore()
+	s := newTestServer(t, newTestConfig(), store)
+	var ips []net.IP
+	for i := byte(1); i <= 3; i++ {
+		ips = append(ips, bindLease(t, s, net.HardwareAddr{0x02, 0, 0, 0, 0, i}, ""))
+	}
+
+	// A restart with a pool that misses the leased addresses skips them.
+	shrunk := newTestConfig()
+	shrunk.Start = net.ParseIP("192.168.1.150")
+	s = newTestServer(t, shrunk, store)
+	if len(s.bindings) != 0 {
+		t.Fatalf("Expected the leases outside the pool to be skipped, got %d", len(s.bindings))
+	}
+
+	s = newTestServer(t, newTestConfig(), store)
+	for i, ip := range ips {
+		if b, ok := s.bindings[macKey(net.HardwareAddr{0x02, 0, 0, 0, 0, byte(i + 1)})]; !ok || !b.IP.Equal(ip) {
+			t.Errorf("Expected the lease of %s to come back with the original pool, got %+v", ip, b)
+		}
+	}
+}
+
+func TestLeaseChangesArePersisted(t *testing.T) {
+	store := lease.NewMemoryStore()
+	s := newTestServer(t, newTestConfig(), store)
+	mac := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	discover := &protocol.Packet{
+		Op:      protocol.BOOTREQUEST,
+		HType:   1,
+		HLen:    6,
+		XId:     1,
+		CHAddr:  mac,
+		Options: []byte{protocol.OptionDHCPMessageType, 1, protocol.DHCPDISCOVER},
+	}
+
+	s.handleDiscover(discover, nil)
+	offer := s.conn.(*mockConn).sentPacket()
+	if offer == nil {
+		t.Fatalf("Expected an offer")
+	}
+
+	request := &protocol.Packet{
+		Op:     protocol.BOOTREQUEST,
+		HType:  1,
+		HLen:   6,
+		XId:    2,
+		CHAddr: mac,
+		CIAddr: net.IPv4zero,
+		SIAddr: net.IPv4zero,
+	}
+	request.AddOption(protocol.OptionDHCPMessageType, []byte{protocol.DHCPREQUEST})
+	request.AddOption(protocol.OptionRequestedIPAddress, offer.YIAddr.To4())
+	s.handleRequest(request, nil)
+	s.releaseIP(offer.YIAddr, lease.OpRelease)
+
+	var ops []lease.Op
+	for _, rec := range store.Records() {
+		if !rec.IP.Equal(offer.YIAddr) {
+			t.Errorf("Unexpected record for %s", rec.IP)
+		}
+		ops = append(ops, rec.Op)
+	}
+	want := []lease.Op{lease.OpOffer, lease.OpAck, lease.OpRelease}
+	if fmt.Sprint(ops) != fmt.Sprint(want) {
+		t.Errorf("Expected records %v, got %v", want, ops)
+	}
+}
+
+func TestDiscoverAddressSelection(t *testing.T) {
+	s := newTestServer(t, newTestConfig(), lease.NewMemoryStore())
+	conn := s.conn.(*mockConn)
+	macA := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	macB := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x66}
+	requested := func(ip string) []byte {
+		return append([]byte{protocol.OptionRequestedIPAddress, 4}, net.ParseIP(ip).To4()...)
+	}
+	offer := func(p *protocol.Packet) net.IP {
+		t.Helper()
+		conn.p = nil
+		s.handleDiscover(p, nil)
+		sent := conn.sentPacket()
+		if sent == nil {
+			t.Fatalf("Expected an offer")
+		}
+		return sent.YIAddr
+	}
+
+	if ip := offer(newDiscover(macA, requested("192.168.1.150")...)); !ip.Equal(net.ParseIP("192.168.1.150")) {
+		t.Errorf("Expected requested address 192.168.1.150, got %s", ip)
+	}
+	if ip := offer(newDiscover(macA)); !ip.Equal(net.ParseIP("192.168.1.150")) {
+		t.Errorf("Expected rediscover to keep 192.168.1.150, got %s", ip)
+	}
+	if ip := offer(newDiscover(macB, requested("192.168.1.150")...)); !ip.Equal(net.ParseIP("192.168.1.100")) {
+		t.Errorf("Expected requested address in use to be skipped, got %s", ip)
+	}
+
+	s.releaseIP(net.ParseIP("192.168.1.150"), lease.OpRelease)
+	if ip := offer(newDiscover(macA, requested("192.168.1.170")...)); !ip.Equal(net.ParseIP("192.168.1.150")) {
+		t.Errorf("Expected previous address 192.168.1.150 to be preferred, got %s", ip)
+	}
+	if got := len(s.bindings); got != 2 {
+		t.Errorf("Expected 2 bindings, got %d", got)
+	}
+}
+
+func TestInform(t *testing.T) {
+	reservedMAC := net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}
+	cfg := newTestConfig()
+	cfg.Reservations = []Reservation{{
+		MAC:     reservedMAC,
+		IP:      net.ParseIP("192.168.1.150"),
+		Options: HostOptions{DNS: []net.IP{net.ParseIP("10.0.0.53")}},
+	}}
+	store := lease.NewMemoryStore()
+	s := newTestServer(t, cfg, store)
+
+	inform := func(mac net.HardwareAddr, ciaddr net.IP) *protocol.Packet {
+		p := &protocol.Packet{
+			Op:     protocol.BOOTREQUEST,
+			HType:  1,
+			HLen:   6,
+			XId:    7,
+			Flags:  0x8000,
+			CIAddr: ciaddr,
+			GIAddr: net.IPv4zero,
+			CHAddr: mac,
+		}
+		p.AddOption(protocol.OptionDHCPMessageType, []byte{protocol.DHCPINFORM})
+		p.AddOption(protocol.OptionParameterRequestList, []byte{
+			protocol.OptionSubnetMask, protocol.OptionRouter, protocol.OptionDomainNameServer,
+			protocol.OptionDomainName, protocol.OptionIPAddressLeaseTime,
+		})
+		return p
+	}
+
+	conn := s.conn.(*mockConn)
+	s.handlePacket(inform(net.HardwareAddr{0x02, 0, 0, 0, 0, 1}, net.ParseIP("192.168.1.50")), nil)
+	ack := conn.sentPacket()
+	if ack == nil || ack.DHCPMessageType() != protocol.DHCPACK {
+		t.Fatalf("Expected a DHCPACK, got %v", ack)
+	}
+	if !ack.YIAddr.IsUnspecified() || !ack.CIAddr.Equal(net.ParseIP("192.168.1.50")) {
+		t.Errorf("Expected yiaddr 0.0.0.0 and ciaddr 192.168.1.50, got %s and %s", ack.YIAddr, ack.CIAddr)
+	}
+	for _, code := range []byte{protocol.OptionIPAddressLeaseTime, protocol.OptionRenewalTime, protocol.OptionRebindingTime} {
+		if ack.GetOption(code) != nil {
+			t.Errorf("Expected no option %d in the ack", code)
+		}
+	}
+	if name, _ := ack.GetStringOption(protocol.OptionDomainName); name != "example.com" {
+		t.Errorf("Expected domain name example.com, got %q", name)
+	}
+	if dst := conn.addr.String(); dst != "192.168.1.50:68" {
+		t.Errorf("Expected ack unicast to 192.168.1.50:68, got %s", dst)
+	}
+	if len(s.bindings) != 0 || len(store.Records()) != 0 {
+		t.Errorf("Expected no lease for an inform, got %d bindings and %d records", len(s.bindings), len(store.Records()))
+	}
+
+	s.handlePacket(inform(reservedMAC, net.ParseIP("192.168.1.60")), nil)
+	if dns, _ := conn.sentPacket().GetIPsOption(protocol.OptionDomainNameServer); len(dns) != 1 || !dns[0].Equal(net.ParseIP("10.0.0.53")) {
+		t.Errorf("Expected the reserved host's DNS server, got %v", dns)
+	}
+
+	for _, ciaddr := range []net.IP{net.IPv4zero, net.ParseIP("10.9.9.9")} {
+		conn.p = nil
+		s.handlePacket(inform(reservedMAC, ciaddr), nil)
+		if conn.p != nil {
+			t.Errorf("Expected no answer to an inform from %s", ciaddr)
+		}
+	}
+}
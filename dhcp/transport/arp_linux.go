@@ -0,0 +1,154 @@
+//go:build linux
+
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	arpRequest = 1
+	arpReply   = 2
+)
+
+// ARPProber sends ARP probes (RFC 5227) on the interface attached to the
+// probed address. ARP only reaches hosts on the interfaces' own links, other
+// addresses, e.g. in relayed subnets, are probed with fallback.
+type ARPProber struct {
+	// names are the served interfaces, looked up on every probe as they
+	// may come and go. iface is the default interface when none are
+	// configured.
+	names    []string
+	iface    *net.Interface
+	fallback Prober
+}
+
+// NewARPProber probes on the named interfaces, or on the default interface
+// when no names are given.
+func NewARPProber(fallback Prober, ifaces ...string) (*ARPProber, error) {
+	if len(ifaces) > 0 {
+		return &ARPProber{names: ifaces, fallback: fallback}, nil
+	}
+	iface, err := getInterface()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interface: %w", err)
+	}
+	return &ARPProber{iface: iface, fallback: fallback}, nil
+}
+
+func (p *ARPProber) Probe(ctx context.Context, ip net.IP) (bool, error) {
+	iface := p.interfaceFor(ip)
+	if iface == nil {
+		return p.fallback.Probe(ctx, ip)
+	}
+
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_DGRAM, int(htons(syscall.ETH_P_ARP)))
+	if err != nil {
+		return false, fmt.Errorf("failed to create ARP socket: %w", err)
+	}
+	defer syscall.Close(fd)
+	addr := &syscall.SockaddrLinklayer{Protocol: htons(syscall.ETH_P_ARP), Ifindex: iface.Index}
+	if err := syscall.Bind(fd, addr); err != nil {
+		return false, fmt.Errorf("failed to bind ARP socket: %w", err)
+	}
+
+	addr.Halen = 6
+	copy(addr.Addr[:], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	if err := syscall.Sendto(fd, arpProbe(iface.HardwareAddr, ip), 0, addr); err != nil {
+		return false, fmt.Errorf("failed to send ARP probe: %w", err)
+	}
+
+	deadline, _ := ctx.Deadline()
+	buf := make([]byte, 128)
+	for {
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return false, nil
+		}
+		tv := syscall.NsecToTimeval(wait.Nanoseconds())
+		if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &tv); err != nil {
+			return false, fmt.Errorf("failed to set ARP read timeout: %w", err)
+		}
+		n, from, err := syscall.Recvfrom(fd, buf, 0)
+		if err != nil {
+			if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			return false, fmt.Errorf("failed to read ARP reply: %w", err)
+		}
+		// Packet sockets also see our own probe going out.
+		if ll, ok := from.(*syscall.SockaddrLinklayer); ok && ll.Pkttype == syscall.PACKET_OUTGOING {
+			continue
+		}
+		if claimsAddress(buf[:n], ip) {
+			return true, nil
+		}
+	}
+}
+
+// interfaceFor returns the interface with an address on the network of ip,
+// or nil.
+func (p *ARPProber) interfaceFor(ip net.IP) *net.Interface {
+	ifaces := []*net.Interface{p.iface}
+	if p.names != nil {
+		ifaces = ifaces[:0]
+		for _, name := range p.names {
+			if iface, err := net.InterfaceByName(name); err == nil {
+				ifaces = append(ifaces, iface)
+			}
+		}
+	}
+	for _, iface := range ifaces {
+		if onLink(iface, ip) {
+			return iface
+		}
+	}
+	return nil
+}
+
+func onLink(iface *net.Interface, ip net.IP) bool {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// arpProbe builds an ARP request for ip with an all-zero sender address, so
+// the probe does not update other hosts' ARP caches.
+func arpProbe(mac net.HardwareAddr, ip net.IP) []byte {
+	b := make([]byte, 28)
+	binary.BigEndian.PutUint16(b[0:], 1)
+	binary.BigEndian.PutUint16(b[2:], syscall.ETH_P_IP)
+	b[4], b[5] = 6, 4
+	binary.BigEndian.PutUint16(b[6:], arpRequest)
+	copy(b[8:14], mac)
+	copy(b[24:28], ip.To4())
+	return b
+}
+
+// claimsAddress reports whether msg is an ARP reply from ip, or a request of
+// another host using or probing for it.
+func claimsAddress(msg []byte, ip net.IP) bool {
+	if len(msg) < 28 || msg[4] != 6 || msg[5] != 4 {
+		return false
+	}
+	switch binary.BigEndian.Uint16(msg[6:]) {
+	case arpReply:
+		return net.IP(msg[14:18]).Equal(ip)
+	case arpRequest:
+		return net.IP(msg[14:18]).Equal(ip) || (net.IP(msg[14:18]).Equal(net.IPv4zero) && net.IP(msg[24:28]).Equal(ip))
+	}
+	return false
+}
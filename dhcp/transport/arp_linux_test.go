@@ -0,0 +1,24 @@
+//go:build linux
+
+package transport
+
+import (
+	"net"
+	"testing"
+)
+
+func TestARPProberInterfaceFor(t *testing.T) {
+	if _, err := net.InterfaceByName("lo"); err != nil {
+		t.Skipf("No loopback interface: %v", err)
+	}
+	p, err := NewARPProber(NewICMPProber(), "missing0", "lo")
+	if err != nil {
+		t.Fatalf("NewARPProber: %v", err)
+	}
+	if iface := p.interfaceFor(net.ParseIP("127.0.0.5")); iface == nil || iface.Name != "lo" {
+		t.Errorf("Expected lo for a loopback address, got %v", iface)
+	}
+	if iface := p.interfaceFor(net.ParseIP("198.51.100.7")); iface != nil {
+		t.Errorf("Expected no interface for an address off all links, got %s", iface.Name)
+	}
+}
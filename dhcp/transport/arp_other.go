@@ -0,0 +1,9 @@
+//go:build !linux
+
+package transport
+
+import "errors"
+
+func NewARPProber(fallback Prober, ifaces ...string) (Prober, error) {
+	return nil, errors.New("ARP probing is only supported on Linux")
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !windows
+
+package transport
+
+import "log/slog"
+
+// BuildConn returns a UDP transport on port 67. Without packet sockets,
+// replies to clients without an address are broadcast.
+func BuildConn() (*UDPTransport, error) {
+	t, err := ListenUDP(":67")
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Listening on", "addr", t.LocalAddr())
+	return t, nil
+}
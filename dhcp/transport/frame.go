@@ -0,0 +1,138 @@
+package transport
+
+import (
+	"dhcp/protocol"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeVLAN = 0x8100
+	udpProtocol   = 17
+	serverPort    = 67
+	clientPort    = 68
+)
+
+var errNotDHCP = errors.New("not a DHCP request")
+
+// parseFrame returns the DHCP message in an Ethernet frame holding an IPv4
+// UDP datagram for port. A frame with an 802.1Q tag has its VLAN
+// id recorded in info. The UDP checksum is not checked when checkUDP is
+// false, for frames whose checksum the kernel left to the hardware.
+func parseFrame(frame []byte, info *PacketInfo, port uint16, checkUDP bool) ([]byte, error) {
+	if len(frame) < 14 {
+		return nil, fmt.Errorf("%w: short frame", errNotDHCP)
+	}
+	info.SrcMAC = net.HardwareAddr(append([]byte(nil), frame[6:12]...))
+	etherType, ip := binary.BigEndian.Uint16(frame[12:]), frame[14:]
+	if etherType == etherTypeVLAN {
+		if len(frame) < 18 {
+			return nil, fmt.Errorf("%w: short VLAN tag", errNotDHCP)
+		}
+		info.VLAN = binary.BigEndian.Uint16(frame[14:]) & 0x0fff
+		etherType, ip = binary.BigEndian.Uint16(frame[16:]), frame[18:]
+	}
+	if etherType != etherTypeIPv4 {
+		return nil, fmt.Errorf("%w: ethertype %#04x", errNotDHCP, etherType)
+	}
+
+	if len(ip) < 20 || ip[0]>>4 != 4 {
+		return nil, fmt.Errorf("%w: not IPv4", errNotDHCP)
+	}
+	headerLen, totalLen := int(ip[0]&0x0f)*4, int(binary.BigEndian.Uint16(ip[2:]))
+	if headerLen < 20 || totalLen < headerLen+8 || totalLen > len(ip) {
+		return nil, fmt.Errorf("%w: invalid IPv4 length", errNotDHCP)
+	}
+	ip = ip[:totalLen]
+	if protocol.Checksum(ip[:headerLen]) != 0 {
+		return nil, errors.New("invalid IPv4 header checksum")
+	}
+	if ip[9] != udpProtocol || binary.BigEndian.Uint16(ip[6:])&0x1fff != 0 || ip[6]&0x20 != 0 {
+		return nil, fmt.Errorf("%w: not an unfragmented UDP datagram", errNotDHCP)
+	}
+
+	udp := ip[headerLen:]
+	udpLen := int(binary.BigEndian.Uint16(udp[4:]))
+	if udpLen < 8 || udpLen > len(udp) {
+		return nil, fmt.Errorf("%w: invalid UDP length", errNotDHCP)
+	}
+	udp = udp[:udpLen]
+	if binary.BigEndian.Uint16(udp[2:]) != port {
+		return nil, fmt.Errorf("%w: port %d", errNotDHCP, binary.BigEndian.Uint16(udp[2:]))
+	}
+	if checkUDP && binary.BigEndian.Uint16(udp[6:]) != 0 && udpChecksum(ip[12:16], ip[16:20], udp) != 0 {
+		return nil, errors.New("invalid UDP checksum")
+	}
+
+	info.Src = &net.UDPAddr{
+		IP:   net.IP(append([]byte(nil), ip[12:16]...)),
+		Port: int(binary.BigEndian.Uint16(udp[0:])),
+	}
+	return udp[8:], nil
+}
+
+// udpChecksum sums the UDP datagram with its IPv4 pseudo header. It is zero
+// for a datagram with a valid checksum.
+func udpChecksum(source, destination, udp []byte) uint16 {
+	pseudo := make([]byte, 12, 12+len(udp))
+	copy(pseudo[0:4], source)
+	copy(pseudo[4:8], destination)
+	pseudo[9] = udpProtocol
+	binary.BigEndian.PutUint16(pseudo[10:], uint16(len(udp)))
+	return protocol.Checksum(append(pseudo, udp...))
+}
+
+// bpfInstruction is a classic BPF instruction (struct sock_filter).
+type bpfInstruction struct {
+	Code   uint16
+	Jt, Jf uint8
+	K      uint32
+}
+
+const (
+	bpfLdhAbs    = 0x28 // A = frame[k:k+2]
+	bpfLdbAbs    = 0x30 // A = frame[k]
+	bpfLdhInd    = 0x48 // A = frame[X+k:X+k+2]
+	bpfLdxbMsh   = 0xb1 // X = 4 * (frame[k] & 0xf)
+	bpfJeqK      = 0x15
+	bpfJsetK     = 0x45
+	bpfRetK      = 0x06
+	bpfAcceptAll = 0x40000
+)
+
+// dhcpFilter is a BPF program accepting unfragmented IPv4 UDP datagrams to
+// the server port, untagged or with one 802.1Q tag.
+func dhcpFilter() []bpfInstruction {
+	const accept, drop = 19, 20
+	// udpTo67 checks the IPv4 header at offset base. Its first instruction
+	// is at index at.
+	udpTo67 := func(at int, base uint32) []bpfInstruction {
+		return []bpfInstruction{
+			{Code: bpfLdbAbs, K: base + 9},
+			{Code: bpfJeqK, Jf: uint8(drop - (at + 2)), K: udpProtocol},
+			{Code: bpfLdhAbs, K: base + 6},
+			{Code: bpfJsetK, Jt: uint8(drop - (at + 4)), K: 0x1fff},
+			{Code: bpfLdxbMsh, K: base},
+			{Code: bpfLdhInd, K: base + 2},
+			{Code: bpfJeqK, Jt: uint8(accept - (at + 7)), Jf: uint8(drop - (at + 7)), K: serverPort},
+		}
+	}
+	prog := []bpfInstruction{
+		{Code: bpfLdhAbs, K: 12},
+		{Code: bpfJeqK, Jf: 7, K: etherTypeIPv4},
+	}
+	prog = append(prog, udpTo67(2, 14)...)
+	prog = append(prog,
+		bpfInstruction{Code: bpfJeqK, Jf: drop - 10, K: etherTypeVLAN},
+		bpfInstruction{Code: bpfLdhAbs, K: 16},
+		bpfInstruction{Code: bpfJeqK, Jf: drop - 12, K: etherTypeIPv4},
+	)
+	prog = append(prog, udpTo67(12, 18)...)
+	return append(prog,
+		bpfInstruction{Code: bpfRetK, K: bpfAcceptAll},
+		bpfInstruction{Code: bpfRetK},
+	)
+}
@@ -0,0 +1,159 @@
+package transport
+
+import (
+	"dhcp/protocol"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+)
+
+var testClientMAC = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x42}
+
+func testFrame(port uint16) []byte {
+	e := &protocol.Ethernet{
+		SourcePort:      68,
+		DestinationPort: port,
+		SourceIP:        net.IPv4zero,
+		DestinationIP:   net.IPv4bcast,
+		SourceMAC:       testClientMAC,
+		DestinationMAC:  net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		Payload:         []byte("dhcp message"),
+	}
+	return e.Bytes()
+}
+
+// tagged inserts an 802.1Q tag for vlan into frame.
+func tagged(frame []byte, vlan uint16) []byte {
+	tag := []byte{0x81, 0x00, byte(vlan >> 8), byte(vlan)}
+	return append(append(append([]byte(nil), frame[:12]...), tag...), frame[12:]...)
+}
+
+func TestParseFrame(t *testing.T) {
+	corrupt := func(offset int) []byte {
+		frame := testFrame(serverPort)
+		frame[offset] ^= 0xff
+		return frame
+	}
+	testCases := []struct {
+		name     string
+		frame    []byte
+		checkUDP bool
+		vlan     uint16
+		err      bool
+	}{
+		{name: "valid", frame: testFrame(serverPort), checkUDP: true},
+		{name: "tagged", frame: tagged(testFrame(serverPort), 42), checkUDP: true, vlan: 42},
+		{name: "client port", frame: testFrame(68), checkUDP: true, err: true},
+		{name: "ip checksum", frame: corrupt(14 + 10), checkUDP: true, err: true},
+		{name: "udp checksum", frame: corrupt(14 + 20 + 6), checkUDP: true, err: true},
+		{name: "udp checksum offloaded", frame: corrupt(14 + 20 + 6)},
+		{name: "fragment", frame: corrupt(14 + 7), checkUDP: true, err: true},
+		{name: "arp", frame: func() []byte {
+			frame := testFrame(serverPort)
+			binary.BigEndian.PutUint16(frame[12:], 0x0806)
+			return frame
+		}(), checkUDP: true, err: true},
+		{name: "truncated", frame: testFrame(serverPort)[:50], checkUDP: true, err: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			info := &PacketInfo{}
+			payload, err := parseFrame(tc.frame, info, serverPort, tc.checkUDP)
+			if tc.err {
+				if err == nil {
+					t.Errorf("Expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(payload) != "dhcp message" {
+				t.Errorf("Unexpected payload %q", payload)
+			}
+			if info.SrcMAC.String() != testClientMAC.String() || info.VLAN != tc.vlan {
+				t.Errorf("Expected %s on VLAN %d, got %s on VLAN %d", testClientMAC, tc.vlan, info.SrcMAC, info.VLAN)
+			}
+			if !info.Src.IP.Equal(net.IPv4zero) || info.Src.Port != 68 {
+				t.Errorf("Expected source 0.0.0.0:68, got %s", info.Src)
+			}
+		})
+	}
+	if _, err := parseFrame(testFrame(68), &PacketInfo{}, serverPort, true); !errors.Is(err, errNotDHCP) {
+		t.Errorf("Expected errNotDHCP, got %v", err)
+	}
+}
+
+// runBPF interprets the subset of classic BPF used by dhcpFilter.
+func runBPF(t *testing.T, prog []bpfInstruction, frame []byte) uint32 {
+	t.Helper()
+	var a, x uint32
+	load := func(off uint32, size int) (uint32, bool) {
+		if int(off)+size > len(frame) {
+			return 0, false
+		}
+		if size == 1 {
+			return uint32(frame[off]), true
+		}
+		return uint32(binary.BigEndian.Uint16(frame[off:])), true
+	}
+	for pc := 0; pc < len(prog); pc++ {
+		ins := prog[pc]
+		var ok = true
+		switch ins.Code {
+		case bpfLdhAbs:
+			a, ok = load(ins.K, 2)
+		case bpfLdbAbs:
+			a, ok = load(ins.K, 1)
+		case bpfLdhInd:
+			a, ok = load(x+ins.K, 2)
+		case bpfLdxbMsh:
+			x, ok = load(ins.K, 1)
+			x = 4 * (x & 0xf)
+		case bpfJeqK:
+			if a == ins.K {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case bpfJsetK:
+			if a&ins.K != 0 {
+				pc += int(ins.Jt)
+			} else {
+				pc += int(ins.Jf)
+			}
+		case bpfRetK:
+			return ins.K
+		default:
+			t.Fatalf("Unexpected BPF code %#x", ins.Code)
+		}
+		if !ok {
+			return 0
+		}
+	}
+	t.Fatalf("BPF program ran past its end")
+	return 0
+}
+
+func TestDHCPFilter(t *testing.T) {
+	fragment := testFrame(serverPort)
+	fragment[14+7] = 1
+	testCases := []struct {
+		name   string
+		frame  []byte
+		accept bool
+	}{
+		{"request", testFrame(serverPort), true},
+		{"tagged request", tagged(testFrame(serverPort), 7), true},
+		{"reply", testFrame(68), false},
+		{"tagged reply", tagged(testFrame(68), 7), false},
+		{"fragment", fragment, false},
+		{"short", testFrame(serverPort)[:20], false},
+	}
+	for _, tc := range testCases {
+		if got := runBPF(t, dhcpFilter(), tc.frame) != 0; got != tc.accept {
+			t.Errorf("%s: expected accept=%t, got %t", tc.name, tc.accept, got)
+		}
+	}
+}
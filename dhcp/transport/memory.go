@@ -0,0 +1,179 @@
+package transport
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// memoryQueueLen is how many packets a MemoryConn buffers before it drops
+// further ones, like a full socket buffer.
+const memoryQueueLen = 64
+
+var memoryServerMAC = net.HardwareAddr{0x02, 0, 0, 0, 0, 0x01}
+
+// MemoryNetwork is an in-memory link between a server and its clients, for
+// running complete conversations in tests. Packets written by a client
+// reach the server, packets written by the server reach every client, and
+// frames reach the client with the destination hardware address.
+type MemoryNetwork struct {
+	mu      sync.Mutex
+	server  *MemoryConn
+	clients []*MemoryConn
+}
+
+func NewMemoryNetwork() *MemoryNetwork {
+	n := &MemoryNetwork{}
+	n.server = n.newConn(memoryServerMAC, &net.UDPAddr{IP: net.IPv4zero, Port: serverPort})
+	return n
+}
+
+// Server returns the server side of the link.
+func (n *MemoryNetwork) Server() *MemoryConn {
+	return n.server
+}
+
+// Client attaches a client with hardware address mac, listening on the DHCP
+// client port.
+func (n *MemoryNetwork) Client(mac net.HardwareAddr) *MemoryConn {
+	c := n.newConn(mac, &net.UDPAddr{IP: net.IPv4zero, Port: clientPort})
+	n.mu.Lock()
+	n.clients = append(n.clients, c)
+	n.mu.Unlock()
+	return c
+}
+
+func (n *MemoryNetwork) newConn(mac net.HardwareAddr, addr *net.UDPAddr) *MemoryConn {
+	return &MemoryConn{
+		network: n,
+		mac:     mac,
+		addr:    addr,
+		in:      make(chan memoryPacket, memoryQueueLen),
+		closed:  make(chan struct{}),
+	}
+}
+
+type memoryPacket struct {
+	data []byte
+	info PacketInfo
+}
+
+// MemoryConn is one end of a MemoryNetwork. The server end is a Transport
+// that can write frames, client ends are net.PacketConns.
+type MemoryConn struct {
+	network *MemoryNetwork
+	mac     net.HardwareAddr
+	addr    *net.UDPAddr
+	in      chan memoryPacket
+
+	mu        sync.Mutex
+	deadline  time.Time
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func (c *MemoryConn) deliver(to *MemoryConn, data []byte) {
+	p := memoryPacket{
+		data: append([]byte(nil), data...),
+		info: PacketInfo{Src: c.addr, SrcMAC: c.mac, IfIndex: 1, Interface: "mem0"},
+	}
+	select {
+	case to.in <- p:
+	default:
+	}
+}
+
+func (c *MemoryConn) ReadPacket(p []byte) (int, *PacketInfo, error) {
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case m := <-c.in:
+		return copy(p, m.data), &m.info, nil
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (c *MemoryConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, info, err := c.ReadPacket(p)
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, info.Src, nil
+}
+
+// WriteTo sends p to the server, or from the server to all clients. The
+// address is not used.
+func (c *MemoryConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	if c != c.network.server {
+		c.deliver(c.network.server, p)
+		return len(p), nil
+	}
+	c.network.mu.Lock()
+	clients := append([]*MemoryConn(nil), c.network.clients...)
+	c.network.mu.Unlock()
+	for _, client := range clients {
+		c.deliver(client, p)
+	}
+	return len(p), nil
+}
+
+// WriteFrame delivers the UDP payload of frame to the client with the
+// frame's destination address.
+func (c *MemoryConn) WriteFrame(frame []byte) error {
+	payload, err := parseFrame(frame, &PacketInfo{}, clientPort, true)
+	if err != nil {
+		return err
+	}
+	c.network.mu.Lock()
+	defer c.network.mu.Unlock()
+	for _, client := range c.network.clients {
+		if client.mac.String() == net.HardwareAddr(frame[0:6]).String() {
+			c.deliver(client, payload)
+		}
+	}
+	return nil
+}
+
+func (c *MemoryConn) HardwareAddr() net.HardwareAddr {
+	return c.mac
+}
+
+func (c *MemoryConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+func (c *MemoryConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *MemoryConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *MemoryConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *MemoryConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
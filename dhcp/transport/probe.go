@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"context"
+	"dhcp/protocol"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync/atomic"
+)
+
+const (
+	icmpEchoReply   = 0
+	icmpEchoRequest = 8
+)
+
+// Prober checks whether an address is already used by another host.
+type Prober interface {
+	// Probe reports whether a host answered for ip before ctx is done. ctx
+	// must have a deadline.
+	Probe(ctx context.Context, ip net.IP) (bool, error)
+}
+
+// ICMPProber pings the address. Like the DHCP socket it needs a raw socket
+// and therefore root or CAP_NET_RAW.
+type ICMPProber struct {
+	id  uint16
+	seq atomic.Uint32
+}
+
+func NewICMPProber() *ICMPProber {
+	return &ICMPProber{id: uint16(os.Getpid())}
+}
+
+func (p *ICMPProber) Probe(ctx context.Context, ip net.IP) (bool, error) {
+	conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return false, fmt.Errorf("failed to open ICMP socket: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	seq := uint16(p.seq.Add(1))
+	if _, err := conn.WriteTo(icmpEcho(icmpEchoRequest, p.id, seq), &net.IPAddr{IP: ip}); err != nil {
+		return false, fmt.Errorf("failed to send echo request: %w", err)
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return false, nil
+			}
+			return false, fmt.Errorf("failed to read echo reply: %w", err)
+		}
+		from, ok := addr.(*net.IPAddr)
+		if ok && from.IP.Equal(ip) && isEchoReply(buf[:n], p.id, seq) {
+			return true, nil
+		}
+	}
+}
+
+func icmpEcho(typ byte, id, seq uint16) []byte {
+	msg := make([]byte, 8)
+	msg[0] = typ
+	binary.BigEndian.PutUint16(msg[4:], id)
+	binary.BigEndian.PutUint16(msg[6:], seq)
+	binary.BigEndian.PutUint16(msg[2:], protocol.Checksum(msg))
+	return msg
+}
+
+func isEchoReply(msg []byte, id, seq uint16) bool {
+	return len(msg) >= 8 && msg[0] == icmpEchoReply &&
+		binary.BigEndian.Uint16(msg[4:]) == id && binary.BigEndian.Uint16(msg[6:]) == seq
+}
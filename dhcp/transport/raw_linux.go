@@ -0,0 +1,165 @@
+//go:build linux
+
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// packetAuxdata is the PACKET_AUXDATA socket option, the tpacket_auxdata
+	// status bits and size are from linux/if_packet.h.
+	packetAuxdata        = 8
+	tpStatusCsumNotReady = 1 << 3
+	tpStatusVLANValid    = 1 << 4
+	tpacketAuxdataLen    = 20
+)
+
+// rawSocket is an AF_PACKET socket on one interface that receives the
+// frames matching dhcpFilter and sends complete frames.
+type rawSocket struct {
+	f     *os.File
+	rc    syscall.RawConn
+	iface *net.Interface
+
+	// mu serializes reads into frame and oob.
+	mu    sync.Mutex
+	frame []byte
+	oob   []byte
+}
+
+func listenRaw(iface *net.Interface) (*rawSocket, error) {
+	// The socket is created with protocol 0, so it receives nothing until
+	// it is bound with the filter already in place.
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create packet socket: %w", err)
+	}
+	if err := attachFilter(fd, dhcpFilter()); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to attach BPF filter: %w", err)
+	}
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_PACKET, packetAuxdata, 1); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to enable packet auxdata: %w", err)
+	}
+	addr := &syscall.SockaddrLinklayer{Protocol: htons(syscall.ETH_P_ALL), Ifindex: iface.Index}
+	if err := syscall.Bind(fd, addr); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to bind packet socket: %w", err)
+	}
+
+	f := os.NewFile(uintptr(fd), "packet:"+iface.Name)
+	rc, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &rawSocket{
+		f:     f,
+		rc:    rc,
+		iface: iface,
+		// Room for the MTU, the Ethernet header and one VLAN tag.
+		frame: make([]byte, max(iface.MTU, 1500)+18),
+		oob:   make([]byte, syscall.CmsgSpace(tpacketAuxdataLen)),
+	}, nil
+}
+
+func attachFilter(fd int, prog []bpfInstruction) error {
+	filter := make([]syscall.SockFilter, len(prog))
+	for i, ins := range prog {
+		filter[i] = syscall.SockFilter{Code: ins.Code, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+	fprog := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, uintptr(fd),
+		syscall.SOL_SOCKET, syscall.SO_ATTACH_FILTER,
+		uintptr(unsafe.Pointer(&fprog)), unsafe.Sizeof(fprog), 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// readPacket reads frames until one holds a valid DHCP request and copies
+// its payload to p.
+func (r *rawSocket) readPacket(p []byte) (int, *PacketInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	frame, oob := r.frame, r.oob
+	for {
+		var n, oobn int
+		var from syscall.Sockaddr
+		var rerr error
+		err := r.rc.Read(func(fd uintptr) bool {
+			n, oobn, _, from, rerr = syscall.Recvmsg(int(fd), frame, oob, 0)
+			return !errors.Is(rerr, syscall.EAGAIN)
+		})
+		if err == nil {
+			err = rerr
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+
+		info := &PacketInfo{IfIndex: r.iface.Index, Interface: r.iface.Name}
+		if ll, ok := from.(*syscall.SockaddrLinklayer); ok {
+			if ll.Pkttype == syscall.PACKET_OUTGOING {
+				continue
+			}
+			info.IfIndex = ll.Ifindex
+		}
+		status, vlan := auxdata(oob[:oobn])
+		payload, err := parseFrame(frame[:n], info, serverPort, status&tpStatusCsumNotReady == 0)
+		if err != nil {
+			continue
+		}
+		// Tags stripped by the NIC or kernel are only in the auxdata.
+		if status&tpStatusVLANValid != 0 {
+			info.VLAN = vlan & 0x0fff
+		}
+		return copy(p, payload), info, nil
+	}
+}
+
+// auxdata returns the status and VLAN TCI of the tpacket_auxdata control
+// message in oob.
+func auxdata(oob []byte) (status uint32, vlan uint16) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return 0, 0
+	}
+	for _, m := range msgs {
+		if m.Header.Level == syscall.SOL_PACKET && m.Header.Type == packetAuxdata && len(m.Data) >= tpacketAuxdataLen {
+			return binary.NativeEndian.Uint32(m.Data[0:]), binary.NativeEndian.Uint16(m.Data[16:])
+		}
+	}
+	return 0, 0
+}
+
+func (r *rawSocket) writeFrame(frame []byte) error {
+	if len(frame) < 14 {
+		return fmt.Errorf("short frame of %d bytes", len(frame))
+	}
+	addr := &syscall.SockaddrLinklayer{Ifindex: r.iface.Index, Halen: 6}
+	copy(addr.Addr[:], frame[0:6])
+	var serr error
+	err := r.rc.Write(func(fd uintptr) bool {
+		serr = syscall.Sendto(int(fd), frame, 0, addr)
+		return !errors.Is(serr, syscall.EAGAIN)
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
+
+func (r *rawSocket) close() error {
+	return r.f.Close()
+}
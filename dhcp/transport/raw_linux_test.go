@@ -0,0 +1,85 @@
+//go:build linux
+
+package transport
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRawSocketReceive(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("No loopback interface: %v", err)
+	}
+	raw, err := listenRaw(lo)
+	if errors.Is(err, syscall.EPERM) {
+		t.Skip("Packet sockets need CAP_NET_RAW")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.close()
+
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// Only the datagram to port 67 passes the filter.
+	for _, port := range []int{68, serverPort} {
+		if _, err := client.WriteTo([]byte("dhcp message"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	raw.f.SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 1500)
+	n, info, err := raw.readPacket(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "dhcp message" {
+		t.Errorf("Unexpected payload %q", buf[:n])
+	}
+	if info.IfIndex != lo.Index || info.Src.Port != client.LocalAddr().(*net.UDPAddr).Port {
+		t.Errorf("Expected ifindex %d and source %s, got %d and %s", lo.Index, client.LocalAddr(), info.IfIndex, info.Src)
+	}
+}
+
+func TestListenRawDropsOnUDPSocket(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("No loopback interface: %v", err)
+	}
+	tr, err := ListenRaw(lo)
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EADDRINUSE) {
+		t.Skipf("Cannot listen on port 67: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.WriteTo([]byte("dhcp message"), &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: serverPort}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The request reaches the packet socket but not the UDP socket.
+	tr.raw.f.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := tr.ReadPacket(make([]byte, 1500)); err != nil {
+		t.Fatalf("Expected the request on the packet socket: %v", err)
+	}
+	tr.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, _, err := tr.conn.ReadFrom(make([]byte, 1500)); err == nil {
+		t.Errorf("Expected the UDP socket to drop the request, read %d bytes", n)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package transport
+
+import "errors"
+
+// ListenInterface is not supported, serving configured interfaces needs
+// packet sockets.
+func ListenInterface(name string) (Transport, error) {
+	return nil, errors.New("serving configured interfaces is only supported on Linux")
+}
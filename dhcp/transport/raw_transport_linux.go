@@ -0,0 +1,158 @@
+//go:build linux
+
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// RawTransport reads requests from an AF_PACKET socket with a BPF filter,
+// so they are seen with their link-layer details and before the host's
+// firewall. Replies to clients that have no address yet are sent as
+// Ethernet frames on the same socket, all others through a UDP socket bound
+// to the serving interface.
+type RawTransport struct {
+	conn net.PacketConn
+	raw  *rawSocket
+}
+
+func (t *RawTransport) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	return t.conn.WriteTo(p, addr)
+}
+
+// WriteFrame sends a complete Ethernet frame on the serving interface.
+func (t *RawTransport) WriteFrame(frame []byte) error {
+	return t.raw.writeFrame(frame)
+}
+
+// HardwareAddr returns the address of the serving interface.
+func (t *RawTransport) HardwareAddr() net.HardwareAddr {
+	return t.raw.iface.HardwareAddr
+}
+
+func (t *RawTransport) Close() error {
+	err := t.conn.Close()
+	if cerr := t.raw.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (t *RawTransport) LocalAddr() net.Addr {
+	return t.conn.LocalAddr()
+}
+
+func (t *RawTransport) SetDeadline(dt time.Time) error {
+	if err := t.conn.SetDeadline(dt); err != nil {
+		return err
+	}
+	return t.raw.f.SetDeadline(dt)
+}
+
+func (t *RawTransport) SetReadDeadline(dt time.Time) error {
+	return t.raw.f.SetReadDeadline(dt)
+}
+
+func (t *RawTransport) SetWriteDeadline(dt time.Time) error {
+	if err := t.conn.SetWriteDeadline(dt); err != nil {
+		return err
+	}
+	return t.raw.f.SetWriteDeadline(dt)
+}
+
+func (t *RawTransport) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	n, info, err := t.ReadPacket(p)
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, info.Src, nil
+}
+
+// ReadPacket reads the next DHCP request. Frames that are not valid IPv4
+// UDP datagrams to port 67 are skipped.
+func (t *RawTransport) ReadPacket(p []byte) (n int, info *PacketInfo, err error) {
+	return t.raw.readPacket(p)
+}
+
+// BuildConn returns a raw transport on the first interface with an IPv4
+// address.
+func BuildConn() (*RawTransport, error) {
+	iface, err := getInterface()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get interface: %v", err)
+	}
+	return ListenRaw(iface)
+}
+
+// ListenInterface returns a raw transport on the interface called name. It
+// fails while the interface does not exist or is down.
+func ListenInterface(name string) (Transport, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return nil, fmt.Errorf("interface %s is down", name)
+	}
+	return ListenRaw(iface)
+}
+
+// ListenRaw returns a raw transport on iface.
+func ListenRaw(iface *net.Interface) (*RawTransport, error) {
+	lc := net.ListenConfig{Control: func(network, address string, c syscall.RawConn) error {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			if serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_BROADCAST, 1); serr != nil {
+				serr = fmt.Errorf("cannot set broadcasting on socket: %v", serr)
+				return
+			}
+			if serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); serr != nil {
+				serr = fmt.Errorf("cannot set reuseaddr on socket: %v", serr)
+				return
+			}
+			if serr = syscall.BindToDevice(int(fd), iface.Name); serr != nil {
+				serr = fmt.Errorf("failed to bind to device: %v", serr)
+				return
+			}
+			// Requests are read from the packet socket. Drop them here
+			// rather than let them fill a receive buffer nobody reads.
+			if serr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, 0); serr != nil {
+				serr = fmt.Errorf("cannot set receive buffer size on socket: %v", serr)
+				return
+			}
+			if serr = attachFilter(int(fd), []bpfInstruction{{Code: bpfRetK, K: 0}}); serr != nil {
+				serr = fmt.Errorf("failed to attach BPF filter: %v", serr)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return serr
+	}}
+	// The UDP socket sends replies to clients that have an address. It is
+	// bound to port 67 so that they come from the server port and so that
+	// the kernel does not answer the requests, which it also delivers to
+	// the packet socket, with ICMP port unreachable. It never reads.
+	conn, err := lc.ListenPacket(context.Background(), "udp4", ":67")
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := listenRaw(iface)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &RawTransport{
+		conn: conn,
+		raw:  raw,
+	}, nil
+}
+
+func htons(host uint16) uint16 {
+	return (host&0xff)<<8 | (host >> 8)
+}
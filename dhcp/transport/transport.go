@@ -0,0 +1,30 @@
+package transport
+
+import (
+	"net"
+	"time"
+)
+
+// Transport carries DHCP messages between the server and its clients.
+// Replies are written with WriteTo, or as complete Ethernet frames when the
+// transport also implements protocol.FrameWriter.
+type Transport interface {
+	// ReadPacket reads the next request into p.
+	ReadPacket(p []byte) (n int, info *PacketInfo, err error)
+	WriteTo(p []byte, addr net.Addr) (n int, err error)
+	SetReadDeadline(t time.Time) error
+	Close() error
+}
+
+// PacketInfo describes how a DHCP message was received. Transports fill in
+// what they know, Src is always set.
+type PacketInfo struct {
+	Src    *net.UDPAddr
+	SrcMAC net.HardwareAddr
+	// IfIndex and Interface identify the ingress interface, they are zero
+	// if unknown.
+	IfIndex   int
+	Interface string
+	// VLAN is the 802.1Q VLAN id, 0 for untagged frames.
+	VLAN uint16
+}
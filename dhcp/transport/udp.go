@@ -0,0 +1,55 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// UDPTransport serves DHCP over a UDP socket. It only learns the source
+// address of requests, replies to clients without an address are broadcast.
+type UDPTransport struct {
+	conn net.PacketConn
+}
+
+// NewUDPTransport returns a transport using conn.
+func NewUDPTransport(conn net.PacketConn) *UDPTransport {
+	return &UDPTransport{conn: conn}
+}
+
+// ListenUDP listens on the IPv4 UDP address addr, e.g. ":67".
+func ListenUDP(addr string) (*UDPTransport, error) {
+	conn, err := net.ListenPacket("udp4", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return NewUDPTransport(conn), nil
+}
+
+func (t *UDPTransport) ReadPacket(p []byte) (int, *PacketInfo, error) {
+	n, addr, err := t.conn.ReadFrom(p)
+	if err != nil {
+		return 0, nil, err
+	}
+	src, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return 0, nil, fmt.Errorf("unexpected source address %v", addr)
+	}
+	return n, &PacketInfo{Src: src}, nil
+}
+
+func (t *UDPTransport) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return t.conn.WriteTo(p, addr)
+}
+
+func (t *UDPTransport) SetReadDeadline(dt time.Time) error {
+	return t.conn.SetReadDeadline(dt)
+}
+
+func (t *UDPTransport) LocalAddr() net.Addr {
+	return t.conn.LocalAddr()
+}
+
+func (t *UDPTransport) Close() error {
+	return t.conn.Close()
+}